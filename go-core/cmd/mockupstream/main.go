@@ -0,0 +1,129 @@
+// mockupstream 独立运行的模拟Anthropic上游，用于本地演示和手工测试，不需要真实的Claude账户
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/logging"
+	"claude-relay-core/internal/mockupstream"
+)
+
+// accountFlags 可重复的 -account NAME[:ORGANIZATION] 参数
+type accountFlags []string
+
+func (a *accountFlags) String() string { return strings.Join(*a, ",") }
+
+func (a *accountFlags) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+func main() {
+	var accounts accountFlags
+	listen := flag.String("listen", "127.0.0.1:4010", "监听地址")
+	tokenTTL := flag.Duration("token-ttl", mockupstream.DefaultTokenTTL, "签发的access token有效期")
+	staticRefresh := flag.Bool("static-refresh-tokens", false, "刷新时不轮换refresh token")
+	streamDelay := flag.Duration("stream-delay", 50*time.Millisecond, "SSE响应中相邻事件的间隔")
+	organization := flag.String("organization", mockupstream.OrganizationMax, "授权流程创建的账户的组织类型")
+	script := flag.String("script", "", "依次返回的错误状态码，如 429,529,401")
+	credentialsDir := flag.String("credentials-dir", "", "为预置账户写出凭据文件的目录，可用 relayctl import 导入")
+	flag.Var(&accounts, "account", "预置账户 NAME[:ORGANIZATION]，可重复")
+	flag.Parse()
+
+	logging.Setup(os.Stderr, config.LogConfig{Level: "info", Format: config.LogFormatText})
+
+	server := mockupstream.New(mockupstream.Options{
+		TokenTTL:            *tokenTTL,
+		StaticRefreshTokens: *staticRefresh,
+		StreamDelay:         *streamDelay,
+		Organization:        *organization,
+	})
+
+	replies, err := mockupstream.ParseScript(*script)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
+	}
+	server.Script(replies...)
+
+	for _, spec := range accounts {
+		name, org, _ := strings.Cut(spec, ":")
+		account := server.AddAccount(name, org)
+		if *credentialsDir != "" {
+			if err := writeCredentials(*credentialsDir, account); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("👤 账户 %s (%s)\n", account.Name, account.Organization)
+	}
+	if *credentialsDir != "" && len(accounts) > 0 {
+		fmt.Printf("   凭据已写入 %s，可用 relayctl import %s/*.json 导入\n", *credentialsDir, *credentialsDir)
+	}
+
+	base := "http://" + *listen
+	fmt.Printf("🧪 模拟上游监听 %s\n", base)
+	fmt.Println("   转发服务设置以下环境变量即可使用:")
+	fmt.Printf("   OAUTH_AUTHORIZE_URL=%s%s\n", base, mockupstream.AuthorizePath)
+	fmt.Printf("   OAUTH_TOKEN_URL=%s%s\n", base, mockupstream.TokenPath)
+	fmt.Printf("   OAUTH_PROFILE_URL=%s%s\n", base, mockupstream.ProfilePath)
+	fmt.Printf("   CLAUDE_API_URL=%s%s\n", base, mockupstream.MessagesPath)
+
+	slog.Info("模拟上游已启动", "listen", *listen, "accounts", len(accounts), "scripted", len(replies))
+	if err := http.ListenAndServe(*listen, logRequests(server)); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeCredentials 以Claude Code CLI凭据格式写出账户，文件名为账户名
+func writeCredentials(dir string, account mockupstream.Account) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建凭据目录失败: %w", err)
+	}
+	jsonData, err := json.MarshalIndent(account.Credentials(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化凭据失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, account.Name+".json"), jsonData, 0600); err != nil {
+		return fmt.Errorf("写入凭据文件失败: %w", err)
+	}
+	return nil
+}
+
+// statusRecorder 记录响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// logRequests 打印每个请求的结果
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		slog.Info("模拟上游请求", "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"latency_ms", time.Since(start).Milliseconds())
+	})
+}
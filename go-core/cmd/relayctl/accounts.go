@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"claude-relay-core/internal/oauth"
+)
+
+// runAccounts 账户管理: list, status, enable, disable, delete, refresh, profile, release
+func runAccounts(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: relayctl accounts list|status|enable|disable|delete|refresh|profile|release [ACCOUNT]")
+	}
+	action, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("accounts "+action, flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	fs.Parse(args)
+
+	if action == "list" {
+		accounts, err := listAccounts(opts)
+		if err != nil {
+			return err
+		}
+		printAccounts(accounts)
+		return nil
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: relayctl accounts %s ACCOUNT", action)
+	}
+	account := fs.Arg(0)
+
+	switch action {
+	case "status":
+		info, err := accountStatus(opts, account)
+		if err != nil {
+			return err
+		}
+		printAccountInfo(info)
+	case "enable", "disable":
+		info, err := setAccountEnabled(opts, account, action == "enable")
+		if err != nil {
+			return err
+		}
+		if info.Enabled {
+			fmt.Printf("✅ 账户 %s 已启用\n", info.Name)
+		} else {
+			fmt.Printf("✅ 账户 %s 已禁用\n", info.Name)
+		}
+	case "delete":
+		if err := deleteAccount(opts, account); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 账户 %s 已删除\n", account)
+	case "refresh":
+		expiresAt, err := refreshAccount(opts, account)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ 账户 %s token已刷新，有效期至 %s\n", account, expiresAt.Local().Format(time.DateTime))
+	case "profile":
+		profile, err := refreshProfile(opts, account)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ 账户 %s 资料已更新\n", account)
+		printProfile(profile)
+	case "release":
+		info, released, err := releaseAccount(opts, account)
+		if err != nil {
+			return err
+		}
+		if released {
+			fmt.Printf("✅ 账户 %s 已解除隔离\n", info.Name)
+		} else {
+			fmt.Printf("ℹ️  账户 %s 未被隔离\n", info.Name)
+		}
+	default:
+		return fmt.Errorf("未知的accounts子命令: %s", action)
+	}
+	return nil
+}
+
+// listAccounts 列出账户
+func listAccounts(opts *options) ([]*oauth.AccountInfo, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return nil, err
+		}
+		return backend.storage.ListAccounts()
+	}
+
+	var resp struct {
+		Accounts []*oauth.AccountInfo `json:"accounts"`
+	}
+	if err := opts.api().do("GET", "/oauth/accounts", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Accounts, nil
+}
+
+// accountStatus 查询单个账户
+func accountStatus(opts *options, account string) (*oauth.AccountInfo, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return nil, err
+		}
+		data, err := backend.storage.LoadOAuthData(account)
+		if err != nil {
+			return nil, err
+		}
+		return data.Info(), nil
+	}
+
+	var resp struct {
+		Info *oauth.AccountInfo `json:"info"`
+	}
+	if err := opts.api().do("GET", "/oauth/accounts/"+url.PathEscape(account)+"/status", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Info, nil
+}
+
+// setAccountEnabled 启用或禁用账户
+func setAccountEnabled(opts *options, account string, enabled bool) (*oauth.AccountInfo, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return nil, err
+		}
+		data, err := backend.storage.UpdateAccount(account, func(d *oauth.OAuthData) error {
+			d.Disabled = !enabled
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return data.Info(), nil
+	}
+
+	var resp struct {
+		Account *oauth.AccountInfo `json:"account"`
+	}
+	if err := opts.api().do("PATCH", "/oauth/accounts/"+url.PathEscape(account), map[string]bool{"enabled": enabled}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Account, nil
+}
+
+// deleteAccount 删除账户
+func deleteAccount(opts *options, account string) error {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return err
+		}
+		_, err = backend.storage.DeleteAccount(account)
+		return err
+	}
+	return opts.api().do("DELETE", "/oauth/accounts/"+url.PathEscape(account), nil, nil)
+}
+
+// releaseAccount 解除账户隔离，返回解除前是否处于隔离状态。
+// 直接操作存储时不会关闭运行中服务的账户熔断，服务运行时应通过 --server 解除
+func releaseAccount(opts *options, account string) (*oauth.AccountInfo, bool, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return nil, false, err
+		}
+		data, released, err := backend.storage.ReleaseAccount(account)
+		if err != nil {
+			return nil, false, err
+		}
+		return data.Info(), released, nil
+	}
+
+	var resp struct {
+		Released bool               `json:"released"`
+		Account  *oauth.AccountInfo `json:"account"`
+	}
+	if err := opts.api().do("DELETE", "/oauth/accounts/"+url.PathEscape(account)+"/quarantine", nil, &resp); err != nil {
+		return nil, false, err
+	}
+	return resp.Account, resp.Released, nil
+}
+
+// refreshAccount 立即刷新账户token。直接操作存储时不与运行中的服务协调刷新锁，
+// 服务运行时应通过 --server 刷新
+func refreshAccount(opts *options, account string) (time.Time, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return time.Time{}, err
+		}
+		data, err := backend.storage.LoadOAuthData(account)
+		if err != nil {
+			return time.Time{}, err
+		}
+		tokens, err := backend.client.RefreshAccessToken(context.Background(), data.RefreshToken, data.ProxyConfig)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if data, err = backend.storage.SaveTokens(data.ID, tokens); err != nil {
+			return time.Time{}, err
+		}
+		return data.ExpiresAt, nil
+	}
+
+	var resp struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := opts.api().do("POST", "/oauth/accounts/"+url.PathEscape(account)+"/refresh", nil, &resp); err != nil {
+		return time.Time{}, err
+	}
+	return resp.ExpiresAt, nil
+}
+
+// refreshProfile 重新读取账户资料
+func refreshProfile(opts *options, account string) (*oauth.Profile, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return nil, err
+		}
+		data, err := oauth.UpdateProfile(context.Background(), backend.client, backend.storage, account)
+		if err != nil {
+			return nil, err
+		}
+		return data.Profile, nil
+	}
+
+	var resp struct {
+		Profile *oauth.Profile `json:"profile"`
+	}
+	if err := opts.api().do("POST", "/oauth/accounts/"+url.PathEscape(account)+"/profile", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Profile, nil
+}
+
+// printAccounts 以表格打印账户列表
+func printAccounts(accounts []*oauth.AccountInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tEMAIL\tPLAN\tSTATUS\tPRIORITY\tEXPIRES\tPROXY\tLAST USED")
+	for _, a := range accounts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			a.Name, a.ID, orDash(a.Email), orDash(a.SubscriptionType), a.Status, a.Priority,
+			formatTime(&a.ExpiresAt), orDash(a.Proxy), formatTime(a.LastUsedAt))
+	}
+	w.Flush()
+}
+
+// printAccountInfo 打印单个账户详情
+func printAccountInfo(a *oauth.AccountInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "名称\t%s\n", a.Name)
+	fmt.Fprintf(w, "ID\t%s\n", a.ID)
+	fmt.Fprintf(w, "展示名称\t%s\n", orDash(a.DisplayName))
+	fmt.Fprintf(w, "邮箱\t%s\n", orDash(a.Email))
+	fmt.Fprintf(w, "组织\t%s\n", orDash(a.OrganizationUUID))
+	fmt.Fprintf(w, "订阅\t%s\n", orDash(a.SubscriptionType))
+	fmt.Fprintf(w, "描述\t%s\n", orDash(a.Description))
+	fmt.Fprintf(w, "标签\t%s\n", orDash(strings.Join(a.Tags, ",")))
+	fmt.Fprintf(w, "状态\t%s\n", a.Status)
+	if a.Quarantine != nil {
+		fmt.Fprintf(w, "隔离原因\t%s: %s (%s)\n", a.Quarantine.Reason, a.Quarantine.Message, formatTime(&a.Quarantine.At))
+	}
+	fmt.Fprintf(w, "优先级\t%d\n", a.Priority)
+	fmt.Fprintf(w, "过期时间\t%s\n", formatTime(&a.ExpiresAt))
+	fmt.Fprintf(w, "Scopes\t%s\n", orDash(strings.Join(a.Scopes, " ")))
+	fmt.Fprintf(w, "代理\t%s\n", orDash(a.Proxy))
+	fmt.Fprintf(w, "最近使用\t%s\n", formatTime(a.LastUsedAt))
+	if a.LastError != "" {
+		fmt.Fprintf(w, "最近错误\t%s (%s)\n", a.LastError, formatTime(a.LastErrorAt))
+	}
+	fmt.Fprintf(w, "创建时间\t%s\n", formatTime(&a.CreatedAt))
+	w.Flush()
+}
+
+// formatTime 格式化可选时间，空值显示为 -
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// orDash 空字符串显示为 -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
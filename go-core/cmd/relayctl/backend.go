@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/oauth"
+)
+
+// options 通用参数
+type options struct {
+	server     string
+	dataDir    string
+	configFile string
+	adminToken string
+
+	// HTTPS服务的CA证书和双向TLS客户端证书
+	caCert     string
+	clientCert string
+	clientKey  string
+}
+
+// addCommonFlags 注册通用参数
+func addCommonFlags(fs *flag.FlagSet) *options {
+	opts := &options{}
+	defaultServer := os.Getenv("RELAY_SERVER")
+	if defaultServer == "" {
+		defaultServer = "http://localhost:3000"
+	}
+	fs.StringVar(&opts.server, "server", defaultServer, "服务地址，Unix socket使用 unix:///path/to/relay.sock")
+	fs.StringVar(&opts.dataDir, "data-dir", "", "直接操作本地存储目录，不经过服务")
+	fs.StringVar(&opts.configFile, "config", "", "本地配置文件（YAML/TOML/JSON），默认取 CONFIG_FILE")
+	fs.StringVar(&opts.adminToken, "admin-token", os.Getenv("RELAY_ADMIN_TOKEN"), "管理令牌（服务设置了 ADMIN_TOKEN 时需要）")
+	fs.StringVar(&opts.caCert, "ca-cert", os.Getenv("RELAY_CA_CERT"), "验证HTTPS服务证书的CA文件")
+	fs.StringVar(&opts.clientCert, "client-cert", os.Getenv("RELAY_CLIENT_CERT"), "双向TLS客户端证书")
+	fs.StringVar(&opts.clientKey, "client-key", os.Getenv("RELAY_CLIENT_KEY"), "双向TLS客户端私钥")
+	return opts
+}
+
+// direct 是否直接操作本地存储
+func (o *options) direct() bool {
+	return o.dataDir != ""
+}
+
+// localBackend 直接操作本地存储时使用的配置、OAuth客户端和存储
+type localBackend struct {
+	config  *config.Config
+	client  *oauth.Client
+	storage *oauth.Storage
+}
+
+// loadConfig 加载本地配置：配置文件 < 环境变量
+func (o *options) loadConfig() (*config.Config, error) {
+	cfg, err := config.LoadWithOptions(config.LoadOptions{File: o.configFile})
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %w", err)
+	}
+	return cfg, nil
+}
+
+// openLocal 打开本地存储
+func (o *options) openLocal() (*localBackend, error) {
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	storage := oauth.NewStorage(o.dataDir)
+	if _, err := storage.MigrateLegacyAccounts(); err != nil {
+		return nil, fmt.Errorf("迁移旧版账户数据失败: %w", err)
+	}
+
+	return &localBackend{
+		config:  cfg,
+		client:  oauth.NewClient(cfg),
+		storage: storage,
+	}, nil
+}
+
+// resolveProxy 解析 --proxy 参数：代理URL直接解析；命名代理在本地模式下从本地配置查找，
+// 远程模式下原样返回名称，由服务端按其配置文件解析
+func (o *options) resolveProxy(value string) (*oauth.ProxyConfig, string, error) {
+	if value == "" {
+		return nil, "", nil
+	}
+	if strings.Contains(value, "://") {
+		proxyConfig, err := oauth.ParseProxyURL(value)
+		return proxyConfig, "", err
+	}
+	if !o.direct() {
+		return nil, value, nil
+	}
+
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	proxyConfig, err := oauth.NamedProxy(cfg, value)
+	return proxyConfig, "", err
+}
+
+// apiClient 管理REST API客户端
+type apiClient struct {
+	baseURL    string
+	adminToken string
+	httpClient *http.Client
+	err        error // 创建客户端时的配置错误，在发送请求时返回
+}
+
+// api 创建REST API客户端
+func (o *options) api() *apiClient {
+	baseURL := strings.TrimRight(o.server, "/")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// unix:///path/to/relay.sock：通过Unix socket连接，请求地址的host无意义
+	if socket, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+		baseURL = "http://unix"
+	}
+
+	var err error
+	if o.caCert != "" || o.clientCert != "" {
+		transport.TLSClientConfig, err = o.tlsConfig()
+	}
+
+	return &apiClient{
+		baseURL:    baseURL,
+		adminToken: o.adminToken,
+		httpClient: &http.Client{Timeout: 2 * time.Minute, Transport: transport},
+		err:        err,
+	}
+}
+
+// tlsConfig HTTPS客户端配置：自定义CA和双向TLS客户端证书
+func (o *options) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.caCert != "" {
+		pem, err := os.ReadFile(o.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA文件中没有有效的证书: %s", o.caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.clientCert, o.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// do 发送请求并解析JSON响应，非2xx状态码返回错误
+func (a *apiClient) do(method, path string, body, out interface{}) error {
+	if a.err != nil {
+		return a.err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("构建请求体失败: %w", err)
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequest(method, a.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.adminToken != "" {
+		req.Header.Set("X-Admin-Token", a.adminToken)
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// 部分接口在失败时仍返回明细，尽量解析
+		if out != nil {
+			json.Unmarshal(respBody, out)
+		}
+
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error != "" {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, errResp.Error)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("解析响应失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// expandHome 展开路径中的 ~/
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"claude-relay-core/internal/oauth"
+)
+
+// runExport 导出单个账户为Claude Code凭据格式
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: relayctl export [-o FILE] ACCOUNT")
+	}
+	account := fs.Arg(0)
+
+	var creds *oauth.ClaudeCredentials
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return err
+		}
+		data, err := backend.storage.LoadOAuthData(account)
+		if err != nil {
+			return err
+		}
+		creds = oauth.ToClaudeCredentials(data)
+	} else {
+		if err := opts.api().do("GET", "/oauth/accounts/"+url.PathEscape(account)+"/export", nil, &creds); err != nil {
+			return err
+		}
+	}
+
+	return writeJSONOutput(*output, creds)
+}
+
+// runBackup 导出全部账户为加密备份包
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	output := fs.String("o", "", "输出文件（必填）")
+	passphraseFile := fs.String("passphrase-file", "", "备份口令文件，默认取 RELAY_BACKUP_PASSPHRASE 环境变量")
+	fs.Parse(args)
+
+	if *output == "" {
+		return fmt.Errorf("用法: relayctl backup -o FILE [--passphrase-file FILE]")
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	var backup *oauth.Backup
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return err
+		}
+		if backup, err = backend.storage.ExportBackup(passphrase); err != nil {
+			return err
+		}
+	} else {
+		if err := opts.api().do("POST", "/oauth/backup", map[string]string{"passphrase": passphrase}, &backup); err != nil {
+			return err
+		}
+	}
+
+	if err := writeJSONOutput(*output, backup); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ 已备份 %d 个账户到 %s\n", backup.AccountCount, *output)
+	return nil
+}
+
+// runRestore 从加密备份包恢复账户
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	passphraseFile := fs.String("passphrase-file", "", "备份口令文件，默认取 RELAY_BACKUP_PASSPHRASE 环境变量")
+	overwrite := fs.Bool("overwrite", false, "覆盖已存在的同ID账户")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: relayctl restore [--overwrite] [--passphrase-file FILE] BACKUP_FILE")
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	raw, err := os.ReadFile(expandHome(fs.Arg(0)))
+	if err != nil {
+		return fmt.Errorf("读取备份文件失败: %w", err)
+	}
+	var backup oauth.Backup
+	if err := json.Unmarshal(raw, &backup); err != nil {
+		return fmt.Errorf("解析备份文件失败: %w", err)
+	}
+
+	var results []*oauth.RestoreResult
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return err
+		}
+		if results, err = backend.storage.RestoreBackup(&backup, passphrase, *overwrite); err != nil {
+			return err
+		}
+	} else {
+		var resp struct {
+			Results []*oauth.RestoreResult `json:"results"`
+		}
+		body := map[string]interface{}{"passphrase": passphrase, "backup": &backup, "overwrite": *overwrite}
+		if err := opts.api().do("POST", "/oauth/restore", body, &resp); err != nil && len(resp.Results) == 0 {
+			return err
+		}
+		results = resp.Results
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tID\tRESULT")
+	failed := 0
+	for _, r := range results {
+		if r.Status == oauth.RestoreStatusFailed {
+			failed++
+			fmt.Fprintf(w, "%s\t%s\t❌ %s\n", r.AccountName, r.AccountID, r.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.AccountName, r.AccountID, r.Status)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d 个账户恢复失败", failed)
+	}
+	return nil
+}
+
+// readPassphrase 从文件或环境变量读取备份口令
+func readPassphrase(file string) (string, error) {
+	if file != "" {
+		raw, err := os.ReadFile(expandHome(file))
+		if err != nil {
+			return "", fmt.Errorf("读取口令文件失败: %w", err)
+		}
+		return strings.TrimRight(string(raw), "\r\n"), nil
+	}
+
+	if passphrase := os.Getenv("RELAY_BACKUP_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	return "", fmt.Errorf("缺少备份口令，请使用 --passphrase-file 或设置 RELAY_BACKUP_PASSPHRASE")
+}
+
+// writeJSONOutput 将数据以JSON写入文件（0600）或标准输出
+func writeJSONOutput(path string, v interface{}) error {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化输出失败: %w", err)
+	}
+
+	if path == "" {
+		_, err := os.Stdout.Write(append(jsonData, '\n'))
+		return err
+	}
+	if err := os.WriteFile(expandHome(path), jsonData, 0600); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	return nil
+}
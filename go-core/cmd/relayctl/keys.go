@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"claude-relay-core/internal/apikey"
+)
+
+// keyView API Key展示信息，与管理API的返回结构一致
+type keyView struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Pool       string     `json:"pool,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// newKeyView 将本地存储的API Key转换为展示信息
+func newKeyView(key *apikey.Key) *keyView {
+	return &keyView{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Pool:       key.Pool,
+		Status:     key.Status(),
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+// runKeys API Key管理: create, list, revoke
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: relayctl keys create|list|revoke ...")
+	}
+	action, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("keys "+action, flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	expires := fs.String("expires", "", "有效期，如 720h，never表示永不过期，默认取配置 api_keys.default_ttl（仅create）")
+	pool := fs.String("pool", "", "限定调度的账户池，默认取配置 api_keys.default_pool（仅create）")
+	fs.Parse(args)
+
+	switch action {
+	case "create":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("用法: relayctl keys create [--expires 720h|never] [--pool POOL] NAME")
+		}
+		key, secret, err := createKey(opts, fs.Arg(0), *expires, *pool)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已创建API Key: %s (%s)\n", key.Name, key.ID)
+		fmt.Println()
+		fmt.Println("   " + secret)
+		fmt.Println()
+		fmt.Println("⚠️  明文只显示这一次，请妥善保存")
+	case "list":
+		keys, err := listKeys(opts)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tPOOL\tSTATUS\tCREATED\tEXPIRES\tLAST USED")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s…\t%s\t%s\t%s\t%s\t%s\n",
+				k.ID, k.Name, k.Prefix, orDash(k.Pool), k.Status, formatTime(&k.CreatedAt), formatTime(k.ExpiresAt), formatTime(k.LastUsedAt))
+		}
+		w.Flush()
+	case "revoke":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("用法: relayctl keys revoke KEY_ID|NAME")
+		}
+		key, err := revokeKey(opts, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ API Key %s (%s) 已吊销\n", key.Name, key.ID)
+	default:
+		return fmt.Errorf("未知的keys子命令: %s", action)
+	}
+	return nil
+}
+
+// createKey 创建API Key，expires和pool为空时使用配置的默认值
+func createKey(opts *options, name, expires, pool string) (*keyView, string, error) {
+	if opts.direct() {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return nil, "", err
+		}
+
+		ttl := backend.config.APIKeys.DefaultTTL
+		switch expires {
+		case "":
+		case "never":
+			ttl = 0
+		default:
+			if ttl, err = time.ParseDuration(expires); err != nil || ttl <= 0 {
+				return nil, "", fmt.Errorf("无效的有效期: %s", expires)
+			}
+		}
+		if pool == "" {
+			pool = backend.config.APIKeys.DefaultPool
+		}
+		if pool != "" && backend.config.Pools[pool] == nil {
+			return nil, "", fmt.Errorf("账户池不存在: %s", pool)
+		}
+
+		key, secret, err := apikey.NewStore(opts.dataDir).Create(name, ttl, pool)
+		if err != nil {
+			return nil, "", err
+		}
+		return newKeyView(key), secret, nil
+	}
+
+	body := map[string]string{"name": name, "expires_in": expires, "pool": pool}
+	var resp struct {
+		Key    *keyView `json:"key"`
+		Secret string   `json:"secret"`
+	}
+	if err := opts.api().do("POST", "/admin/keys", body, &resp); err != nil {
+		return nil, "", err
+	}
+	return resp.Key, resp.Secret, nil
+}
+
+// listKeys 列出API Key
+func listKeys(opts *options) ([]*keyView, error) {
+	if opts.direct() {
+		keys, err := apikey.NewStore(opts.dataDir).List()
+		if err != nil {
+			return nil, err
+		}
+		views := make([]*keyView, 0, len(keys))
+		for _, key := range keys {
+			views = append(views, newKeyView(key))
+		}
+		return views, nil
+	}
+
+	var resp struct {
+		Keys []*keyView `json:"keys"`
+	}
+	if err := opts.api().do("GET", "/admin/keys", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// revokeKey 吊销API Key
+func revokeKey(opts *options, ref string) (*keyView, error) {
+	if opts.direct() {
+		key, err := apikey.NewStore(opts.dataDir).Revoke(ref)
+		if err != nil {
+			return nil, err
+		}
+		return newKeyView(key), nil
+	}
+
+	var resp struct {
+		Key *keyView `json:"key"`
+	}
+	if err := opts.api().do("DELETE", "/admin/keys/"+url.PathEscape(ref), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Key, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/oauth"
+)
+
+// runLogin 执行OAuth PKCE授权流程：生成授权URL、打开浏览器、读取授权码并交换token
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	displayName := fs.String("display-name", "", "账户展示名称")
+	proxyArg := fs.String("proxy", "", "账户绑定的代理（代理URL或配置文件中的代理名），授权与后续请求都经过该代理")
+	noBrowser := fs.Bool("no-browser", false, "不自动打开浏览器，只打印授权URL")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: relayctl login [--proxy URL|NAME] [--display-name NAME] ACCOUNT")
+	}
+	account := fs.Arg(0)
+	if err := oauth.ValidateAccountName(account); err != nil {
+		return err
+	}
+
+	proxyConfig, proxyName, err := opts.resolveProxy(*proxyArg)
+	if err != nil {
+		return err
+	}
+
+	if opts.direct() {
+		return loginLocal(opts, account, *displayName, proxyConfig, !*noBrowser)
+	}
+	return loginRemote(opts, account, *displayName, proxyConfig, proxyName, !*noBrowser)
+}
+
+// loginLocal 在本地完成PKCE流程并直接写入存储
+func loginLocal(opts *options, account, displayName string, proxyConfig *oauth.ProxyConfig, openBrowser bool) error {
+	backend, err := opts.openLocal()
+	if err != nil {
+		return err
+	}
+
+	pkceData, err := oauth.GenerateOAuthParams(backend.config, backend.config.OAuth.RedirectURI)
+	if err != nil {
+		return err
+	}
+
+	code, err := promptAuthorizationCode(pkceData.AuthURL, pkceData.ExpiresAt, openBrowser)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := backend.client.ExchangeCodeForToken(context.Background(), code, pkceData, proxyConfig)
+	if err != nil {
+		return err
+	}
+
+	data, err := backend.storage.SaveTokens(account, tokens)
+	if err != nil {
+		return err
+	}
+	if displayName != "" {
+		if data, err = backend.storage.UpdateAccount(data.ID, func(d *oauth.OAuthData) error {
+			d.DisplayName = displayName
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if updated, err := oauth.UpdateProfile(context.Background(), backend.client, backend.storage, data.ID); err != nil {
+		fmt.Printf("⚠️  读取账户资料失败: %v\n", err)
+	} else {
+		data = updated
+	}
+
+	fmt.Printf("✅ 登录成功: %s (%s)，token有效期至 %s\n", data.Name, data.ID, data.ExpiresAt.Local().Format(time.DateTime))
+	printProfile(data.Profile)
+	return nil
+}
+
+// loginRemote 通过管理API完成PKCE流程，PKCE会话保存在服务端
+func loginRemote(opts *options, account, displayName string, proxyConfig *oauth.ProxyConfig, proxyName string, openBrowser bool) error {
+	api := opts.api()
+
+	var authResp struct {
+		AuthURL   string    `json:"auth_url"`
+		State     string    `json:"state"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := api.do("POST", "/oauth/auth-url", map[string]interface{}{
+		"account_name":  account,
+		"display_name":  displayName,
+		"proxy_config":  proxyConfig,
+		"proxy_name":    proxyName,
+		"callback_mode": config.CallbackModeManual,
+	}, &authResp); err != nil {
+		return err
+	}
+
+	code, err := promptAuthorizationCode(authResp.AuthURL, authResp.ExpiresAt, openBrowser)
+	if err != nil {
+		return err
+	}
+
+	var tokenResp struct {
+		Account   string         `json:"account"`
+		AccountID string         `json:"account_id"`
+		ExpiresAt time.Time      `json:"expires_at"`
+		Profile   *oauth.Profile `json:"profile"`
+	}
+	if err := api.do("POST", "/oauth/token", map[string]interface{}{
+		"authorization_code": code,
+		"state":              authResp.State,
+	}, &tokenResp); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ 登录成功: %s (%s)，token有效期至 %s\n", tokenResp.Account, tokenResp.AccountID, tokenResp.ExpiresAt.Local().Format(time.DateTime))
+	printProfile(tokenResp.Profile)
+	return nil
+}
+
+// printProfile 打印账户资料
+func printProfile(profile *oauth.Profile) {
+	if profile == nil || profile.Email == "" {
+		return
+	}
+	fmt.Printf("   邮箱: %s，组织: %s，订阅: %s\n", profile.Email, orDash(profile.OrganizationName), orDash(profile.SubscriptionType))
+}
+
+// promptAuthorizationCode 展示授权URL并从标准输入读取授权码
+func promptAuthorizationCode(authURL string, expiresAt time.Time, openBrowser bool) (string, error) {
+	fmt.Println("🔗 请在浏览器中完成授权:")
+	fmt.Println()
+	fmt.Println("   " + authURL)
+	fmt.Println()
+	if openBrowser {
+		if err := browse(authURL); err != nil {
+			fmt.Printf("⚠️  无法自动打开浏览器: %v\n", err)
+		}
+	}
+	if !expiresAt.IsZero() {
+		fmt.Printf("⏳ 授权会话有效期至 %s\n", expiresAt.Local().Format(time.DateTime))
+	}
+
+	fmt.Print("📋 粘贴授权页面显示的授权码: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取授权码失败: %w", err)
+	}
+
+	code := strings.TrimSpace(line)
+	if code == "" {
+		return "", fmt.Errorf("授权码不能为空")
+	}
+	return code, nil
+}
+
+// browse 使用系统默认浏览器打开URL
+func browse(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
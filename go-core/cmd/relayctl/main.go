@@ -0,0 +1,130 @@
+// relayctl Claude Relay Service 命令行管理工具
+//
+// 既可以通过管理REST API操作运行中的服务（--server），
+// 也可以直接读写本地存储目录（--data-dir）。
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/logging"
+)
+
+// command 子命令定义
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []*command{
+	{
+		name:    "login",
+		usage:   "relayctl login [--server URL | --data-dir DIR] [--proxy URL] [--display-name NAME] [--no-browser] ACCOUNT",
+		summary: "执行OAuth PKCE授权流程并保存账户（打开浏览器，粘贴授权码）",
+		run:     runLogin,
+	},
+	{
+		name:    "accounts",
+		usage:   "relayctl accounts list | status|enable|disable|delete|refresh|profile|release [--server URL | --data-dir DIR] ACCOUNT",
+		summary: "账户列表、状态查看、启用/禁用、删除、立即刷新token、重新读取账户资料",
+		run:     runAccounts,
+	},
+	{
+		name:    "keys",
+		usage:   "relayctl keys create [--expires 720h] NAME | list | revoke KEY_ID",
+		summary: "创建、列出、吊销API Key",
+		run:     runKeys,
+	},
+	{
+		name:    "usage",
+		usage:   "relayctl usage [--from DATE] [--to DATE] [--account NAME] [--key ID] [--model M] [--group-by date|account|key|model|total]",
+		summary: "查询按账户、API Key、模型统计的用量",
+		run:     runUsage,
+	},
+	{
+		name:    "proxy",
+		usage:   "relayctl proxy test [--target URL] PROXY_URL | --account ACCOUNT",
+		summary: "测试代理连通性（TCP连接 + 经代理请求Claude API）",
+		run:     runProxy,
+	},
+	{
+		name:    "import",
+		usage:   "relayctl import [--server URL | --data-dir DIR] [--name NAME] [--proxy URL] FILE | NAME=FILE ...",
+		summary: "导入Claude Code CLI凭据（~/.claude/.credentials.json），支持批量",
+		run:     runImport,
+	},
+	{
+		name:    "export",
+		usage:   "relayctl export [--server URL | --data-dir DIR] [-o FILE] ACCOUNT",
+		summary: "导出账户为Claude Code凭据格式",
+		run:     runExport,
+	},
+	{
+		name:    "backup",
+		usage:   "relayctl backup [--server URL | --data-dir DIR] -o FILE [--passphrase-file FILE]",
+		summary: "导出全部账户及代理配置为加密备份包",
+		run:     runBackup,
+	},
+	{
+		name:    "restore",
+		usage:   "relayctl restore [--server URL | --data-dir DIR] [--overwrite] [--passphrase-file FILE] BACKUP_FILE",
+		summary: "从加密备份包恢复账户",
+		run:     runRestore,
+	},
+	{
+		name:    "replay",
+		usage:   "relayctl replay serve [--dir DIR] [--listen ADDR] [--realtime] | list [--dir DIR]",
+		summary: "以录制的上游流量启动本地假上游，或列出录制",
+		run:     runReplay,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	// 本地模式下存储层的日志只输出警告，正常结果由各命令自己打印
+	logging.Setup(os.Stderr, config.LogConfig{Level: "warn", Format: config.LogFormatText})
+
+	name, args := os.Args[1], os.Args[2:]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
+
+// printUsage 打印帮助信息
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "relayctl - Claude Relay Service 命令行管理工具")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+		fmt.Fprintf(os.Stderr, "             %s\n", cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "通用参数:")
+	fmt.Fprintln(os.Stderr, "  --server URL    服务地址，默认取 RELAY_SERVER 环境变量或 http://localhost:3000")
+	fmt.Fprintln(os.Stderr, "  --data-dir DIR  直接操作本地存储目录，不经过服务")
+	fmt.Fprintln(os.Stderr, "  --admin-token T 管理令牌，默认取 RELAY_ADMIN_TOKEN 环境变量")
+}
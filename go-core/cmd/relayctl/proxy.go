@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"claude-relay-core/internal/oauth"
+	"claude-relay-core/internal/proxy"
+)
+
+// proxyTestResult 代理测试结果，与管理API的返回结构一致
+type proxyTestResult struct {
+	Proxy            string `json:"proxy"`
+	Target           string `json:"target"`
+	OK               bool   `json:"ok"`
+	DialLatencyMs    int64  `json:"dial_latency_ms"`
+	RequestLatencyMs int64  `json:"request_latency_ms"`
+	StatusCode       int    `json:"status_code"`
+	Error            string `json:"error,omitempty"`
+}
+
+// runProxy 代理相关命令: test
+func runProxy(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return fmt.Errorf("用法: relayctl proxy test [--account ACCOUNT] [--target URL] [PROXY_URL|NAME]")
+	}
+
+	fs := flag.NewFlagSet("proxy test", flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	account := fs.String("account", "", "测试账户绑定的代理")
+	target := fs.String("target", "", "经代理请求的目标地址，默认为Claude API地址")
+	fs.Parse(args[1:])
+
+	if (fs.NArg() == 1) == (*account != "") {
+		return fmt.Errorf("用法: relayctl proxy test [--target URL] PROXY_URL|NAME | --account ACCOUNT")
+	}
+
+	var result proxyTestResult
+	if opts.direct() {
+		var err error
+		if result, err = testProxyLocal(opts, fs.Arg(0), *account, *target); err != nil {
+			return err
+		}
+	} else {
+		body := map[string]string{"account": *account, "target": *target}
+		if arg := fs.Arg(0); strings.Contains(arg, "://") {
+			body["proxy_url"] = arg
+		} else {
+			body["proxy_name"] = arg
+		}
+		if err := opts.api().do("POST", "/admin/proxy/test", body, &result); err != nil {
+			return err
+		}
+	}
+
+	if !result.OK {
+		return fmt.Errorf("代理 %s 不可用: %s", result.Proxy, result.Error)
+	}
+	fmt.Printf("✅ 代理 %s 可用\n", result.Proxy)
+	fmt.Printf("   TCP连接: %dms\n", result.DialLatencyMs)
+	fmt.Printf("   %s: HTTP %d，%dms\n", result.Target, result.StatusCode, result.RequestLatencyMs)
+	return nil
+}
+
+// testProxyLocal 在本机测试代理
+func testProxyLocal(opts *options, proxyArg, account, target string) (proxyTestResult, error) {
+	cfg, err := opts.loadConfig()
+	if err != nil {
+		return proxyTestResult{}, err
+	}
+
+	var proxyConfig *oauth.ProxyConfig
+	if account != "" {
+		backend, err := opts.openLocal()
+		if err != nil {
+			return proxyTestResult{}, err
+		}
+		data, err := backend.storage.LoadOAuthData(account)
+		if err != nil {
+			return proxyTestResult{}, err
+		}
+		if data.ProxyConfig == nil {
+			return proxyTestResult{}, fmt.Errorf("账户 %s 未绑定代理", account)
+		}
+		proxyConfig = data.ProxyConfig
+	} else {
+		if proxyConfig, err = oauth.ResolveProxy(cfg, proxyArg); err != nil {
+			return proxyTestResult{}, err
+		}
+	}
+	if target == "" {
+		target = cfg.Claude.APIUrl
+	}
+
+	probe, err := proxy.ProbeProxy(&proxy.ProxyConfig{
+		Type:     proxyConfig.Type,
+		Host:     proxyConfig.Host,
+		Port:     proxyConfig.Port,
+		Username: proxyConfig.Username,
+		Password: proxyConfig.Password,
+	}, target, cfg.Proxy.Timeout)
+
+	result := proxyTestResult{
+		Proxy:            proxyConfig.String(),
+		Target:           target,
+		OK:               err == nil,
+		DialLatencyMs:    probe.DialLatency.Milliseconds(),
+		RequestLatencyMs: probe.RequestLatency.Milliseconds(),
+		StatusCode:       probe.StatusCode,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/logging"
+	"claude-relay-core/internal/replay"
+)
+
+// runReplay 上游录制相关命令: serve, list
+func runReplay(args []string) error {
+	if len(args) == 0 || (args[0] != "serve" && args[0] != "list") {
+		return fmt.Errorf("用法: relayctl replay serve [--dir DIR] [--listen ADDR] [--realtime] | list [--dir DIR]")
+	}
+
+	fs := flag.NewFlagSet("replay "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "本地配置文件（YAML/TOML/JSON），默认取 CONFIG_FILE")
+	dir := fs.String("dir", "", "fixture目录，默认取配置中的 replay.dir")
+	listen := fs.String("listen", "127.0.0.1:4001", "假上游监听地址")
+	realtime := fs.Bool("realtime", false, "按录制的时间间隔返回响应头和SSE分块")
+	fs.Parse(args[1:])
+
+	if *dir == "" {
+		cfg, err := config.LoadWithOptions(config.LoadOptions{File: *configFile})
+		if err != nil {
+			return fmt.Errorf("加载配置失败: %w", err)
+		}
+		*dir = cfg.Replay.Dir
+	}
+
+	if args[0] == "list" {
+		return listFixtures(*dir)
+	}
+
+	// 假上游需要打印每次回放的结果
+	logging.Setup(os.Stderr, config.LogConfig{Level: "info", Format: config.LogFormatText})
+	fmt.Printf("🎞️  回放 %s 中的录制，监听 http://%s\n", *dir, *listen)
+	fmt.Printf("   转发服务设置 CLAUDE_API_URL=http://%s/v1/messages 即可使用\n", *listen)
+	slog.Info("假上游已启动", "dir", *dir, "listen", *listen, "realtime", *realtime)
+	return http.ListenAndServe(*listen, &replay.Handler{Dir: *dir, Realtime: *realtime})
+}
+
+// listFixtures 列出录制
+func listFixtures(dir string) error {
+	fixtures, err := replay.List(dir)
+	if err != nil {
+		return err
+	}
+	if len(fixtures) == 0 {
+		fmt.Printf("%s 中没有录制\n", dir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "指纹\t请求\t状态\t分块\t录制时间")
+	for _, fixture := range fixtures {
+		fmt.Fprintf(w, "%s\t%s %s\t%d\t%d\t%s\n", fixture.Fingerprint, fixture.Request.Method, fixture.Request.Path,
+			fixture.Response.Status, len(fixture.Response.Chunks), fixture.RecordedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"claude-relay-core/internal/apikey"
+	"claude-relay-core/internal/usage"
+)
+
+// runUsage 查询用量
+func runUsage(args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	opts := addCommonFlags(fs)
+	from := fs.String("from", "", "起始日期（含），格式 2006-01-02")
+	to := fs.String("to", "", "结束日期（含），格式 2006-01-02")
+	account := fs.String("account", "", "按账户过滤（账户名或ID）")
+	key := fs.String("key", "", "按API Key ID过滤")
+	model := fs.String("model", "", "按模型过滤")
+	groupBy := fs.String("group-by", "", "汇总维度: date, account, key, model, total")
+	fs.Parse(args)
+
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"from": *from, "to": *to, "account": *account, "key": *key, "model": *model, "group_by": *groupBy,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	var resp struct {
+		Records  []*usage.Record   `json:"records"`
+		Accounts map[string]string `json:"accounts"`
+		Keys     map[string]string `json:"keys"`
+	}
+	if opts.direct() {
+		var err error
+		if resp.Records, resp.Accounts, resp.Keys, err = queryUsageLocal(opts, query); err != nil {
+			return err
+		}
+	} else {
+		if err := opts.api().do("GET", "/admin/usage?"+query.Encode(), nil, &resp); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tACCOUNT\tKEY\tMODEL\tREQUESTS\tINPUT\tOUTPUT\tCACHE WRITE\tCACHE READ\tCOST")
+	var total usage.Record
+	for _, r := range resp.Records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			orDash(r.Date), nameOf(resp.Accounts, r.AccountID), nameOf(resp.Keys, r.APIKeyID), orDash(r.Model),
+			r.Requests, r.InputTokens, r.OutputTokens, r.CacheCreationInputTokens, r.CacheReadInputTokens, formatCost(r.CostUSD))
+		total.Requests += r.Requests
+		total.Tokens.Add(r.Tokens)
+		total.CostUSD += r.CostUSD
+	}
+	if len(resp.Records) > 1 {
+		fmt.Fprintf(w, "合计\t\t\t\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			total.Requests, total.InputTokens, total.OutputTokens, total.CacheCreationInputTokens, total.CacheReadInputTokens, formatCost(total.CostUSD))
+	}
+	w.Flush()
+	return nil
+}
+
+// queryUsageLocal 直接读取本地用量文件。服务运行时内存中尚未写入的用量不会包含在内
+func queryUsageLocal(opts *options, query url.Values) ([]*usage.Record, map[string]string, map[string]string, error) {
+	backend, err := opts.openLocal()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	recorder, err := usage.NewRecorder(opts.dataDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	filter := usage.Filter{
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		APIKeyID: query.Get("key"),
+		Model:    query.Get("model"),
+	}
+	if account := query.Get("account"); account != "" {
+		data, err := backend.storage.LoadOAuthData(account)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		filter.AccountID = data.ID
+	}
+
+	records := recorder.Query(filter)
+	usage.ApplyPricing(records, backend.config)
+	switch groupBy := query.Get("group_by"); groupBy {
+	case "":
+	case "total":
+		records = usage.Summarize(records, "")
+	case "date", "account", "key", "model":
+		records = usage.Summarize(records, groupBy)
+	default:
+		return nil, nil, nil, fmt.Errorf("--group-by 可选 date, account, key, model, total")
+	}
+
+	accountNames := make(map[string]string)
+	if accounts, err := backend.storage.ListAccounts(); err == nil {
+		for _, a := range accounts {
+			accountNames[a.ID] = a.Name
+		}
+	}
+	keyNames := make(map[string]string)
+	if keys, err := apikey.NewStore(opts.dataDir).List(); err == nil {
+		for _, k := range keys {
+			keyNames[k.ID] = k.Name
+		}
+	}
+	return records, accountNames, keyNames, nil
+}
+
+// formatCost 显示估算费用，未配置价格时显示 -
+func formatCost(cost float64) string {
+	if cost == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("$%.4f", cost)
+}
+
+// nameOf 将ID显示为名称，未知ID原样显示
+func nameOf(names map[string]string, id string) string {
+	if id == "" {
+		return "-"
+	}
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return id
+}
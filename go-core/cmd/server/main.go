@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"claude-relay-core/internal/api/middleware"
+	"claude-relay-core/internal/api/routes"
+	"claude-relay-core/internal/apikey"
+	"claude-relay-core/internal/audit"
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/listener"
+	"claude-relay-core/internal/logging"
+	"claude-relay-core/internal/notify"
+	"claude-relay-core/internal/oauth"
+	"claude-relay-core/internal/proxy"
+	"claude-relay-core/internal/tracing"
+	"claude-relay-core/internal/usage"
+	"claude-relay-core/internal/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 适配器类型，解决循环依赖
+type oauthClientAdapter struct {
+	client *oauth.Client
+}
+
+func (a *oauthClientAdapter) RefreshAccessToken(ctx context.Context, refreshToken string, proxyConfig *proxy.ProxyConfig) (*proxy.OAuthData, error) {
+	// 转换ProxyConfig类型
+	var oauthProxyConfig *oauth.ProxyConfig
+	if proxyConfig != nil {
+		oauthProxyConfig = &oauth.ProxyConfig{
+			Type:     proxyConfig.Type,
+			Host:     proxyConfig.Host,
+			Port:     proxyConfig.Port,
+			Username: proxyConfig.Username,
+			Password: proxyConfig.Password,
+		}
+	}
+
+	// 调用oauth client
+	oauthData, err := a.client.RefreshAccessToken(ctx, refreshToken, oauthProxyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// 转换返回类型
+	var relayProxyConfig *proxy.ProxyConfig
+	if oauthData.ProxyConfig != nil {
+		relayProxyConfig = &proxy.ProxyConfig{
+			Type:     oauthData.ProxyConfig.Type,
+			Host:     oauthData.ProxyConfig.Host,
+			Port:     oauthData.ProxyConfig.Port,
+			Username: oauthData.ProxyConfig.Username,
+			Password: oauthData.ProxyConfig.Password,
+		}
+	}
+
+	return &proxy.OAuthData{
+		AccessToken:  oauthData.AccessToken,
+		RefreshToken: oauthData.RefreshToken,
+		ExpiresAt:    oauthData.ExpiresAt,
+		Scopes:       oauthData.Scopes,
+		ProxyConfig:  relayProxyConfig,
+	}, nil
+}
+
+type storageAdapter struct {
+	storage *oauth.Storage
+}
+
+func (a *storageAdapter) LoadOAuthData(accountName string) (*proxy.OAuthData, error) {
+	oauthData, err := a.storage.LoadOAuthData(accountName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 转换类型
+	var relayProxyConfig *proxy.ProxyConfig
+	if oauthData.ProxyConfig != nil {
+		relayProxyConfig = &proxy.ProxyConfig{
+			Type:     oauthData.ProxyConfig.Type,
+			Host:     oauthData.ProxyConfig.Host,
+			Port:     oauthData.ProxyConfig.Port,
+			Username: oauthData.ProxyConfig.Username,
+			Password: oauthData.ProxyConfig.Password,
+		}
+	}
+
+	return &proxy.OAuthData{
+		ID:           oauthData.ID,
+		Name:         oauthData.Name,
+		AccessToken:  oauthData.AccessToken,
+		RefreshToken: oauthData.RefreshToken,
+		ExpiresAt:    oauthData.ExpiresAt,
+		Scopes:       oauthData.Scopes,
+		ProxyConfig:  relayProxyConfig,
+		Disabled:     oauthData.Disabled,
+		NeedsReauth:  oauthData.Quarantine != nil,
+	}, nil
+}
+
+func (a *storageAdapter) SaveOAuthData(accountName string, data *proxy.OAuthData) error {
+	// 转换类型
+	var oauthProxyConfig *oauth.ProxyConfig
+	if data.ProxyConfig != nil {
+		oauthProxyConfig = &oauth.ProxyConfig{
+			Type:     data.ProxyConfig.Type,
+			Host:     data.ProxyConfig.Host,
+			Port:     data.ProxyConfig.Port,
+			Username: data.ProxyConfig.Username,
+			Password: data.ProxyConfig.Password,
+		}
+	}
+
+	oauthData := &oauth.OAuthData{
+		AccessToken:  data.AccessToken,
+		RefreshToken: data.RefreshToken,
+		ExpiresAt:    data.ExpiresAt,
+		Scopes:       data.Scopes,
+		ProxyConfig:  oauthProxyConfig,
+	}
+
+	// 只更新token字段，保留账户元数据
+	_, err := a.storage.SaveTokens(accountName, oauthData)
+	return err
+}
+
+func (a *storageAdapter) ListAccounts() ([]*proxy.AccountSummary, error) {
+	accounts, err := a.storage.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*proxy.AccountSummary, 0, len(accounts))
+	for _, account := range accounts {
+		summaries = append(summaries, &proxy.AccountSummary{
+			ID:          account.ID,
+			Name:        account.Name,
+			Priority:    account.Priority,
+			Disabled:    !account.Enabled,
+			NeedsReauth: account.NeedsReauth,
+			TierRank:    oauth.SubscriptionRank(account.SubscriptionType),
+			LastUsedAt:  account.LastUsedAt,
+			LastErrorAt: account.LastErrorAt,
+			Tags:        account.Tags,
+			Proxy:       account.Proxy,
+		})
+	}
+	return summaries, nil
+}
+
+func (a *storageAdapter) RecordAccountUse(accountName string, useErr error) error {
+	return a.storage.RecordAccountUse(accountName, useErr)
+}
+
+func (a *storageAdapter) QuarantineAccount(accountName, reason, message string) (bool, error) {
+	_, quarantined, err := a.storage.QuarantineAccount(accountName, reason, message)
+	return quarantined, err
+}
+
+func main() {
+	// 命令行参数优先级最高：配置文件 < 环境变量 < 命令行参数
+	configFile := flag.String("config", "", "配置文件路径（YAML/TOML/JSON），默认取 CONFIG_FILE")
+	host := flag.String("host", "", "监听地址")
+	port := flag.Int("port", 0, "监听端口")
+	dataDir := flag.String("data-dir", "", "数据目录")
+	showVersion := flag.Bool("version", false, "打印版本信息后退出")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("claude-relay", version.String())
+		return
+	}
+
+	// 加载配置
+	loadOptions := config.LoadOptions{
+		File: *configFile,
+		Overrides: func(c *config.Config) {
+			if *host != "" {
+				c.Server.Host = *host
+			}
+			if *port != 0 {
+				c.Server.Port = *port
+			}
+			if *dataDir != "" {
+				c.Server.DataDir = *dataDir
+			}
+		},
+	}
+	cfg, err := config.LoadWithOptions(loadOptions)
+	if err != nil {
+		fatal("加载配置失败", err)
+	}
+
+	// 结构化日志输出到标准输出，日志级别随配置热更新
+	if err := logging.Setup(os.Stdout, cfg.Log); err != nil {
+		fatal("初始化日志失败", err)
+	}
+
+	// 链路追踪：启用时通过OTLP导出，退出前导出剩余的span
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("初始化链路追踪失败", err)
+	}
+
+	// 后台任务在HTTP服务排空后统一停止，用量记录在停止时写入
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+
+	// 创建OAuth客户端和存储
+	oauthClient := oauth.NewClient(cfg)
+	storage := oauth.NewStorage(cfg.Server.DataDir)
+
+	// 迁移旧版按账户名命名的账户文件
+	if migrated, err := storage.MigrateLegacyAccounts(); err != nil {
+		fatal("迁移旧版账户数据失败", err)
+	} else if migrated > 0 {
+		slog.Info("已迁移旧版账户", "count", migrated)
+	}
+
+	// 定期清理过期的PKCE会话
+	runWorker(func(ctx context.Context) { storage.RunPKCESweeper(ctx, cfg.OAuth.PKCESweepInterval) })
+
+	// 账户最近使用状态按间隔写入文件，停止时写入剩余部分
+	runWorker(storage.RunAccountUseFlusher)
+
+	// API Key存储与用量记录
+	keys := apikey.NewStore(cfg.Server.DataDir)
+	recorder, err := usage.NewRecorder(cfg.Server.DataDir)
+	if err != nil {
+		fatal("加载用量数据失败", err)
+	}
+	runWorker(func(ctx context.Context) { recorder.Run(ctx, cfg.Usage.FlushInterval) })
+
+	// 审计日志（可选）：每个转发请求写入一行，停止时关闭文件
+	var auditLog *audit.Logger
+	var auditRecorder proxy.AuditRecorder
+	if cfg.Audit.Enabled {
+		if auditLog, err = audit.Open(cfg.Audit); err != nil {
+			fatal("打开审计日志失败", err)
+		}
+		auditRecorder = auditLog
+		runWorker(auditLog.Run)
+		slog.Info("审计日志已启用", "dir", cfg.Audit.Dir, "include_bodies", cfg.Audit.IncludeBodies)
+	}
+
+	// 事件通知：账户和代理出现问题时推送到配置的webhook，停止时未投递的通知写入死信日志
+	notifier := notify.New(cfg.Notify)
+	runWorker(notifier.Run)
+	if webhooks := notifier.Webhooks(); len(webhooks) > 0 {
+		slog.Info("事件通知已启用", "webhooks", webhooks)
+	}
+
+	// 创建转发服务
+	relayService := proxy.NewRelayService(cfg, &oauthClientAdapter{oauthClient}, &storageAdapter{storage}, recorder, auditRecorder, notifier)
+
+	// 配置热更新：配置文件变化或收到SIGHUP时重新加载，新配置替换到转发服务和OAuth客户端
+	reloader := config.NewReloader(loadOptions, cfg)
+	reloader.OnReload(relayService.UpdateConfig)
+	reloader.OnReload(oauthClient.UpdateConfig)
+	reloader.OnReload(notifier.UpdateConfig)
+	reloader.OnReload(func(c *config.Config) { logging.SetLevel(c.Log) })
+	if auditLog != nil {
+		reloader.OnReload(auditLog.UpdateConfig)
+	}
+	runWorker(func(ctx context.Context) { reloader.Watch(ctx, cfg.Server.ConfigWatchInterval) })
+	go reloadOnSignal(reloader)
+
+	// 创建Gin路由器
+	if gin.Mode() == gin.DebugMode {
+		gin.SetMode(gin.ReleaseMode) // 设置为发布模式，减少日志输出
+	}
+
+	// 请求ID和链路追踪需在其他中间件之前，访问日志和panic日志才能带上
+	router := gin.New()
+	router.Use(middleware.RequestID(), tracing.Middleware(), middleware.Recovery())
+	if cfg.Log.AccessLog {
+		router.Use(middleware.AccessLog())
+	}
+
+	// 设置路由
+	routes.SetupRoutes(router, cfg, oauthClient, storage, relayService, keys, recorder, auditLog, notifier)
+
+	// 监听 host:port（配置证书时为HTTPS）和可选的Unix socket
+	listeners, err := listener.Listen(cfg.Server)
+	if err != nil {
+		fatal("启动服务器失败", err)
+	}
+
+	// 启动服务器
+	urls := make([]string, 0, len(listeners))
+	for _, ln := range listeners {
+		urls = append(urls, ln.URL)
+	}
+	slog.Info("Claude Relay Service 启动成功",
+		"version", version.String(),
+		"addresses", urls,
+		"messages_endpoint", listeners[0].URL+"/api/v1/messages",
+		"mtls", cfg.Server.TLS.ClientCAFile != "",
+		"config_file", reloader.File(),
+	)
+	if cfg.Auth.AdminToken == "" {
+		slog.Warn("未设置 ADMIN_TOKEN，管理接口未启用认证")
+	}
+	if cfg.Replay.Mode != config.ReplayModeOff {
+		slog.Warn("上游录制/回放已开启", "mode", cfg.Replay.Mode, "dir", cfg.Replay.Dir)
+	}
+
+	server := &http.Server{
+		Handler:  router,
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	// 收到SIGINT/SIGTERM后停止接收新请求，等待进行中的请求完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln *listener.Listener) {
+			if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("%s: %w", ln.URL, err)
+			}
+		}(ln)
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("启动服务器失败", err)
+	case <-ctx.Done():
+	}
+	stop() // 恢复默认信号处理，再次收到信号时直接退出
+
+	timeout := reloader.Current().Server.ShutdownTimeout
+	slog.Info("收到退出信号，停止接收新请求，等待进行中的请求完成", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("等待请求完成超时，强制关闭剩余连接", "error", err)
+		server.Close()
+	}
+
+	// 停止后台任务，用量记录在停止时写入存储
+	stopWorkers()
+	workers.Wait()
+
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		slog.Warn("导出剩余的链路追踪数据失败", "error", err)
+	}
+	slog.Info("服务已停止")
+}
+
+// fatal 记录错误并退出
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// reloadOnSignal 收到SIGHUP时重新加载配置
+func reloadOnSignal(reloader *config.Reloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		slog.Info("收到SIGHUP，重新加载配置")
+		reloader.Reload()
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"claude-relay-core/internal/api/middleware"
+	"claude-relay-core/internal/oauth"
+	"claude-relay-core/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler 账户管理处理器
+type AccountHandler struct {
+	storage      *oauth.Storage
+	relayService *proxy.RelayService
+}
+
+// NewAccountHandler 创建账户管理处理器
+func NewAccountHandler(storage *oauth.Storage, relayService *proxy.RelayService) *AccountHandler {
+	return &AccountHandler{
+		storage:      storage,
+		relayService: relayService,
+	}
+}
+
+// ListAccounts 列出账户
+func (h *AccountHandler) ListAccounts(c *gin.Context) {
+	accounts, err := h.storage.ListAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "获取账户列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts": accounts,
+	})
+}
+
+// GetAccountStatus 检查账户状态（支持账户名或账户ID）
+func (h *AccountHandler) GetAccountStatus(c *gin.Context) {
+	accountRef := c.Param("name")
+
+	oauthData, err := h.storage.LoadOAuthData(accountRef)
+	if err != nil {
+		h.respondStorageError(c, err, "读取账户失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account":      oauthData.Name,
+		"account_id":   oauthData.ID,
+		"is_valid":     oauthData.IsValid(),
+		"need_refresh": oauthData.NeedRefresh(),
+		"expires_at":   oauthData.ExpiresAt,
+		"scopes":       oauthData.Scopes,
+		"info":         oauthData.Info(),
+		"concurrency":  h.relayService.ConcurrencyStatus(oauthData.ID, oauthData.Name),
+		"circuit":      h.relayService.AccountCircuit(oauthData.ID),
+	})
+}
+
+// UpdateAccount 更新账户：重命名、展示名称、描述、标签、优先级、启用/禁用
+func (h *AccountHandler) UpdateAccount(c *gin.Context) {
+	accountRef := c.Param("name")
+
+	var req struct {
+		Name        *string   `json:"name,omitempty"`
+		DisplayName *string   `json:"display_name,omitempty"`
+		Description *string   `json:"description,omitempty"`
+		Tags        *[]string `json:"tags,omitempty"`
+		Priority    *int      `json:"priority,omitempty"`
+		Enabled     *bool     `json:"enabled,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+
+	if req.Name != nil {
+		if err := oauth.ValidateAccountName(*req.Name); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+	}
+
+	oauthData, err := h.storage.UpdateAccount(accountRef, func(data *oauth.OAuthData) error {
+		if req.Name != nil {
+			data.Name = *req.Name
+		}
+		if req.DisplayName != nil {
+			data.DisplayName = *req.DisplayName
+		}
+		if req.Description != nil {
+			data.Description = *req.Description
+		}
+		if req.Tags != nil {
+			data.Tags = *req.Tags
+		}
+		if req.Priority != nil {
+			data.Priority = *req.Priority
+		}
+		if req.Enabled != nil {
+			data.Disabled = !*req.Enabled
+		}
+		return nil
+	})
+	if err != nil {
+		h.respondStorageError(c, err, "更新账户失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "账户已更新",
+		"account": oauthData.Info(),
+	})
+}
+
+// DeleteAccount 删除账户并清理本地缓存状态
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	accountRef := c.Param("name")
+
+	accountID, err := h.storage.DeleteAccount(accountRef)
+	if err != nil {
+		h.respondStorageError(c, err, "删除账户失败")
+		return
+	}
+	h.relayService.ForgetAccount(accountID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "账户已删除",
+		"account":    accountRef,
+		"account_id": accountID,
+	})
+}
+
+// RefreshAccount 立即刷新账户的token
+func (h *AccountHandler) RefreshAccount(c *gin.Context) {
+	accountRef := c.Param("name")
+
+	oauthData, err := h.relayService.RefreshAccount(c.Request.Context(), accountRef)
+	if err != nil {
+		if errors.Is(err, oauth.ErrAccountNotFound) {
+			h.respondStorageError(c, err, "刷新账户失败")
+			return
+		}
+		c.JSON(http.StatusBadGateway, middleware.ErrorBody(c, "刷新token失败: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Token刷新成功",
+		"account":    accountRef,
+		"account_id": oauthData.ID,
+		"expires_at": oauthData.ExpiresAt,
+	})
+}
+
+// ReleaseAccount 解除账户隔离并关闭账户熔断（确认凭据已恢复后的管理操作）
+func (h *AccountHandler) ReleaseAccount(c *gin.Context) {
+	accountRef := c.Param("name")
+
+	oauthData, released, err := h.storage.ReleaseAccount(accountRef)
+	if err != nil {
+		h.respondStorageError(c, err, "解除隔离失败")
+		return
+	}
+	if err := h.relayService.ResetCircuit(proxy.CircuitAccount, oauthData.ID); err != nil && !errors.Is(err, proxy.ErrCircuitNotFound) {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "关闭账户熔断失败: "+err.Error()))
+		return
+	}
+
+	message := "账户已解除隔离"
+	if !released {
+		message = "账户未被隔离"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  message,
+		"released": released,
+		"account":  oauthData.Info(),
+	})
+}
+
+// ExportAccount 导出账户为Claude Code凭据格式（~/.claude/.credentials.json）
+func (h *AccountHandler) ExportAccount(c *gin.Context) {
+	oauthData, err := h.storage.LoadOAuthData(c.Param("name"))
+	if err != nil {
+		h.respondStorageError(c, err, "读取账户失败")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.credentials.json"`, oauthData.Name))
+	c.JSON(http.StatusOK, oauth.ToClaudeCredentials(oauthData))
+}
+
+// Backup 导出全部账户及其代理配置为加密备份包
+func (h *AccountHandler) Backup(c *gin.Context) {
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+	if len(req.Passphrase) < oauth.MinBackupPassphraseLength {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, fmt.Sprintf("备份口令至少需要%d个字符", oauth.MinBackupPassphraseLength)))
+		return
+	}
+
+	backup, err := h.storage.ExportBackup(req.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "导出备份失败: "+err.Error()))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="claude-relay-backup-%s.json"`, backup.CreatedAt.Format("20060102-150405")))
+	c.JSON(http.StatusOK, backup)
+}
+
+// Restore 从加密备份包恢复账户
+func (h *AccountHandler) Restore(c *gin.Context) {
+	var req struct {
+		Passphrase string        `json:"passphrase"`
+		Backup     *oauth.Backup `json:"backup"`
+		Overwrite  bool          `json:"overwrite"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Backup == nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+
+	results, err := h.storage.RestoreBackup(req.Backup, req.Passphrase, req.Overwrite)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	restored, failed := 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case oauth.RestoreStatusRestored:
+			h.relayService.ForgetAccount(result.AccountID)
+			restored++
+		case oauth.RestoreStatusFailed:
+			failed++
+		}
+	}
+
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{
+		"restored": restored,
+		"skipped":  len(results) - restored - failed,
+		"failed":   failed,
+		"results":  results,
+	})
+}
+
+// respondStorageError 将存储错误映射为HTTP响应
+func (h *AccountHandler) respondStorageError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, oauth.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "账户不存在"))
+	case errors.Is(err, oauth.ErrAccountExists):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, "目标账户名已存在"))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, message+": "+err.Error()))
+	}
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude-relay-core/internal/api/middleware"
+	"claude-relay-core/internal/apikey"
+	"claude-relay-core/internal/audit"
+	"claude-relay-core/internal/notify"
+	"claude-relay-core/internal/oauth"
+	"claude-relay-core/internal/proxy"
+	"claude-relay-core/internal/usage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler 管理接口处理器：API Key、用量统计、审计日志、代理测试、熔断状态、事件通知。配置取自转发服务当前生效的配置
+type AdminHandler struct {
+	relayService *proxy.RelayService
+	storage      *oauth.Storage
+	keys         *apikey.Store
+	recorder     *usage.Recorder
+	auditLog     *audit.Logger
+	notifier     *notify.Notifier
+}
+
+// NewAdminHandler 创建管理接口处理器，未启用审计日志时auditLog为nil
+func NewAdminHandler(relayService *proxy.RelayService, storage *oauth.Storage, keys *apikey.Store, recorder *usage.Recorder, auditLog *audit.Logger, notifier *notify.Notifier) *AdminHandler {
+	return &AdminHandler{
+		relayService: relayService,
+		storage:      storage,
+		keys:         keys,
+		recorder:     recorder,
+		auditLog:     auditLog,
+		notifier:     notifier,
+	}
+}
+
+// CreateKey 创建API Key，明文只在响应中返回一次
+func (h *AdminHandler) CreateKey(c *gin.Context) {
+	var req struct {
+		Name      string `json:"name" binding:"required"`
+		ExpiresIn string `json:"expires_in,omitempty"` // 有效期，如 720h，never表示永不过期，为空时使用配置的默认值
+		Pool      string `json:"pool,omitempty"`       // 限定调度的账户池，为空时使用配置的默认值
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+
+	cfg := h.relayService.Config()
+	ttl := cfg.APIKeys.DefaultTTL
+	switch req.ExpiresIn {
+	case "":
+	case "never":
+		ttl = 0
+	default:
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的有效期: "+req.ExpiresIn))
+			return
+		}
+	}
+
+	pool := req.Pool
+	if pool == "" {
+		pool = cfg.APIKeys.DefaultPool
+	}
+	if pool != "" && cfg.Pools[pool] == nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "账户池不存在: "+pool))
+		return
+	}
+
+	key, secret, err := h.keys.Create(req.Name, ttl, pool)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    keyView(key),
+		"secret": secret,
+	})
+}
+
+// ListKeys 列出API Key
+func (h *AdminHandler) ListKeys(c *gin.Context) {
+	keys, err := h.keys.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "获取API Key列表失败: "+err.Error()))
+		return
+	}
+
+	views := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, keyView(key))
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": views})
+}
+
+// RevokeKey 吊销API Key（支持ID或名称）
+func (h *AdminHandler) RevokeKey(c *gin.Context) {
+	key, err := h.keys.Revoke(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "吊销API Key失败: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API Key已吊销",
+		"key":     keyView(key),
+	})
+}
+
+// GetUsage 查询用量，支持 from, to, account, key, model 过滤及 group_by 汇总
+func (h *AdminHandler) GetUsage(c *gin.Context) {
+	filter := usage.Filter{
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		APIKeyID: c.Query("key"),
+		Model:    c.Query("model"),
+	}
+
+	// 账户过滤支持账户名
+	if account := c.Query("account"); account != "" {
+		oauthData, err := h.storage.LoadOAuthData(account)
+		if err != nil {
+			if errors.Is(err, oauth.ErrAccountNotFound) {
+				c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "账户不存在"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "读取账户失败: "+err.Error()))
+			return
+		}
+		filter.AccountID = oauthData.ID
+	}
+
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的日期，格式应为 2006-01-02: "+date))
+			return
+		}
+	}
+
+	records := h.recorder.Query(filter)
+	usage.ApplyPricing(records, h.relayService.Config())
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		switch groupBy {
+		case "date", "account", "key", "model", "total":
+		default:
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "group_by 可选 date, account, key, model, total"))
+			return
+		}
+		if groupBy == "total" {
+			groupBy = ""
+		}
+		records = usage.Summarize(records, groupBy)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"records":  records,
+		"accounts": h.accountNames(),
+		"keys":     h.keyNames(),
+	})
+}
+
+// 审计日志查询返回的记录数
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetAudit 查询审计日志，支持 from, to（RFC3339时间或 2006-01-02 日期）, account, key, model, status 过滤，
+// 按时间从新到旧返回最多 limit 条
+func (h *AdminHandler) GetAudit(c *gin.Context) {
+	if h.auditLog == nil {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "审计日志未启用"))
+		return
+	}
+
+	filter := audit.Filter{
+		APIKeyID: c.Query("key"),
+		Model:    c.Query("model"),
+		Limit:    defaultAuditLimit,
+	}
+
+	// 账户过滤支持账户名
+	if account := c.Query("account"); account != "" {
+		oauthData, err := h.storage.LoadOAuthData(account)
+		switch {
+		case errors.Is(err, oauth.ErrAccountNotFound):
+			// 已删除的账户仍可按ID查询
+			filter.AccountID = account
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "读取账户失败: "+err.Error()))
+			return
+		default:
+			filter.AccountID = oauthData.ID
+		}
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if filter.To, err = parseAuditTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		if filter.Status, err = strconv.Atoi(status); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的状态码: "+status))
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, fmt.Sprintf("limit 必须在1到%d之间", maxAuditLimit)))
+			return
+		}
+	}
+
+	entries, err := h.auditLog.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "查询审计日志失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// parseAuditTime 解析审计查询时间，日期作为结束时间时包含当天
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的时间，格式应为 RFC3339 或 2006-01-02: %s", value)
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// TestProxy 测试代理连通性：可传 proxy_url、proxy_name、proxy_config 或 account（测试账户绑定的代理）
+func (h *AdminHandler) TestProxy(c *gin.Context) {
+	var req struct {
+		ProxyURL    string             `json:"proxy_url,omitempty"`
+		ProxyName   string             `json:"proxy_name,omitempty"`
+		ProxyConfig *oauth.ProxyConfig `json:"proxy_config,omitempty"`
+		Account     string             `json:"account,omitempty"`
+		Target      string             `json:"target,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+
+	cfg := h.relayService.Config()
+	proxyConfig := req.ProxyConfig
+	switch {
+	case req.ProxyURL != "":
+		parsed, err := oauth.ParseProxyURL(req.ProxyURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+		proxyConfig = parsed
+	case req.ProxyName != "":
+		named, err := oauth.NamedProxy(cfg, req.ProxyName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+		proxyConfig = named
+	case req.Account != "":
+		oauthData, err := h.storage.LoadOAuthData(req.Account)
+		if err != nil {
+			if errors.Is(err, oauth.ErrAccountNotFound) {
+				c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "账户不存在"))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "读取账户失败: "+err.Error()))
+			return
+		}
+		if oauthData.ProxyConfig == nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "账户未绑定代理"))
+			return
+		}
+		proxyConfig = oauthData.ProxyConfig
+	case proxyConfig != nil:
+		if err := proxyConfig.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "需要提供 proxy_url、proxy_name、proxy_config 或 account"))
+		return
+	}
+
+	target := req.Target
+	if target == "" {
+		target = cfg.Claude.APIUrl
+	}
+
+	result, err := proxy.ProbeProxy(&proxy.ProxyConfig{
+		Type:     proxyConfig.Type,
+		Host:     proxyConfig.Host,
+		Port:     proxyConfig.Port,
+		Username: proxyConfig.Username,
+		Password: proxyConfig.Password,
+	}, target, cfg.Proxy.Timeout)
+
+	response := gin.H{
+		"proxy":              proxyConfig.String(),
+		"target":             target,
+		"ok":                 err == nil,
+		"dial_latency_ms":    result.DialLatency.Milliseconds(),
+		"request_latency_ms": result.RequestLatency.Milliseconds(),
+		"status_code":        result.StatusCode,
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCircuits 查询账户和出口的熔断状态，以及最近的状态变化
+func (h *AdminHandler) GetCircuits(c *gin.Context) {
+	circuits, events := h.relayService.Circuits()
+	if state := c.Query("state"); state != "" {
+		filtered := circuits[:0]
+		for _, circuit := range circuits {
+			if circuit.State == state {
+				filtered = append(filtered, circuit)
+			}
+		}
+		circuits = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  h.relayService.Config().Breaker.Enabled,
+		"circuits": circuits,
+		"events":   events,
+		"accounts": h.accountNames(),
+	})
+}
+
+// ResetCircuit 手动恢复熔断：kind为 account（name支持账户名或ID）或 egress（name为代理地址或 direct）
+func (h *AdminHandler) ResetCircuit(c *gin.Context) {
+	var req struct {
+		Kind string `json:"kind" binding:"required"`
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+
+	name := req.Name
+	if req.Kind == proxy.CircuitAccount {
+		if oauthData, err := h.storage.LoadOAuthData(req.Name); err == nil {
+			name = oauthData.ID
+		}
+	}
+
+	if err := h.relayService.ResetCircuit(req.Kind, name); err != nil {
+		if errors.Is(err, proxy.ErrCircuitNotFound) {
+			c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "恢复熔断失败: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "熔断已恢复",
+		"kind":    req.Kind,
+		"name":    name,
+	})
+}
+
+// 死信记录查询条数
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 1000
+)
+
+// GetDeadLetters 查询投递失败的事件通知（死信日志），按时间从新到旧
+func (h *AdminHandler) GetDeadLetters(c *gin.Context) {
+	limit := defaultDeadLetterLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxDeadLetterLimit {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, fmt.Sprintf("limit 必须在1到%d之间", maxDeadLetterLimit)))
+			return
+		}
+	}
+
+	letters, err := h.notifier.DeadLetters(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "读取死信日志失败: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": letters,
+		"count":        len(letters),
+	})
+}
+
+// TestNotification 立即向webhook发送一条测试通知，webhook为空时发送到全部webhook
+func (h *AdminHandler) TestNotification(c *gin.Context) {
+	var req struct {
+		Webhook string `json:"webhook,omitempty"`
+	}
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+			return
+		}
+	}
+	if len(h.notifier.Webhooks()) == 0 {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "未配置webhook"))
+		return
+	}
+
+	results, err := h.notifier.Test(c.Request.Context(), req.Webhook)
+	if err != nil {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	response := make([]gin.H, 0, len(results))
+	delivered := 0
+	for _, name := range h.notifier.Webhooks() {
+		result, ok := results[name]
+		if !ok {
+			continue
+		}
+		item := gin.H{"webhook": name, "delivered": result == nil}
+		if result != nil {
+			item["error"] = result.Error()
+		} else {
+			delivered++
+		}
+		response = append(response, item)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   response,
+		"delivered": delivered,
+		"failed":    len(response) - delivered,
+	})
+}
+
+// accountNames 账户ID到账户名的映射，用于展示用量
+func (h *AdminHandler) accountNames() map[string]string {
+	names := make(map[string]string)
+	accounts, err := h.storage.ListAccounts()
+	if err != nil {
+		return names
+	}
+	for _, account := range accounts {
+		names[account.ID] = account.Name
+	}
+	return names
+}
+
+// keyNames API Key ID到名称的映射，用于展示用量
+func (h *AdminHandler) keyNames() map[string]string {
+	names := make(map[string]string)
+	keys, err := h.keys.List()
+	if err != nil {
+		return names
+	}
+	for _, key := range keys {
+		names[key.ID] = key.Name
+	}
+	return names
+}
+
+// keyView API Key的展示信息（不含哈希）
+func keyView(key *apikey.Key) gin.H {
+	return gin.H{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"pool":         key.Pool,
+		"status":       key.Status(),
+		"created_at":   key.CreatedAt,
+		"expires_at":   key.ExpiresAt,
+		"revoked_at":   key.RevokedAt,
+		"last_used_at": key.LastUsedAt,
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"claude-relay-core/internal/health"
+	"claude-relay-core/internal/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout 就绪检查的最长耗时
+const readinessTimeout = 5 * time.Second
+
+// HealthHandler 存活、就绪和健康详情接口
+type HealthHandler struct {
+	checker *health.Checker
+	started time.Time
+}
+
+// NewHealthHandler 创建健康检查处理器
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+		started: time.Now(),
+	}
+}
+
+// Liveness 存活检查：进程能处理请求即返回200
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"service": "claude-relay-service",
+		"version": version.Get().Version,
+	})
+}
+
+// Readiness 就绪检查：存储可读、至少一个账户可用、正在使用的代理可连接时返回200，否则返回503。
+// 只返回各组件的状态，详情见 /health/details
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.check(c)
+
+	components := make(gin.H, len(report.Components))
+	for _, component := range report.Components {
+		components[component.Name] = component.Status
+	}
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"status":     report.Status,
+		"components": components,
+	})
+}
+
+// Details 健康详情（管理接口）：各组件的检查结果、版本和运行信息
+func (h *HealthHandler) Details(c *gin.Context) {
+	report := h.check(c)
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"status":     report.Status,
+		"components": report.Components,
+		"version":    version.Get(),
+		"started_at": h.started,
+		"uptime":     time.Since(h.started).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+	})
+}
+
+func (h *HealthHandler) check(c *gin.Context) *health.Report {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+	return h.checker.Check(ctx)
+}
@@ -1,51 +1,101 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
 	"net/http"
 
+	"claude-relay-core/internal/api/middleware"
 	"claude-relay-core/internal/config"
 	"claude-relay-core/internal/oauth"
 
 	"github.com/gin-gonic/gin"
 )
 
-// OAuthHandler OAuth处理器
+// OAuthHandler OAuth处理器，配置取自OAuth客户端当前生效的配置
 type OAuthHandler struct {
-	config      *config.Config
 	oauthClient *oauth.Client
 	storage     *oauth.Storage
 }
 
 // NewOAuthHandler 创建OAuth处理器
-func NewOAuthHandler(cfg *config.Config, oauthClient *oauth.Client, storage *oauth.Storage) *OAuthHandler {
+func NewOAuthHandler(oauthClient *oauth.Client, storage *oauth.Storage) *OAuthHandler {
 	return &OAuthHandler{
-		config:      cfg,
 		oauthClient: oauthClient,
 		storage:     storage,
 	}
 }
 
+// httpError 带HTTP状态码的错误
+type httpError struct {
+	status  int
+	message string
+}
+
 // GenerateAuthURL 生成OAuth授权URL
 func (h *OAuthHandler) GenerateAuthURL(c *gin.Context) {
 	var req struct {
-		ProxyConfig *oauth.ProxyConfig `json:"proxy_config,omitempty"`
+		ProxyConfig  *oauth.ProxyConfig `json:"proxy_config,omitempty"`
+		ProxyName    string             `json:"proxy_name,omitempty"`
+		CallbackMode string             `json:"callback_mode,omitempty"`
+		AccountName  string             `json:"account_name,omitempty"`
+		DisplayName  string             `json:"display_name,omitempty"`
 	}
-	
+
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
+		return
+	}
+
+	proxyConfig, err := h.requestProxy(req.ProxyConfig, req.ProxyName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	// 回调模式：manual需要手动复制授权码，loopback由本服务的回调路由自动完成token交换
+	cfg := h.oauthClient.Config()
+	callbackMode := req.CallbackMode
+	if callbackMode == "" {
+		callbackMode = cfg.OAuth.CallbackMode
+	}
+	redirectURI := cfg.OAuth.RedirectURI
+	switch callbackMode {
+	case config.CallbackModeManual:
+	case config.CallbackModeLoopback:
+		redirectURI = cfg.OAuth.LoopbackRedirectURI
+	default:
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的callback_mode: "+callbackMode))
 		return
 	}
 
+	// loopback模式下回调请求不带请求体，账户名必须在此时确定
+	if req.AccountName != "" || callbackMode == config.CallbackModeLoopback {
+		if err := oauth.ValidateAccountName(req.AccountName); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+	}
+
 	// 生成OAuth参数
-	pkceData, err := oauth.GenerateOAuthParams(h.config)
+	pkceData, err := oauth.GenerateOAuthParams(cfg, redirectURI)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成OAuth参数失败"})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "生成OAuth参数失败"))
 		return
 	}
 
+	// 记录本次授权选择的代理和账户，token交换时沿用
+	pkceData.ProxyConfig = proxyConfig
+	pkceData.AccountName = req.AccountName
+	pkceData.DisplayName = req.DisplayName
+
 	// 保存PKCE数据
 	if err := h.storage.SavePKCEData(pkceData.State, pkceData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存PKCE数据失败"})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "保存PKCE数据失败"))
 		return
 	}
 
@@ -53,87 +103,280 @@ func (h *OAuthHandler) GenerateAuthURL(c *gin.Context) {
 		"auth_url":       pkceData.AuthURL,
 		"state":          pkceData.State,
 		"code_challenge": pkceData.CodeChallenge,
+		"expires_at":     pkceData.ExpiresAt,
+		"proxy":          pkceData.ProxyConfig.String(),
+		"callback_mode":  callbackMode,
+		"redirect_uri":   pkceData.RedirectURI,
 	})
 }
 
 // ExchangeToken 交换授权码获取token
 func (h *OAuthHandler) ExchangeToken(c *gin.Context) {
 	var req struct {
-		AuthorizationCode string               `json:"authorization_code"`
-		State             string               `json:"state"`
-		AccountName       string               `json:"account_name"`
-		ProxyConfig       *oauth.ProxyConfig   `json:"proxy_config,omitempty"`
+		AuthorizationCode string             `json:"authorization_code"`
+		State             string             `json:"state"`
+		AccountName       string             `json:"account_name"`
+		DisplayName       string             `json:"display_name,omitempty"`
+		ProxyConfig       *oauth.ProxyConfig `json:"proxy_config,omitempty"`
 	}
-	
+
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
 		return
 	}
 
 	// 加载PKCE数据
-	pkceData, err := h.storage.LoadPKCEData(req.State)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的state参数"})
+	pkceData, herr := h.loadPKCE(req.State)
+	if herr != nil {
+		c.JSON(herr.status, middleware.ErrorBody(c, herr.message))
 		return
 	}
 
-	// 交换token
-	oauthData, err := h.oauthClient.ExchangeCodeForToken(
-		req.AuthorizationCode,
-		pkceData.CodeVerifier,
-		req.State,
-		req.ProxyConfig,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "token交换失败: " + err.Error()})
-		return
+	// 未传账户名时沿用生成授权URL时指定的账户名
+	if req.AccountName == "" {
+		req.AccountName = pkceData.AccountName
+	}
+	if req.DisplayName == "" {
+		req.DisplayName = pkceData.DisplayName
 	}
 
-	// 保存OAuth数据
-	if err := h.storage.SaveOAuthData(req.AccountName, oauthData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存OAuth数据失败"})
+	// 校验账户名（slug规则），避免生成不安全或重复的账户标识
+	if err := oauth.ValidateAccountName(req.AccountName); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
-	// 清理PKCE临时数据
-	h.storage.DeletePKCEData(req.State)
+	// 优先沿用生成授权URL时选择的代理；旧客户端只在交换时传代理的情况仍然兼容
+	proxyConfig := pkceData.ProxyConfig
+	if req.ProxyConfig != nil {
+		if proxyConfig != nil && !proxyConfig.Equal(req.ProxyConfig) {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "proxy_config与生成授权URL时选择的代理不一致，授权与后续请求必须使用同一出口"))
+			return
+		}
+		if err := req.ProxyConfig.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的代理配置: "+err.Error()))
+			return
+		}
+		proxyConfig = req.ProxyConfig
+	}
+
+	account, herr := h.completeExchange(c.Request.Context(), pkceData, req.AuthorizationCode, req.AccountName, req.DisplayName, proxyConfig)
+	if herr != nil {
+		c.JSON(herr.status, middleware.ErrorBody(c, herr.message))
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "OAuth认证成功",
-		"account":    req.AccountName,
-		"expires_at": oauthData.ExpiresAt,
-		"scopes":     oauthData.Scopes,
+		"account":    account.Name,
+		"account_id": account.ID,
+		"expires_at": account.ExpiresAt,
+		"scopes":     account.Scopes,
+		"proxy":      account.ProxyConfig.String(),
+		"profile":    account.Profile,
 	})
 }
 
-// ListAccounts 列出账户
-func (h *OAuthHandler) ListAccounts(c *gin.Context) {
-	accounts, err := h.storage.ListAccounts()
+// RefreshProfile 重新读取账户资料（邮箱、组织、订阅类型）
+func (h *OAuthHandler) RefreshProfile(c *gin.Context) {
+	account, err := oauth.UpdateProfile(c.Request.Context(), h.oauthClient, h.storage, c.Param("name"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取账户列表失败"})
+		if errors.Is(err, oauth.ErrAccountNotFound) {
+			c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "账户不存在"))
+			return
+		}
+		c.JSON(http.StatusBadGateway, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"accounts": accounts,
+		"account":    account.Name,
+		"account_id": account.ID,
+		"profile":    account.Profile,
 	})
 }
 
-// GetAccountStatus 检查账户状态
-func (h *OAuthHandler) GetAccountStatus(c *gin.Context) {
-	accountName := c.Param("name")
-	
-	oauthData, err := h.storage.LoadOAuthData(accountName)
+// callbackPage loopback回调结果页面
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head><meta charset="utf-8"><title>Claude Relay Service</title></head>
+<body style="font-family: sans-serif; margin: 4em auto; max-width: 40em;">
+{{if .Error}}
+<h2>❌ 授权失败</h2>
+<p>{{.Error}}</p>
+{{else}}
+<h2>✅ 授权成功</h2>
+<p>账户 <b>{{.Account}}</b>（{{.AccountID}}）已完成认证，可以关闭此页面。</p>
+{{end}}
+</body>
+</html>
+`))
+
+// Callback loopback回调：接收授权服务器重定向带回的code和state并自动完成token交换
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	render := func(status int, data gin.H) {
+		c.Status(status)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		callbackPage.Execute(c.Writer, data)
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		render(http.StatusBadRequest, gin.H{"Error": errCode + ": " + c.Query("error_description")})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		render(http.StatusBadRequest, gin.H{"Error": "回调缺少code或state参数"})
+		return
+	}
+
+	pkceData, herr := h.loadPKCE(state)
+	if herr != nil {
+		render(herr.status, gin.H{"Error": herr.message})
+		return
+	}
+	if pkceData.AccountName == "" {
+		render(http.StatusBadRequest, gin.H{"Error": "该授权会话未指定账户名，请使用 POST /oauth/token 手动完成交换"})
+		return
+	}
+
+	account, herr := h.completeExchange(c.Request.Context(), pkceData, code, pkceData.AccountName, pkceData.DisplayName, pkceData.ProxyConfig)
+	if herr != nil {
+		render(herr.status, gin.H{"Error": herr.message})
+		return
+	}
+
+	render(http.StatusOK, gin.H{"Account": account.Name, "AccountID": account.ID})
+}
+
+// loadPKCE 加载PKCE会话并将错误映射为HTTP错误
+func (h *OAuthHandler) loadPKCE(state string) (*oauth.PKCEData, *httpError) {
+	pkceData, err := h.storage.LoadPKCEData(state)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "账户不存在"})
+		switch {
+		case errors.Is(err, oauth.ErrPKCEExpired):
+			return nil, &httpError{http.StatusBadRequest, "授权会话已过期，请重新调用 POST /oauth/auth-url 生成授权URL"}
+		case errors.Is(err, oauth.ErrPKCENotFound):
+			return nil, &httpError{http.StatusBadRequest, "无效的state参数"}
+		default:
+			return nil, &httpError{http.StatusInternalServerError, "读取PKCE数据失败"}
+		}
+	}
+	return pkceData, nil
+}
+
+// completeExchange 交换授权码、保存账户并清理PKCE会话
+func (h *OAuthHandler) completeExchange(ctx context.Context, pkceData *oauth.PKCEData, code, accountName, displayName string, proxyConfig *oauth.ProxyConfig) (*oauth.OAuthData, *httpError) {
+	// 交换token
+	oauthData, err := h.oauthClient.ExchangeCodeForToken(ctx, code, pkceData, proxyConfig)
+	if err != nil {
+		return nil, &httpError{http.StatusInternalServerError, "token交换失败: " + err.Error()}
+	}
+
+	// 保存OAuth数据（重新认证已有账户时保留其元数据）
+	account, err := h.storage.SaveTokens(accountName, oauthData)
+	if err != nil {
+		return nil, &httpError{http.StatusInternalServerError, "保存OAuth数据失败"}
+	}
+
+	if displayName != "" {
+		account, err = h.storage.UpdateAccount(account.ID, func(data *oauth.OAuthData) error {
+			data.DisplayName = displayName
+			return nil
+		})
+		if err != nil {
+			return nil, &httpError{http.StatusInternalServerError, "保存账户展示名称失败"}
+		}
+	}
+
+	// 清理PKCE临时数据
+	h.storage.DeletePKCEData(pkceData.State)
+
+	// 读取账户资料（邮箱、组织、订阅类型），失败不影响登录
+	if updated, err := oauth.UpdateProfile(ctx, h.oauthClient, h.storage, account.ID); err != nil {
+		slog.WarnContext(ctx, "读取账户资料失败", "account", account.Name, "error", err)
+	} else {
+		account = updated
+	}
+
+	return account, nil
+}
+
+// importItem 单个待导入的Claude Code凭据
+type importItem struct {
+	AccountName string             `json:"account_name"`
+	Credentials json.RawMessage    `json:"credentials"`
+	ProxyConfig *oauth.ProxyConfig `json:"proxy_config,omitempty"`
+	ProxyName   string             `json:"proxy_name,omitempty"`
+}
+
+// ImportAccounts 导入Claude Code CLI凭据，支持单个或批量导入
+func (h *OAuthHandler) ImportAccounts(c *gin.Context) {
+	var req struct {
+		importItem
+		Accounts []importItem `json:"accounts,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的请求参数"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"account":      accountName,
-		"is_valid":     oauthData.IsValid(),
-		"need_refresh": oauthData.NeedRefresh(),
-		"expires_at":   oauthData.ExpiresAt,
-		"scopes":       oauthData.Scopes,
+	items := req.Accounts
+	if req.AccountName != "" || len(req.Credentials) > 0 {
+		items = append([]importItem{req.importItem}, items...)
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "缺少要导入的凭据"))
+		return
+	}
+
+	results := make([]*oauth.ImportResult, 0, len(items))
+	failed := 0
+	for _, item := range items {
+		proxyConfig, err := h.requestProxy(item.ProxyConfig, item.ProxyName)
+		if err != nil {
+			results = append(results, &oauth.ImportResult{AccountName: item.AccountName, Error: err.Error()})
+			failed++
+			continue
+		}
+
+		result, err := oauth.ImportClaudeCredentials(c.Request.Context(), h.oauthClient, h.storage, item.AccountName, item.Credentials, proxyConfig)
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	switch {
+	case failed == len(items):
+		status = http.StatusUnprocessableEntity
+	case failed > 0:
+		status = http.StatusMultiStatus
+	}
+
+	c.JSON(status, gin.H{
+		"imported": len(items) - failed,
+		"failed":   failed,
+		"results":  results,
 	})
-}
\ No newline at end of file
+}
+
+// requestProxy 解析请求中的代理：proxy_config 与 proxy_name（配置文件中的命名代理）二选一
+func (h *OAuthHandler) requestProxy(proxyConfig *oauth.ProxyConfig, proxyName string) (*oauth.ProxyConfig, error) {
+	if proxyName != "" {
+		if proxyConfig != nil {
+			return nil, fmt.Errorf("proxy_config 与 proxy_name 不能同时指定")
+		}
+		return oauth.NamedProxy(h.oauthClient.Config(), proxyName)
+	}
+	if proxyConfig != nil {
+		if err := proxyConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("无效的代理配置: %w", err)
+		}
+	}
+	return proxyConfig, nil
+}
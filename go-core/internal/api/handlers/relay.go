@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
 
+	"claude-relay-core/internal/api/middleware"
 	"claude-relay-core/internal/proxy"
 
 	"github.com/gin-gonic/gin"
@@ -22,27 +24,53 @@ func NewRelayHandler(relayService *proxy.RelayService) *RelayHandler {
 
 // ProcessMessages Claude API消息转发
 func (h *RelayHandler) ProcessMessages(c *gin.Context) {
-	// 获取账户名（从查询参数或头部）
+	// 获取账户名（从查询参数或头部），未指定时由调度器选择
 	accountName := c.Query("account")
 	if accountName == "" {
 		accountName = c.GetHeader("X-Account-Name")
 	}
-	if accountName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少账户名参数 (account 或 X-Account-Name)"})
-		return
-	}
 
 	// 解析请求体
 	var requestData interface{}
 	if err := c.ShouldBindJSON(&requestData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的JSON请求体"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "无效的JSON请求体"))
 		return
 	}
 
-	// 处理请求
-	responseData, err := h.relayService.ProcessRequest(accountName, requestData)
+	// 账户池（从查询参数或头部），API Key绑定了账户池时只能使用该账户池
+	opts := proxy.RequestOptions{Account: accountName, Pool: c.Query("pool"), ClientIP: c.ClientIP()}
+	if opts.Pool == "" {
+		opts.Pool = c.GetHeader("X-Account-Pool")
+	}
+
+	// 用量归属到当前请求的API Key（如有）
+	if key := middleware.CurrentAPIKey(c); key != nil {
+		opts.APIKeyID = key.ID
+		if key.Pool != "" {
+			if opts.Pool != "" && opts.Pool != key.Pool {
+				c.JSON(http.StatusForbidden, middleware.ErrorBody(c, "API Key只能使用账户池: "+key.Pool))
+				return
+			}
+			opts.Pool = key.Pool
+		}
+	}
+
+	// 处理请求，流式响应由转发服务直接写入
+	responseData, err := h.relayService.ProcessRequest(c.Request.Context(), opts, requestData, c.Writer)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.WarnContext(c.Request.Context(), "转发请求失败", "account", opts.Account, "pool", opts.Pool, "error", err)
+		if c.Writer.Written() {
+			return
+		}
+		// 限流、过载和请求本身的错误原样返回上游的响应体
+		if status, body, ok := proxy.Passthrough(err); ok {
+			c.Data(status, "application/json", body)
+			return
+		}
+		c.JSON(proxy.ErrorStatus(err), middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if c.Writer.Written() {
 		return
 	}
 
@@ -56,17 +84,17 @@ func (h *RelayHandler) GetModels(c *gin.Context) {
 		"object": "list",
 		"data": []gin.H{
 			{
-				"id":      "claude-3-5-sonnet-20241022",
-				"object":  "model",
-				"created": 1234567890,
+				"id":       "claude-3-5-sonnet-20241022",
+				"object":   "model",
+				"created":  1234567890,
 				"owned_by": "anthropic",
 			},
 			{
-				"id":      "claude-3-5-haiku-20241022",
-				"object":  "model",
-				"created": 1234567890,
+				"id":       "claude-3-5-haiku-20241022",
+				"object":   "model",
+				"created":  1234567890,
 				"owned_by": "anthropic",
 			},
 		},
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"claude-relay-core/internal/apikey"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyContextKey gin上下文中保存已认证API Key的键
+const APIKeyContextKey = "api_key"
+
+// AdminAuth 管理接口认证：配置了管理令牌时要求请求携带
+// Authorization: Bearer <token> 或 X-Admin-Token: <token>，未配置时不做限制
+func AdminAuth(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.Next()
+			return
+		}
+
+		token := c.GetHeader("X-Admin-Token")
+		if token == "" {
+			token = bearerToken(c)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "缺少或无效的管理令牌"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdminToken 导出凭据等高危接口要求服务配置了管理令牌，未配置时一律返回403，
+// 避免默认监听 0.0.0.0 时任何人都能取走账户凭据。令牌本身由 AdminAuth 校验
+func RequireAdminToken(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorBody(c, "未配置管理令牌，已禁止导出和恢复账户凭据，请设置 ADMIN_TOKEN 后重试"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// APIKeyAuth API转发认证：从 x-api-key 或 Authorization: Bearer 读取API Key。
+// required为true时必须携带有效的API Key；为false时有效的Key用于用量统计，缺失或无法识别的Key被忽略
+func APIKeyAuth(store *apikey.Store, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader("x-api-key")
+		if secret == "" {
+			secret = bearerToken(c)
+		}
+
+		if secret == "" {
+			if required {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorBody(c, "缺少API Key (x-api-key 或 Authorization: Bearer)"))
+				return
+			}
+			c.Next()
+			return
+		}
+
+		key, err := store.Authenticate(secret)
+		if err != nil {
+			if !required {
+				c.Next()
+				return
+			}
+
+			status := http.StatusUnauthorized
+			if !errors.Is(err, apikey.ErrKeyInvalid) && !errors.Is(err, apikey.ErrKeyRevoked) && !errors.Is(err, apikey.ErrKeyExpired) {
+				status = http.StatusInternalServerError
+			}
+			c.AbortWithStatusJSON(status, ErrorBody(c, err.Error()))
+			return
+		}
+
+		c.Set(APIKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// CurrentAPIKey 返回当前请求已认证的API Key，没有时返回nil
+func CurrentAPIKey(c *gin.Context) *apikey.Key {
+	if value, ok := c.Get(APIKeyContextKey); ok {
+		if key, ok := value.(*apikey.Key); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// bearerToken 读取 Authorization: Bearer 令牌
+func bearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
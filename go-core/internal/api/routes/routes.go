@@ -2,43 +2,83 @@ package routes
 
 import (
 	"net/http"
+	"net/url"
 
 	"claude-relay-core/internal/api/handlers"
+	"claude-relay-core/internal/api/middleware"
+	"claude-relay-core/internal/apikey"
+	"claude-relay-core/internal/audit"
 	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/health"
+	"claude-relay-core/internal/metrics"
+	"claude-relay-core/internal/notify"
 	"claude-relay-core/internal/oauth"
 	"claude-relay-core/internal/proxy"
+	"claude-relay-core/internal/usage"
+	"claude-relay-core/internal/version"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes 设置所有路由
-func SetupRoutes(router *gin.Engine, cfg *config.Config, oauthClient *oauth.Client, storage *oauth.Storage, relayService *proxy.RelayService) {
+func SetupRoutes(router *gin.Engine, cfg *config.Config, oauthClient *oauth.Client, storage *oauth.Storage, relayService *proxy.RelayService, keys *apikey.Store, recorder *usage.Recorder, auditLog *audit.Logger, notifier *notify.Notifier) {
 	// 创建处理器
-	oauthHandler := handlers.NewOAuthHandler(cfg, oauthClient, storage)
+	oauthHandler := handlers.NewOAuthHandler(oauthClient, storage)
+	accountHandler := handlers.NewAccountHandler(storage, relayService)
+	adminHandler := handlers.NewAdminHandler(relayService, storage, keys, recorder, auditLog, notifier)
 	relayHandler := handlers.NewRelayHandler(relayService)
+	healthHandler := handlers.NewHealthHandler(health.NewChecker(relayService.Config, storage))
 
-	// 健康检查
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "claude-relay-service",
-			"version": "1.0.0-mvp",
-		})
-	})
+	adminAuth := middleware.AdminAuth(cfg.Auth.AdminToken)
+
+	// Prometheus监控，中间件需在注册路由前添加
+	setupMetricsRoute(router, cfg, adminAuth)
+
+	// 健康检查：存活、就绪和健康详情（管理接口），/health 保留为存活检查
+	setupHealthRoutes(router, adminAuth, healthHandler)
 
 	// OAuth管理路由组
-	setupOAuthRoutes(router, oauthHandler)
+	setupOAuthRoutes(router, adminAuth, middleware.RequireAdminToken(cfg.Auth.AdminToken), oauthHandler, accountHandler)
+
+	// 管理路由组：API Key、用量、审计日志、代理测试、熔断、事件通知
+	setupAdminRoutes(router, adminAuth, adminHandler)
+
+	// loopback模式的OAuth回调路由，路径取自配置的回调地址
+	setupCallbackRoute(router, cfg, oauthHandler)
 
 	// API转发路由组
-	setupAPIRoutes(router, relayHandler)
+	setupAPIRoutes(router, middleware.APIKeyAuth(keys, cfg.Auth.RequireAPIKey), relayHandler)
 
 	// 根路径信息
-	setupRootRoute(router)
+	setupRootRoute(router, cfg)
+}
+
+// setupMetricsRoute 统计所有HTTP请求并注册抓取接口
+func setupMetricsRoute(router *gin.Engine, cfg *config.Config, auth gin.HandlerFunc) {
+	if !cfg.Metrics.Enabled {
+		return
+	}
+
+	router.Use(metrics.Middleware())
+	if cfg.Metrics.RequireAuth {
+		router.GET(cfg.Metrics.Path, auth, metrics.Handler())
+	} else {
+		router.GET(cfg.Metrics.Path, metrics.Handler())
+	}
+}
+
+// setupHealthRoutes 设置健康检查路由
+func setupHealthRoutes(router *gin.Engine, auth gin.HandlerFunc, handler *handlers.HealthHandler) {
+	router.GET("/health", handler.Liveness)
+	router.GET("/healthz", handler.Liveness)
+	router.GET("/readyz", handler.Readiness)
+	router.GET("/health/details", auth, handler.Details)
 }
 
 // setupOAuthRoutes 设置OAuth相关路由
-func setupOAuthRoutes(router *gin.Engine, handler *handlers.OAuthHandler) {
-	oauthGroup := router.Group("/oauth")
+// 导出、备份和恢复会交出或写入账户凭据，未配置管理令牌时由requireToken拒绝
+func setupOAuthRoutes(router *gin.Engine, auth, requireToken gin.HandlerFunc, handler *handlers.OAuthHandler, accountHandler *handlers.AccountHandler) {
+	oauthGroup := router.Group("/oauth", auth)
 	{
 		// 生成OAuth授权URL
 		oauthGroup.POST("/auth-url", handler.GenerateAuthURL)
@@ -47,16 +87,78 @@ func setupOAuthRoutes(router *gin.Engine, handler *handlers.OAuthHandler) {
 		oauthGroup.POST("/token", handler.ExchangeToken)
 
 		// 列出账户
-		oauthGroup.GET("/accounts", handler.ListAccounts)
+		oauthGroup.GET("/accounts", accountHandler.ListAccounts)
+
+		// 导入Claude Code CLI凭据（支持批量）
+		oauthGroup.POST("/accounts/import", handler.ImportAccounts)
 
 		// 检查账户状态
-		oauthGroup.GET("/accounts/:name/status", handler.GetAccountStatus)
+		oauthGroup.GET("/accounts/:name/status", accountHandler.GetAccountStatus)
+
+		// 更新账户（重命名、描述、标签、优先级、启用/禁用）
+		oauthGroup.PATCH("/accounts/:name", accountHandler.UpdateAccount)
+
+		// 删除账户
+		oauthGroup.DELETE("/accounts/:name", accountHandler.DeleteAccount)
+
+		// 立即刷新账户token
+		oauthGroup.POST("/accounts/:name/refresh", accountHandler.RefreshAccount)
+
+		// 解除账户隔离（凭据失效的账户重新授权前不参与调度）
+		oauthGroup.DELETE("/accounts/:name/quarantine", accountHandler.ReleaseAccount)
+
+		// 重新读取账户资料（邮箱、组织、订阅类型）
+		oauthGroup.POST("/accounts/:name/profile", handler.RefreshProfile)
+
+		// 导出账户为Claude Code凭据格式
+		oauthGroup.GET("/accounts/:name/export", requireToken, accountHandler.ExportAccount)
+
+		// 加密备份与恢复全部账户
+		oauthGroup.POST("/backup", requireToken, accountHandler.Backup)
+		oauthGroup.POST("/restore", requireToken, accountHandler.Restore)
+	}
+}
+
+// setupAdminRoutes 设置管理相关路由
+func setupAdminRoutes(router *gin.Engine, auth gin.HandlerFunc, handler *handlers.AdminHandler) {
+	adminGroup := router.Group("/admin", auth)
+	{
+		// API Key管理
+		adminGroup.POST("/keys", handler.CreateKey)
+		adminGroup.GET("/keys", handler.ListKeys)
+		adminGroup.DELETE("/keys/:id", handler.RevokeKey)
+
+		// 用量查询
+		adminGroup.GET("/usage", handler.GetUsage)
+
+		// 审计日志查询
+		adminGroup.GET("/audit", handler.GetAudit)
+
+		// 代理连通性测试
+		adminGroup.POST("/proxy/test", handler.TestProxy)
+
+		// 熔断状态查询与手动恢复
+		adminGroup.GET("/circuits", handler.GetCircuits)
+		adminGroup.POST("/circuits/reset", handler.ResetCircuit)
+
+		// 事件通知：死信日志查询和测试通知
+		adminGroup.GET("/notifications/dead-letters", handler.GetDeadLetters)
+		adminGroup.POST("/notifications/test", handler.TestNotification)
+	}
+}
+
+// setupCallbackRoute 设置loopback回调路由
+func setupCallbackRoute(router *gin.Engine, cfg *config.Config, handler *handlers.OAuthHandler) {
+	callbackURL, err := url.Parse(cfg.OAuth.LoopbackRedirectURI)
+	if err != nil || callbackURL.Path == "" {
+		return
 	}
+	router.GET(callbackURL.Path, handler.Callback)
 }
 
 // setupAPIRoutes 设置API转发相关路由
-func setupAPIRoutes(router *gin.Engine, handler *handlers.RelayHandler) {
-	apiGroup := router.Group("/api/v1")
+func setupAPIRoutes(router *gin.Engine, auth gin.HandlerFunc, handler *handlers.RelayHandler) {
+	apiGroup := router.Group("/api/v1", auth)
 	{
 		// Claude API消息转发
 		apiGroup.POST("/messages", handler.ProcessMessages)
@@ -67,17 +169,38 @@ func setupAPIRoutes(router *gin.Engine, handler *handlers.RelayHandler) {
 }
 
 // setupRootRoute 设置根路径路由
-func setupRootRoute(router *gin.Engine) {
+func setupRootRoute(router *gin.Engine, cfg *config.Config) {
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"service":     "Claude Relay Service MVP",
-			"version":     "1.0.0-mvp",
+			"version":     version.Get().Version,
 			"description": "Claude Code OAuth认证 + 请求转发服务",
 			"endpoints": gin.H{
-				"health":         "GET /health",
+				"health":         "GET /healthz",
+				"readiness":      "GET /readyz",
+				"health_details": "GET /health/details",
 				"oauth_auth_url": "POST /oauth/auth-url",
 				"oauth_token":    "POST /oauth/token", 
+				"oauth_callback": "GET " + cfg.OAuth.LoopbackRedirectURI,
 				"oauth_accounts": "GET /oauth/accounts",
+				"oauth_account_import": "POST /oauth/accounts/import",
+				"oauth_account_update": "PATCH /oauth/accounts/:name",
+				"oauth_account_delete": "DELETE /oauth/accounts/:name",
+				"oauth_account_refresh": "POST /oauth/accounts/:name/refresh",
+				"oauth_account_release": "DELETE /oauth/accounts/:name/quarantine",
+				"oauth_account_profile": "POST /oauth/accounts/:name/profile",
+				"oauth_account_export": "GET /oauth/accounts/:name/export",
+				"oauth_backup":         "POST /oauth/backup",
+				"oauth_restore":        "POST /oauth/restore",
+				"admin_keys":           "GET|POST /admin/keys",
+				"admin_key_revoke":     "DELETE /admin/keys/:id",
+				"admin_usage":          "GET /admin/usage",
+				"admin_audit":          "GET /admin/audit",
+				"admin_proxy_test":     "POST /admin/proxy/test",
+				"admin_circuits":       "GET /admin/circuits",
+				"admin_circuit_reset":  "POST /admin/circuits/reset",
+				"admin_dead_letters":   "GET /admin/notifications/dead-letters",
+				"admin_notify_test":    "POST /admin/notifications/test",
 				"api_messages":   "POST /api/v1/messages",
 				"api_models":     "GET /api/v1/models",
 			},
@@ -85,7 +208,7 @@ func setupRootRoute(router *gin.Engine) {
 				"1": "首先调用 POST /oauth/auth-url 生成授权URL",
 				"2": "访问授权URL完成Claude Code认证",
 				"3": "使用授权码调用 POST /oauth/token 完成认证",
-				"4": "使用 POST /api/v1/messages?account=账户名 转发请求",
+				"4": "使用 POST /api/v1/messages 转发请求，可用 ?account=账户名 指定账户，未指定时自动调度",
 			},
 		})
 	})
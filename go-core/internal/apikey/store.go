@@ -0,0 +1,290 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keyPrefix API Key明文前缀
+	keyPrefix = "cr_"
+	// lastUsedPersistInterval 最近使用时间的持久化间隔，避免每个请求都写文件
+	lastUsedPersistInterval = time.Minute
+)
+
+var (
+	// ErrKeyNotFound API Key不存在
+	ErrKeyNotFound = errors.New("API Key不存在")
+	// ErrKeyInvalid API Key无效
+	ErrKeyInvalid = errors.New("无效的API Key")
+	// ErrKeyRevoked API Key已吊销
+	ErrKeyRevoked = errors.New("API Key已吊销")
+	// ErrKeyExpired API Key已过期
+	ErrKeyExpired = errors.New("API Key已过期")
+)
+
+// Key API Key信息（只保存明文的哈希）
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 明文前若干位，便于识别
+	Hash       string     `json:"hash"`
+	Pool       string     `json:"pool,omitempty"` // 限定调度的账户池，为空表示不限制
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Status 返回API Key状态: active, revoked, expired
+func (k *Key) Status() string {
+	switch {
+	case k.RevokedAt != nil:
+		return "revoked"
+	case k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// Store API Key存储（data/apikeys.json）
+type Store struct {
+	filename string
+
+	mu            sync.Mutex
+	keys          []*Key
+	loaded        bool
+	modTime       time.Time // 已加载文件的修改时间
+	lastPersisted time.Time
+}
+
+// NewStore 创建API Key存储
+func NewStore(dataDir string) *Store {
+	return &Store{
+		filename: filepath.Join(dataDir, "apikeys.json"),
+	}
+}
+
+// Create 创建API Key，返回Key信息和明文（明文只在创建时返回一次）。
+// ttl为0表示永不过期，pool为空表示不限定账户池
+func (s *Store) Create(name string, ttl time.Duration, pool string) (*Key, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("API Key名称不能为空")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, "", err
+	}
+
+	secretBytes := make([]byte, 24)
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", fmt.Errorf("生成API Key失败: %w", err)
+	}
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", fmt.Errorf("生成API Key ID失败: %w", err)
+	}
+
+	secret := keyPrefix + hex.EncodeToString(secretBytes)
+	key := &Key{
+		ID:        "key_" + hex.EncodeToString(idBytes),
+		Name:      name,
+		Prefix:    secret[:len(keyPrefix)+8],
+		Hash:      hashSecret(secret),
+		Pool:      pool,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expiresAt := key.CreatedAt.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	s.keys = append(s.keys, key)
+	if err := s.save(); err != nil {
+		s.keys = s.keys[:len(s.keys)-1]
+		return nil, "", err
+	}
+
+	slog.Info("API Key已创建", "name", key.Name, "key_id", key.ID)
+	copied := *key
+	return &copied, secret, nil
+}
+
+// List 列出全部API Key，按创建时间排序
+func (s *Store) List() ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Revoke 吊销API Key（按ID或名称），保留记录便于审计
+func (s *Store) Revoke(ref string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range s.keys {
+		if key.ID != ref && key.Name != ref {
+			continue
+		}
+		if key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			if err := s.save(); err != nil {
+				return nil, err
+			}
+			slog.Info("API Key已吊销", "name", key.Name, "key_id", key.ID)
+		}
+		copied := *key
+		return &copied, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Authenticate 校验API Key明文，成功时返回Key信息
+func (s *Store) Authenticate(secret string) (*Key, error) {
+	if !strings.HasPrefix(secret, keyPrefix) {
+		return nil, ErrKeyInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	hash := hashSecret(secret)
+	for _, key := range s.keys {
+		if key.Hash != hash {
+			continue
+		}
+		switch key.Status() {
+		case "revoked":
+			return nil, ErrKeyRevoked
+		case "expired":
+			return nil, ErrKeyExpired
+		}
+
+		now := time.Now()
+		key.LastUsedAt = &now
+		if now.Sub(s.lastPersisted) >= lastUsedPersistInterval {
+			if err := s.save(); err != nil {
+				slog.Warn("保存API Key使用时间失败", "error", err)
+			}
+		}
+
+		copied := *key
+		return &copied, nil
+	}
+	return nil, ErrKeyInvalid
+}
+
+// HasActiveKeys 是否存在可用的API Key
+func (s *Store) HasActiveKeys() bool {
+	keys, err := s.List()
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if key.Status() == "active" {
+			return true
+		}
+	}
+	return false
+}
+
+// load 从文件加载，文件被外部修改（如relayctl直接写入）时重新加载（调用方负责加锁）
+func (s *Store) load() error {
+	info, err := os.Stat(s.filename)
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取API Key文件失败: %w", err)
+	}
+	if s.loaded && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	jsonData, err := os.ReadFile(s.filename)
+	if err != nil {
+		return fmt.Errorf("读取API Key文件失败: %w", err)
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(jsonData, &keys); err != nil {
+		return fmt.Errorf("解析API Key文件失败: %w", err)
+	}
+
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.loaded = true
+	return nil
+}
+
+// save 原子写入文件（调用方负责加锁）
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+
+	jsonData, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化API Key失败: %w", err)
+	}
+
+	tmpFile := s.filename + ".tmp"
+	if err := os.WriteFile(tmpFile, jsonData, 0600); err != nil {
+		return fmt.Errorf("写入API Key文件失败: %w", err)
+	}
+	if err := os.Rename(tmpFile, s.filename); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("写入API Key文件失败: %w", err)
+	}
+
+	if info, err := os.Stat(s.filename); err == nil {
+		s.modTime = info.ModTime()
+	}
+	s.lastPersisted = time.Now()
+	return nil
+}
+
+// hashSecret 计算API Key明文的SHA-256
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,258 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/usage"
+)
+
+// 审计日志文件：当前写入 audit.jsonl，轮转后重命名为 audit-<UTC时间>.jsonl
+const (
+	currentFile     = "audit.jsonl"
+	rotatedPrefix   = "audit-"
+	rotatedSuffix   = ".jsonl"
+	rotatedLayout   = "20060102T150405.000"
+	cleanupInterval = time.Hour
+)
+
+// Entry 一条审计记录，对应一次转发请求（包括失败的请求）
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	APIKeyID  string    `json:"api_key_id,omitempty"`
+	// Account 请求指定或调度选中的账户，AccountID 为实际使用的账户ID（账户加载失败时为空）
+	Account   string        `json:"account,omitempty"`
+	AccountID string        `json:"account_id,omitempty"`
+	Pool      string        `json:"pool,omitempty"`
+	Model     string        `json:"model,omitempty"`
+	Status    int           `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	LatencyMS int64         `json:"latency_ms"`
+	Tokens    *usage.Tokens `json:"tokens,omitempty"`
+
+	// 只在启用 include_bodies 时记录，截断后的内容记录为字符串
+	RequestBody  json.RawMessage `json:"request_body,omitempty"`
+	ResponseBody json.RawMessage `json:"response_body,omitempty"`
+	Truncated    bool            `json:"truncated,omitempty"`
+}
+
+// Logger 审计日志：追加写入JSONL文件，超过大小上限时轮转，按保留策略清理轮转文件
+type Logger struct {
+	dir string
+	cfg atomic.Pointer[config.AuditConfig]
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open 打开审计日志目录，追加写入当前文件
+func Open(cfg config.AuditConfig) (*Logger, error) {
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建审计日志目录失败: %w", err)
+	}
+
+	l := &Logger{dir: cfg.Dir}
+	l.cfg.Store(&cfg)
+	if err := l.openCurrent(); err != nil {
+		return nil, err
+	}
+	l.cleanup()
+	return l, nil
+}
+
+// UpdateConfig 热更新轮转、保留和请求体记录策略（目录变化需重启）
+func (l *Logger) UpdateConfig(cfg *config.Config) {
+	audit := cfg.Audit
+	l.cfg.Store(&audit)
+}
+
+// Record 写入一条审计记录，按配置处理请求体和响应体。写入失败只打印日志不影响请求
+func (l *Logger) Record(entry *Entry) {
+	cfg := l.cfg.Load()
+	entry.Error = redactText(entry.Error)
+	if cfg.IncludeBodies {
+		var truncated [2]bool
+		entry.RequestBody, truncated[0] = prepareBody(entry.RequestBody, cfg)
+		entry.ResponseBody, truncated[1] = prepareBody(entry.ResponseBody, cfg)
+		entry.Truncated = truncated[0] || truncated[1]
+	} else {
+		entry.RequestBody, entry.ResponseBody = nil, nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Warn("序列化审计记录失败", "request_id", entry.RequestID, "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if err := l.write(line, int64(cfg.MaxSizeMB)<<20); err != nil {
+		slog.Warn("写入审计日志失败", "request_id", entry.RequestID, "error", err)
+	}
+}
+
+// write 追加一行，当前文件写入后会超过上限时先轮转
+func (l *Logger) write(line []byte, maxSize int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("审计日志已关闭")
+	}
+	if l.size > 0 && l.size+int64(len(line)) > maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate 重命名当前文件并打开新文件（调用方需持有锁）
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		slog.Warn("关闭审计日志文件失败", "error", err)
+	}
+	l.file = nil
+
+	renameErr := os.Rename(filepath.Join(l.dir, currentFile), l.rotatedName(time.Now()))
+	// 重命名失败时继续写入原文件
+	if err := l.openCurrent(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		slog.Warn("轮转审计日志失败", "error", renameErr)
+		return nil
+	}
+
+	go l.cleanup()
+	return nil
+}
+
+// rotatedName 轮转文件名，同一毫秒内已有轮转文件时追加序号（_1、_2...），不覆盖已有文件。
+// 序号接在时间后面，按文件名排序时仍排在同一时间的文件之后
+func (l *Logger) rotatedName(now time.Time) string {
+	base := rotatedPrefix + now.UTC().Format(rotatedLayout)
+	name := filepath.Join(l.dir, base+rotatedSuffix)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+			return name
+		}
+		name = filepath.Join(l.dir, fmt.Sprintf("%s_%d%s", base, i, rotatedSuffix))
+	}
+}
+
+// openCurrent 打开当前文件（调用方需持有锁或在初始化时调用）
+func (l *Logger) openCurrent() error {
+	file, err := os.OpenFile(filepath.Join(l.dir, currentFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("打开审计日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取审计日志文件失败: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// rotatedFiles 轮转后的文件，按时间从旧到新排序
+func (l *Logger) rotatedFiles() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取审计日志目录失败: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, rotatedPrefix) && strings.HasSuffix(name, rotatedSuffix) {
+			files = append(files, filepath.Join(l.dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// cleanup 按保留时长和保留文件数删除轮转文件
+func (l *Logger) cleanup() {
+	cfg := l.cfg.Load()
+	files, err := l.rotatedFiles()
+	if err != nil {
+		slog.Warn("清理审计日志失败", "error", err)
+		return
+	}
+
+	var keep []string
+	for _, file := range files {
+		if cfg.Retention > 0 {
+			if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > cfg.Retention {
+				l.remove(file)
+				continue
+			}
+		}
+		keep = append(keep, file)
+	}
+	if cfg.MaxFiles > 0 && len(keep) > cfg.MaxFiles {
+		for _, file := range keep[:len(keep)-cfg.MaxFiles] {
+			l.remove(file)
+		}
+	}
+}
+
+func (l *Logger) remove(file string) {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		slog.Warn("删除旧的审计日志失败", "file", file, "error", err)
+		return
+	}
+	slog.Info("已删除旧的审计日志", "file", filepath.Base(file))
+}
+
+// Run 定期清理过期的轮转文件，ctx取消时关闭当前文件后返回
+func (l *Logger) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := l.Close(); err != nil {
+				slog.Warn("关闭审计日志文件失败", "error", err)
+			}
+			return
+		case <-ticker.C:
+			l.cleanup()
+		}
+	}
+}
+
+// Close 关闭当前文件，之后的记录被丢弃
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
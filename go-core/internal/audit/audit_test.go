@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"claude-relay-core/internal/config"
+)
+
+func openLogger(t *testing.T, cfg config.AuditConfig) *Logger {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	if cfg.MaxSizeMB == 0 {
+		cfg.MaxSizeMB = 1
+	}
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("打开审计日志失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// query 查询全部记录，从新到旧
+func query(t *testing.T, l *Logger, filter Filter) []*Entry {
+	t.Helper()
+	entries, err := l.Query(filter)
+	if err != nil {
+		t.Fatalf("查询审计日志失败: %v", err)
+	}
+	return entries
+}
+
+func TestRotation(t *testing.T) {
+	l := openLogger(t, config.AuditConfig{MaxFiles: 2})
+
+	// 大小上限为1字节时每条记录都写入新文件
+	for i := 0; i < 4; i++ {
+		line, _ := json.Marshal(&Entry{Time: time.Now(), RequestID: string(rune('a' + i)), Status: 200})
+		if err := l.write(append(line, '\n'), 1); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	l.cleanup()
+
+	rotated, err := l.rotatedFiles()
+	if err != nil || len(rotated) != 2 {
+		t.Fatalf("应只保留2个轮转文件: %v %v", err, rotated)
+	}
+
+	var ids []string
+	for _, entry := range query(t, l, Filter{}) {
+		ids = append(ids, entry.RequestID)
+	}
+	if got := strings.Join(ids, ","); got != "d,c,b" {
+		t.Errorf("应从当前文件和保留的轮转文件中从新到旧读取: %s", got)
+	}
+	if entries := query(t, l, Filter{Limit: 2}); len(entries) != 2 || entries[1].RequestID != "c" {
+		t.Errorf("Limit应在凑够条数后停止: %+v", entries)
+	}
+}
+
+func TestRotatedNameDoesNotOverwrite(t *testing.T) {
+	l := openLogger(t, config.AuditConfig{})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		name := l.rotatedName(now)
+		if err := os.WriteFile(name, nil, 0600); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		names = append(names, filepath.Base(name))
+	}
+	want := "audit-20250101T000000.000.jsonl,audit-20250101T000000.000_1.jsonl,audit-20250101T000000.000_2.jsonl"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("同一毫秒内轮转应追加序号: %s", got)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("追加序号的文件应排在同一时间的文件之后: %v", names)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, rotatedPrefix+"20250101T000000.000"+rotatedSuffix)
+	recent := filepath.Join(dir, rotatedPrefix+"20250102T000000.000"+rotatedSuffix)
+	for _, file := range []string{old, recent} {
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			t.Fatalf("创建轮转文件失败: %v", err)
+		}
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+
+	// 打开时按保留时长清理
+	openLogger(t, config.AuditConfig{Dir: dir, Retention: 24 * time.Hour})
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("超过保留时长的轮转文件应被删除")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("保留时长内的轮转文件不应删除: %v", err)
+	}
+}
+
+func TestRecordRedaction(t *testing.T) {
+	l := openLogger(t, config.AuditConfig{IncludeBodies: true, MaxBodyBytes: 4096, RedactFields: []string{"system"}})
+
+	l.Record(&Entry{
+		Time:         time.Now(),
+		Status:       401,
+		Error:        "刷新失败: refresh_token=sk-ant-ort01-secret",
+		RequestBody:  json.RawMessage(`{"model":"claude-sonnet-4","system":"内部提示词","messages":[{"role":"user","content":"hi","metadata":{"system":"nested"}}]}`),
+		ResponseBody: json.RawMessage(`{"access_token":"sk-ant-oat01-secret","max_tokens":1024}`),
+	})
+
+	entries := query(t, l, Filter{})
+	if len(entries) != 1 {
+		t.Fatalf("应有1条记录: %+v", entries)
+	}
+	entry := entries[0]
+	if strings.Contains(entry.Error, "secret") {
+		t.Errorf("错误信息中的凭据应脱敏: %s", entry.Error)
+	}
+	request := string(entry.RequestBody)
+	if strings.Contains(request, "内部提示词") || strings.Contains(request, "nested") || !strings.Contains(request, `"content":"hi"`) {
+		t.Errorf("应隐藏任意层级的指定字段，其余内容保留: %s", request)
+	}
+	response := string(entry.ResponseBody)
+	if strings.Contains(response, "secret") || !strings.Contains(response, `"max_tokens":1024`) {
+		t.Errorf("响应中的凭据应脱敏，数字应原样保留: %s", response)
+	}
+	if entry.Truncated {
+		t.Errorf("未超过上限时不应截断")
+	}
+}
+
+func TestRecordTruncation(t *testing.T) {
+	l := openLogger(t, config.AuditConfig{IncludeBodies: true, MaxBodyBytes: 10})
+
+	// 截断处落在多字节字符中间
+	l.Record(&Entry{Time: time.Now(), Status: 200, RequestBody: json.RawMessage(`{"text":"你好世界"}`)})
+	entry := query(t, l, Filter{})[0]
+
+	var body string
+	if err := json.Unmarshal(entry.RequestBody, &body); err != nil {
+		t.Fatalf("截断后的内容应记录为字符串: %s", entry.RequestBody)
+	}
+	if !entry.Truncated || len(body) > 10 || !utf8.ValidString(body) || !strings.HasPrefix(body, `{"text":"`) {
+		t.Errorf("截断结果不正确: %q truncated=%v", body, entry.Truncated)
+	}
+
+	// 未开启时不记录请求体
+	l.UpdateConfig(&config.Config{Audit: config.AuditConfig{MaxSizeMB: 1}})
+	l.Record(&Entry{Time: time.Now(), Status: 200, RequestBody: json.RawMessage(`{}`), ResponseBody: json.RawMessage(`{}`)})
+	if entry := query(t, l, Filter{Limit: 1})[0]; entry.RequestBody != nil || entry.ResponseBody != nil {
+		t.Errorf("未开启 include_bodies 时不应记录请求体和响应体: %+v", entry)
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	l := openLogger(t, config.AuditConfig{})
+	start := time.Now().Add(-time.Minute) // 起始时间晚于文件修改时间的文件会被跳过
+	l.Record(&Entry{Time: start, AccountID: "acct_1", Model: "claude-sonnet-4", Status: 200})
+	l.Record(&Entry{Time: start.Add(time.Second), AccountID: "acct_2", Model: "claude-opus-4", Status: 429})
+	l.Record(&Entry{Time: start.Add(2 * time.Second), AccountID: "acct_1", Model: "claude-opus-4", Status: 200})
+
+	if entries := query(t, l, Filter{AccountID: "acct_1", Model: "claude-opus-4"}); len(entries) != 1 || !entries[0].Time.Equal(start.Add(2*time.Second)) {
+		t.Errorf("按账户和模型过滤不正确: %+v", entries)
+	}
+	if entries := query(t, l, Filter{Status: 429}); len(entries) != 1 || entries[0].AccountID != "acct_2" {
+		t.Errorf("按状态码过滤不正确: %+v", entries)
+	}
+	if entries := query(t, l, Filter{From: start.Add(time.Second), To: start.Add(2 * time.Second)}); len(entries) != 1 || entries[0].AccountID != "acct_2" {
+		t.Errorf("时间范围应包含起点、不含终点: %+v", entries)
+	}
+}
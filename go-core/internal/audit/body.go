@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/logging"
+)
+
+// redactedValue 按 redact_fields 隐藏的字段值
+const redactedValue = "[REDACTED]"
+
+// prepareBody 隐藏配置的字段、脱敏凭据，超过大小上限时截断为字符串，返回是否截断
+func prepareBody(body json.RawMessage, cfg *config.AuditConfig) (json.RawMessage, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+
+	if len(cfg.RedactFields) > 0 {
+		body = redactFields(body, cfg.RedactFields)
+	}
+	redacted := []byte(redactText(string(body)))
+	if len(redacted) <= cfg.MaxBodyBytes {
+		if json.Valid(redacted) {
+			return redacted, false
+		}
+		return quote(redacted), false
+	}
+
+	// 截断处可能落在多字节字符中间，去掉不完整的字符
+	return quote(bytes.ToValidUTF8(redacted[:cfg.MaxBodyBytes], nil)), true
+}
+
+// redactFields 将任意层级中指定名称字段的值替换为占位符，不是JSON时原样返回
+func redactFields(body json.RawMessage, fields []string) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+
+	names := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		names[field] = true
+	}
+	walk(value, names)
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func walk(value interface{}, names map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if names[key] {
+				v[key] = redactedValue
+				continue
+			}
+			walk(item, names)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walk(item, names)
+		}
+	}
+}
+
+// redactText 替换文本中的凭据（token、API Key、代理密码等）
+func redactText(s string) string {
+	if s == "" {
+		return s
+	}
+	return logging.Redact(s)
+}
+
+// quote 将内容记录为JSON字符串
+func quote(b []byte) json.RawMessage {
+	quoted, _ := json.Marshal(string(b))
+	return quoted
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Filter 审计记录查询条件，零值字段表示不过滤
+type Filter struct {
+	From      time.Time // 起始时间（含）
+	To        time.Time // 结束时间（不含）
+	APIKeyID  string
+	AccountID string
+	Model     string
+	Status    int
+	Limit     int // 最多返回的记录数，为0时不限
+}
+
+// match 记录是否满足条件
+func (f Filter) match(entry *Entry) bool {
+	switch {
+	case !f.From.IsZero() && entry.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !entry.Time.Before(f.To):
+		return false
+	case f.APIKeyID != "" && entry.APIKeyID != f.APIKeyID:
+		return false
+	case f.AccountID != "" && entry.AccountID != f.AccountID:
+		return false
+	case f.Model != "" && entry.Model != f.Model:
+		return false
+	case f.Status != 0 && entry.Status != f.Status:
+		return false
+	}
+	return true
+}
+
+// Query 按条件查询审计记录，从新到旧排序。依次读取当前文件和轮转文件，凑够 Limit 条后停止
+func (l *Logger) Query(filter Filter) ([]*Entry, error) {
+	files, err := l.queryFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*Entry{}
+	for _, file := range files {
+		// 文件最后修改时间早于起始时间时，其中的记录都不满足条件
+		if info, err := os.Stat(file); err == nil && !filter.From.IsZero() && info.ModTime().Before(filter.From) {
+			continue
+		}
+
+		matched, err := readFile(file, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(matched) - 1; i >= 0; i-- {
+			entries = append(entries, matched[i])
+			if filter.Limit > 0 && len(entries) >= filter.Limit {
+				return entries, nil
+			}
+		}
+	}
+	return entries, nil
+}
+
+// queryFiles 当前文件和轮转文件，按时间从新到旧
+func (l *Logger) queryFiles() ([]string, error) {
+	// 持有写入锁，避免列目录时恰好轮转
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rotated, err := l.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{filepath.Join(l.dir, currentFile)}
+	for i := len(rotated) - 1; i >= 0; i-- {
+		files = append(files, rotated[i])
+	}
+	return files, nil
+}
+
+// readFile 读取文件中满足条件的记录（按写入顺序），跳过无法解析的行
+func readFile(name string, filter Filter) ([]*Entry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	defer file.Close()
+
+	var entries []*Entry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry Entry
+			if json.Unmarshal(line, &entry) == nil && filter.match(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %w", err)
+		}
+	}
+}
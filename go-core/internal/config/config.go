@@ -1,68 +1,443 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config 应用程序配置
 type Config struct {
-	Server ServerConfig `json:"server"`
-	OAuth  OAuthConfig  `json:"oauth"`
-	Claude ClaudeConfig `json:"claude"`
-	Proxy  ProxyConfig  `json:"proxy"`
+	Server ServerConfig `json:"server" yaml:"server"`
+	OAuth  OAuthConfig  `json:"oauth" yaml:"oauth"`
+	Claude ClaudeConfig `json:"claude" yaml:"claude"`
+	Proxy  ProxyConfig  `json:"proxy" yaml:"proxy"`
+	Auth   AuthConfig   `json:"auth" yaml:"auth"`
+	Usage  UsageConfig  `json:"usage" yaml:"usage"`
+
+	Scheduler   SchedulerConfig   `json:"scheduler" yaml:"scheduler"`
+	Concurrency ConcurrencyConfig `json:"concurrency" yaml:"concurrency"`
+	Breaker     BreakerConfig     `json:"circuit_breaker" yaml:"circuit_breaker"`
+	Metrics     MetricsConfig     `json:"metrics" yaml:"metrics"`
+	Log         LogConfig         `json:"log" yaml:"log"`
+	Tracing     TracingConfig     `json:"tracing" yaml:"tracing"`
+	Audit       AuditConfig       `json:"audit" yaml:"audit"`
+	Replay      ReplayConfig      `json:"replay" yaml:"replay"`
+	Notify      NotifyConfig      `json:"notify" yaml:"notify"`
+
+	// 命名代理，可在全局代理、授权和导入账户时按名称引用
+	Proxies map[string]*ProxyEndpoint `json:"proxies,omitempty" yaml:"proxies"`
+	// 账户池，请求或API Key可以限定只调度池内的账户
+	Pools map[string]*PoolConfig `json:"pools,omitempty" yaml:"pools"`
+	// 模型价格（美元/百万token），用于用量统计估算费用，按模型名最长前缀匹配
+	Pricing map[string]*ModelPrice `json:"pricing,omitempty" yaml:"pricing"`
+	// 模型别名，转发前将请求中的别名替换为实际模型名
+	ModelAliases map[string]string `json:"model_aliases,omitempty" yaml:"model_aliases"`
+	// API Key默认值
+	APIKeys APIKeyConfig `json:"api_keys" yaml:"api_keys"`
 }
 
+// OAuth回调模式
+const (
+	CallbackModeManual   = "manual"   // 使用托管回调页面，手动复制授权码
+	CallbackModeLoopback = "loopback" // 重定向到本服务的回调路由，自动完成token交换
+)
+
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int    `json:"port"`
-	Host string `json:"host"`
+	Port    int    `json:"port" yaml:"port"`
+	Host    string `json:"host" yaml:"host"`
+	DataDir string `json:"data_dir" yaml:"data_dir"`
+
+	// ConfigWatchInterval 检查配置文件变化的间隔，为0时只在收到SIGHUP时重新加载
+	ConfigWatchInterval time.Duration `json:"config_watch_interval" yaml:"config_watch_interval"`
+	// ShutdownTimeout 退出时等待进行中请求完成的最长时间，超时后强制关闭连接
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	// TLS 配置证书后 host:port 改为HTTPS
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+	// UnixSocket 额外监听的Unix domain socket路径（明文HTTP），为空时不监听
+	UnixSocket string `json:"unix_socket,omitempty" yaml:"unix_socket"`
+	// UnixSocketMode Unix socket文件权限（八进制）
+	UnixSocketMode string `json:"unix_socket_mode" yaml:"unix_socket_mode"`
+}
+
+// TLSConfig HTTPS配置，证书文件变化后自动重新加载
+type TLSConfig struct {
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file"`
+	// ClientCAFile 设置后启用双向TLS，要求客户端出示由该CA签发的证书
+	ClientCAFile string `json:"client_ca_file,omitempty" yaml:"client_ca_file"`
+}
+
+// Enabled 是否启用HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
 }
 
 // OAuthConfig OAuth配置
 type OAuthConfig struct {
-	ClientID     string `json:"client_id"`
-	AuthorizeURL string `json:"authorize_url"`
-	TokenURL     string `json:"token_url"`
-	RedirectURI  string `json:"redirect_uri"`
-	Scopes       string `json:"scopes"`
+	ClientID     string `json:"client_id" yaml:"client_id"`
+	AuthorizeURL string `json:"authorize_url" yaml:"authorize_url"`
+	TokenURL     string `json:"token_url" yaml:"token_url"`
+	RedirectURI  string `json:"redirect_uri" yaml:"redirect_uri"`
+	Scopes       string `json:"scopes" yaml:"scopes"`
+	ProfileURL   string `json:"profile_url" yaml:"profile_url"`
+
+	// 回调模式及loopback模式使用的本地回调地址
+	CallbackMode        string `json:"callback_mode" yaml:"callback_mode"`
+	LoopbackRedirectURI string `json:"loopback_redirect_uri" yaml:"loopback_redirect_uri"`
+
+	// PKCE会话有效期及过期会话清理间隔
+	PKCETTL           time.Duration `json:"pkce_ttl" yaml:"pkce_ttl"`
+	PKCESweepInterval time.Duration `json:"pkce_sweep_interval" yaml:"pkce_sweep_interval"`
 }
 
 // ClaudeConfig Claude API配置
 type ClaudeConfig struct {
-	APIUrl     string `json:"api_url"`
-	APIVersion string `json:"api_version"`
-	BetaHeader string `json:"beta_header"`
-	Timeout    time.Duration `json:"timeout"`
+	APIUrl     string        `json:"api_url" yaml:"api_url"`
+	APIVersion string        `json:"api_version" yaml:"api_version"`
+	BetaHeader string        `json:"beta_header" yaml:"beta_header"`
+	Timeout    time.Duration `json:"timeout" yaml:"timeout"`
 }
 
 // ProxyConfig 代理配置
 type ProxyConfig struct {
-	Timeout    time.Duration `json:"timeout"`
-	MaxRetries int           `json:"max_retries"`
-	
+	Timeout    time.Duration `json:"timeout" yaml:"timeout"`
+	MaxRetries int           `json:"max_retries" yaml:"max_retries"`
+
 	// 全局代理设置 - 用于所有Claude Code服务器请求
-	GlobalProxy *GlobalProxyConfig `json:"global_proxy,omitempty"`
+	GlobalProxy *GlobalProxyConfig `json:"global_proxy,omitempty" yaml:"global_proxy"`
+}
+
+// AuthConfig 访问认证配置
+type AuthConfig struct {
+	// 管理令牌，为空时管理接口（/oauth、/admin）不做认证
+	AdminToken string `json:"-" yaml:"admin_token"`
+	// 为true时 /api/v1 必须携带有效的API Key
+	RequireAPIKey bool `json:"require_api_key" yaml:"require_api_key"`
+}
+
+// UsageConfig 用量统计配置
+type UsageConfig struct {
+	FlushInterval time.Duration `json:"flush_interval" yaml:"flush_interval"`
+}
+
+// MetricsConfig Prometheus监控配置
+type MetricsConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Path    string `json:"path" yaml:"path"`
+	// 为true时抓取接口需要管理令牌（Authorization: Bearer <admin_token>）
+	RequireAuth bool `json:"require_auth" yaml:"require_auth"`
 }
 
-// GlobalProxyConfig 全局代理配置
+// 日志格式
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogConfig 日志配置
+type LogConfig struct {
+	// 日志级别：debug, info, warn, error
+	Level string `json:"level" yaml:"level"`
+	// 输出格式：json（默认，便于日志系统采集）或 text
+	Format string `json:"format" yaml:"format"`
+	// 是否记录每个HTTP请求的访问日志
+	AccessLog bool `json:"access_log" yaml:"access_log"`
+}
+
+// SlogLevel 解析日志级别
+func (c LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return 0, fmt.Errorf("无效的日志级别: %s", c.Level)
+	}
+	return level, nil
+}
+
+// TracingConfig OpenTelemetry链路追踪配置
+type TracingConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// OTLP/HTTP接收地址，如 http://otel-collector:4318（未指定路径时使用 /v1/traces），
+	// 为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 环境变量或默认的 localhost:4318
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// 导出请求附加的头部，如后端要求的认证信息
+	Headers map[string]string `json:"-" yaml:"headers"`
+	// 采样比例（0-1），请求携带traceparent时跟随上游的采样决定
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+	ServiceName string  `json:"service_name" yaml:"service_name"`
+}
+
+// AuditConfig 审计日志配置：每个转发请求写入一行JSON，按大小轮转
+type AuditConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// 审计日志目录，为空时使用 <data_dir>/audit
+	Dir string `json:"dir" yaml:"dir"`
+	// 当前文件超过该大小（MB）时轮转
+	MaxSizeMB int `json:"max_size_mb" yaml:"max_size_mb"`
+	// 轮转后的文件保留时长，为0时不按时间清理
+	Retention time.Duration `json:"retention" yaml:"retention"`
+	// 最多保留的轮转文件数，为0时不限
+	MaxFiles int `json:"max_files" yaml:"max_files"`
+	// 是否记录完整的请求体和响应体（凭据始终脱敏）
+	IncludeBodies bool `json:"include_bodies" yaml:"include_bodies"`
+	// 请求体、响应体各自最多记录的字节数，超出部分截断
+	MaxBodyBytes int `json:"max_body_bytes" yaml:"max_body_bytes"`
+	// 请求体、响应体中需要隐藏的JSON字段名（任意层级），如 system、content
+	RedactFields []string `json:"redact_fields,omitempty" yaml:"redact_fields"`
+}
+
+// 上游流量录制/回放模式
+const (
+	ReplayModeOff    = ""
+	ReplayModeRecord = "record" // 正常转发，同时把上游请求和响应写入fixture文件
+	ReplayModeReplay = "replay" // 按请求指纹从fixture返回响应，不访问上游
+)
+
+// ReplayConfig 上游流量录制与回放，用于确定性测试和离线复现问题
+type ReplayConfig struct {
+	// 模式：record, replay，为空时关闭
+	Mode string `json:"mode" yaml:"mode"`
+	// fixture目录，为空时使用 <data_dir>/fixtures
+	Dir string `json:"dir" yaml:"dir"`
+	// 回放时按录制的时间间隔（响应头、SSE分块）输出，默认立即返回全部内容
+	Realtime bool `json:"realtime" yaml:"realtime"`
+}
+
+// SchedulerConfig 账户调度配置（请求未指定账户时使用）
+type SchedulerConfig struct {
+	// Opus请求优先调度订阅等级更高的账户（max > team > pro）
+	OpusPreferHigherTier bool `json:"opus_prefer_higher_tier" yaml:"opus_prefer_higher_tier"`
+}
+
+// ConcurrencyConfig 单账户并发限制：超出上限的请求进入该账户的FIFO队列等待，
+// 或在开启溢出时调度到账户池内其他空闲账户
+type ConcurrencyConfig struct {
+	// 每个账户的最大并发请求数，0表示不限制
+	MaxPerAccount int `json:"max_per_account" yaml:"max_per_account"`
+	// 按账户名或账户ID单独设置的并发上限，覆盖 max_per_account，0表示不限制
+	Accounts map[string]int `json:"accounts,omitempty" yaml:"accounts"`
+	// 每个账户的等待队列长度，队列已满时直接拒绝，0表示不排队
+	MaxQueue int `json:"max_queue" yaml:"max_queue"`
+	// 排队等待的最长时间，超时后拒绝
+	QueueTimeout time.Duration `json:"queue_timeout" yaml:"queue_timeout"`
+	// 未指定账户时优先调度未达到并发上限的账户，都已满时再排队
+	Spillover bool `json:"spillover" yaml:"spillover"`
+}
+
+// Limit 账户的并发上限，0表示不限制
+func (c ConcurrencyConfig) Limit(id, name string) int {
+	if limit, ok := c.Accounts[name]; ok {
+		return limit
+	}
+	if limit, ok := c.Accounts[id]; ok {
+		return limit
+	}
+	return c.MaxPerAccount
+}
+
+// BreakerConfig 熔断配置：账户和出口（代理或直连）各自统计最近的失败率，
+// 失败率过高时熔断，冷却后放行一个试探请求，成功则恢复
+type BreakerConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// 失败率的统计窗口
+	Window time.Duration `json:"window" yaml:"window"`
+	// 窗口内请求数达到该值后才计算失败率
+	MinRequests int `json:"min_requests" yaml:"min_requests"`
+	// 失败率达到该值时熔断（0到1）
+	FailureRatio float64 `json:"failure_ratio" yaml:"failure_ratio"`
+	// 熔断后等待多久放行试探请求
+	Cooldown time.Duration `json:"cooldown" yaml:"cooldown"`
+}
+
+// NotifyConfig 事件通知：账户或代理出现问题时推送到webhook，投递失败时重试，
+// 重试用尽后写入死信日志
+type NotifyConfig struct {
+	// 按名称配置的webhook
+	Webhooks map[string]*WebhookConfig `json:"webhooks,omitempty" yaml:"webhooks"`
+	// 单次投递的超时
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// 投递失败后的重试次数
+	MaxRetries int `json:"max_retries" yaml:"max_retries"`
+	// 第一次重试前的等待时间，之后每次翻倍
+	RetryBackoff time.Duration `json:"retry_backoff" yaml:"retry_backoff"`
+	// 同一账户或代理的同类事件在该时间内只通知一次，0表示不去重
+	DedupeWindow time.Duration `json:"dedupe_window" yaml:"dedupe_window"`
+	// 死信日志文件，为空时使用 <data_dir>/notify/dead_letters.jsonl
+	DeadLetterFile string `json:"dead_letter_file" yaml:"dead_letter_file"`
+}
+
+// webhook负载格式
+const (
+	WebhookFormatJSON     = "json"     // 事件原样序列化为JSON，配置secret时附带HMAC签名头
+	WebhookFormatSlack    = "slack"    // Slack Incoming Webhook
+	WebhookFormatFeishu   = "feishu"   // 飞书自定义机器人，secret为签名校验密钥
+	WebhookFormatDingTalk = "dingtalk" // 钉钉自定义机器人，secret为加签密钥
+)
+
+// WebhookConfig 单个webhook
+type WebhookConfig struct {
+	URL string `json:"-" yaml:"url"`
+	// 签名密钥，为空时不签名
+	Secret string `json:"-" yaml:"secret"`
+	// 负载格式：json, slack, feishu, dingtalk，默认json
+	Format string `json:"format" yaml:"format"`
+	// 订阅的事件类型，为空时订阅全部事件
+	Events []string `json:"events,omitempty" yaml:"events"`
+}
+
+// Subscribed webhook是否订阅了该事件类型
+func (w *WebhookConfig) Subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// LogValue 日志中不输出webhook地址和签名密钥（地址中常带有访问令牌）
+func (w *WebhookConfig) LogValue() slog.Value {
+	if w == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(slog.String("format", w.Format), slog.Any("events", w.Events))
+}
+
+// GlobalProxyConfig 全局代理配置，可以直接填写代理参数，也可以通过 proxy 引用命名代理
 type GlobalProxyConfig struct {
-	Enabled  bool   `json:"enabled"`
-	Type     string `json:"type"`     // socks5, http, https
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Username string `json:"username,omitempty"`
-	Password string `json:"password,omitempty"`
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	Proxy    string `json:"proxy,omitempty" yaml:"proxy"`
+	Type     string `json:"type" yaml:"type"` // socks5, http, https
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username,omitempty" yaml:"username"`
+	Password string `json:"password,omitempty" yaml:"password"`
+}
+
+// LogValue 日志中只输出引用的命名代理或不含认证信息的代理地址
+func (g *GlobalProxyConfig) LogValue() slog.Value {
+	if g == nil {
+		return slog.Value{}
+	}
+	if g.Proxy != "" {
+		return slog.StringValue(g.Proxy)
+	}
+	return slog.StringValue(fmt.Sprintf("%s://%s", g.Type, net.JoinHostPort(g.Host, strconv.Itoa(g.Port))))
+}
+
+// ProxyEndpoint 命名代理
+type ProxyEndpoint struct {
+	Type     string `json:"type" yaml:"type"` // socks5, http, https
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username,omitempty" yaml:"username"`
+	Password string `json:"password,omitempty" yaml:"password"`
+}
+
+// LogValue 日志中只输出不含认证信息的代理地址
+func (p *ProxyEndpoint) LogValue() slog.Value {
+	if p == nil {
+		return slog.Value{}
+	}
+	return slog.StringValue(fmt.Sprintf("%s://%s", p.Type, net.JoinHostPort(p.Host, strconv.Itoa(p.Port))))
+}
+
+// PoolConfig 账户池：列出的账户（名称或ID）以及带有任一标签的账户属于该池
+type PoolConfig struct {
+	Accounts []string `json:"accounts,omitempty" yaml:"accounts"`
+	Tags     []string `json:"tags,omitempty" yaml:"tags"`
+}
+
+// ModelPrice 模型价格，单位为美元/百万token
+type ModelPrice struct {
+	Input      float64 `json:"input" yaml:"input"`
+	Output     float64 `json:"output" yaml:"output"`
+	CacheWrite float64 `json:"cache_write" yaml:"cache_write"`
+	CacheRead  float64 `json:"cache_read" yaml:"cache_read"`
+}
+
+// APIKeyConfig API Key默认值
+type APIKeyConfig struct {
+	// 创建时未指定有效期时使用，0表示永不过期
+	DefaultTTL time.Duration `json:"default_ttl" yaml:"default_ttl"`
+	// 创建时未指定账户池时使用，为空表示不限制
+	DefaultPool string `json:"default_pool,omitempty" yaml:"default_pool"`
 }
 
-// Load 加载配置
+// SocketMode 解析Unix socket文件权限
+func (s ServerConfig) SocketMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("无效的Unix socket权限: %q（应为八进制，如 0660）", s.UnixSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// LoadOptions 配置加载选项
+type LoadOptions struct {
+	// 配置文件路径（.yaml/.yml/.toml/.json），为空时取 CONFIG_FILE 环境变量，都为空时不读取文件
+	File string
+	// 命令行参数覆盖，在环境变量之后应用
+	Overrides func(*Config)
+}
+
+// Load 加载配置：默认值 < 配置文件 < 环境变量
 func Load() (*Config, error) {
-	config := &Config{
+	return LoadWithOptions(LoadOptions{})
+}
+
+// LoadWithOptions 加载配置：默认值 < 配置文件 < 环境变量 < 命令行参数
+func LoadWithOptions(opts LoadOptions) (*Config, error) {
+	config := Default()
+
+	file := opts.File
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := loadFile(file, config); err != nil {
+			return nil, err
+		}
+	}
+
+	envErrs := applyEnv(config)
+	if opts.Overrides != nil {
+		opts.Overrides(config)
+	}
+	config.resolve()
+
+	// 验证配置，环境变量解析错误与配置问题一起报告
+	if err := errors.Join(append(envErrs, config.Validate())...); err != nil {
+		return nil, fmt.Errorf("配置验证失败:\n%w", err)
+	}
+
+	return config, nil
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
 		Server: ServerConfig{
-			Port: getEnvInt("PORT", 3000),
-			Host: getEnvString("HOST", "0.0.0.0"),
+			Port:    3000,
+			Host:    "0.0.0.0",
+			DataDir: "./data",
+
+			ConfigWatchInterval: 5 * time.Second,
+			ShutdownTimeout:     30 * time.Second,
+			UnixSocketMode:      "0660",
 		},
 		OAuth: OAuthConfig{
 			ClientID:     "9d1c250a-e61b-44d9-88ed-5944d1962f5e", // Claude Code固定ClientID
@@ -70,101 +445,291 @@ func Load() (*Config, error) {
 			TokenURL:     "https://console.anthropic.com/v1/oauth/token",
 			RedirectURI:  "https://console.anthropic.com/oauth/code/callback",
 			Scopes:       "org:create_api_key user:profile user:inference",
+			ProfileURL:   "https://api.anthropic.com/api/oauth/profile",
+
+			CallbackMode: CallbackModeManual,
+			// LoopbackRedirectURI 为空时按最终端口生成，见 resolve
+
+			PKCETTL:           10 * time.Minute,
+			PKCESweepInterval: time.Minute,
 		},
 		Claude: ClaudeConfig{
-			APIUrl:     getEnvString("CLAUDE_API_URL", "https://api.anthropic.com/v1/messages"),
-			APIVersion: getEnvString("CLAUDE_API_VERSION", "2023-06-01"),
-			BetaHeader: getEnvString("CLAUDE_BETA_HEADER", "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14"),
-			Timeout:    getEnvDuration("CLAUDE_TIMEOUT", 30*time.Second),
+			APIUrl:     "https://api.anthropic.com/v1/messages",
+			APIVersion: "2023-06-01",
+			BetaHeader: "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14",
+			Timeout:    30 * time.Second,
 		},
 		Proxy: ProxyConfig{
-			Timeout:     getEnvDuration("PROXY_TIMEOUT", 30*time.Second),
-			MaxRetries:  getEnvInt("PROXY_MAX_RETRIES", 3),
-			GlobalProxy: loadGlobalProxyConfig(),
+			Timeout:    30 * time.Second,
+			MaxRetries: 3,
+		},
+		Usage: UsageConfig{
+			FlushInterval: time.Minute,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Log: LogConfig{
+			Level:     "info",
+			Format:    LogFormatJSON,
+			AccessLog: true,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+			ServiceName: "claude-relay",
+		},
+		Audit: AuditConfig{
+			MaxSizeMB:    100,
+			Retention:    30 * 24 * time.Hour,
+			MaxBodyBytes: 64 * 1024,
+		},
+		Scheduler: SchedulerConfig{
+			OpusPreferHigherTier: true,
+		},
+		Concurrency: ConcurrencyConfig{
+			QueueTimeout: 30 * time.Second,
+			Spillover:    true,
+		},
+		Breaker: BreakerConfig{
+			Enabled:      true,
+			Window:       time.Minute,
+			MinRequests:  5,
+			FailureRatio: 0.5,
+			Cooldown:     30 * time.Second,
+		},
+		Notify: NotifyConfig{
+			Timeout:      10 * time.Second,
+			MaxRetries:   3,
+			RetryBackoff: time.Second,
+			DedupeWindow: 5 * time.Minute,
 		},
 	}
+}
 
-	// 验证配置
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("配置验证失败: %w", err)
+// resolve 补全依赖其他字段的默认值，展开命名代理引用
+func (c *Config) resolve() {
+	if c.OAuth.LoopbackRedirectURI == "" {
+		scheme := "http"
+		if c.Server.TLS.Enabled() {
+			scheme = "https"
+		}
+		c.OAuth.LoopbackRedirectURI = fmt.Sprintf("%s://localhost:%d/callback", scheme, c.Server.Port)
+	}
+	if c.Audit.Dir == "" {
+		c.Audit.Dir = filepath.Join(c.Server.DataDir, "audit")
+	}
+	if c.Replay.Dir == "" {
+		c.Replay.Dir = filepath.Join(c.Server.DataDir, "fixtures")
+	}
+	if c.Notify.DeadLetterFile == "" {
+		c.Notify.DeadLetterFile = filepath.Join(c.Server.DataDir, "notify", "dead_letters.jsonl")
+	}
+	for _, webhook := range c.Notify.Webhooks {
+		if webhook != nil && webhook.Format == "" {
+			webhook.Format = WebhookFormatJSON
+		}
 	}
 
-	return config, nil
+	global := c.Proxy.GlobalProxy
+	if global == nil {
+		return
+	}
+	if !global.Enabled {
+		c.Proxy.GlobalProxy = nil
+		return
+	}
+	if endpoint, ok := c.Proxies[global.Proxy]; ok && endpoint != nil {
+		global.Type = endpoint.Type
+		global.Host = endpoint.Host
+		global.Port = endpoint.Port
+		global.Username = endpoint.Username
+		global.Password = endpoint.Password
+	}
 }
 
-// Validate 验证配置
+// Validate 验证配置，一次返回全部问题
 func (c *Config) Validate() error {
-	if c.Server.Port <= 0 || c.Server.Port > 65535 {
-		return fmt.Errorf("无效的服务器端口: %d", c.Server.Port)
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	if c.OAuth.ClientID == "" {
-		return fmt.Errorf("OAuth ClientID 不能为空")
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "无效的服务器端口: %d", c.Server.Port)
+	check(c.Server.DataDir != "", "数据目录不能为空")
+	check(c.Server.ConfigWatchInterval >= 0, "配置文件检查间隔不能为负数: %s", c.Server.ConfigWatchInterval)
+	check(c.Server.ShutdownTimeout > 0, "退出等待时间必须大于0: %s", c.Server.ShutdownTimeout)
+	if tls := c.Server.TLS; tls.Enabled() || tls.ClientCAFile != "" {
+		check(tls.CertFile != "" && tls.KeyFile != "", "TLS证书和私钥必须同时配置")
+	}
+	if _, err := c.Server.SocketMode(); err != nil {
+		errs = append(errs, err)
 	}
 
-	if c.Claude.APIUrl == "" {
-		return fmt.Errorf("Claude API URL 不能为空")
+	check(c.OAuth.ClientID != "", "OAuth ClientID 不能为空")
+	check(isAbsoluteURL(c.OAuth.AuthorizeURL), "无效的OAuth授权地址: %q", c.OAuth.AuthorizeURL)
+	check(isAbsoluteURL(c.OAuth.TokenURL), "无效的OAuth token地址: %q", c.OAuth.TokenURL)
+	check(isAbsoluteURL(c.OAuth.RedirectURI), "无效的OAuth回调地址: %q", c.OAuth.RedirectURI)
+	check(isAbsoluteURL(c.OAuth.ProfileURL), "无效的OAuth profile地址: %q", c.OAuth.ProfileURL)
+	check(c.OAuth.CallbackMode == CallbackModeManual || c.OAuth.CallbackMode == CallbackModeLoopback,
+		"无效的OAuth回调模式: %s", c.OAuth.CallbackMode)
+	if u, err := url.Parse(c.OAuth.LoopbackRedirectURI); err != nil || u.Scheme == "" || u.Host == "" || u.Path == "" {
+		errs = append(errs, fmt.Errorf("无效的loopback回调地址: %s", c.OAuth.LoopbackRedirectURI))
 	}
+	check(c.OAuth.PKCETTL > 0, "PKCE会话有效期必须大于0: %s", c.OAuth.PKCETTL)
+	check(c.OAuth.PKCESweepInterval > 0, "PKCE会话清理间隔必须大于0: %s", c.OAuth.PKCESweepInterval)
 
-	return nil
-}
+	check(c.Claude.APIUrl != "", "Claude API URL 不能为空")
+	check(c.Claude.Timeout > 0, "Claude API超时必须大于0: %s", c.Claude.Timeout)
 
-// 辅助函数
-func getEnvString(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	check(c.Proxy.Timeout > 0, "代理超时必须大于0: %s", c.Proxy.Timeout)
+	check(c.Proxy.MaxRetries >= 0, "代理重试次数不能为负数: %d", c.Proxy.MaxRetries)
+	if global := c.Proxy.GlobalProxy; global != nil {
+		if global.Proxy != "" && c.Proxies[global.Proxy] == nil {
+			errs = append(errs, fmt.Errorf("全局代理引用的命名代理不存在: %s", global.Proxy))
+		} else {
+			errs = append(errs, validateProxy("全局代理", global.Type, global.Host, global.Port)...)
+		}
 	}
-	return defaultValue
-}
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+	check(c.Usage.FlushInterval > 0, "用量写入间隔必须大于0: %s", c.Usage.FlushInterval)
+	check(!c.Metrics.Enabled || strings.HasPrefix(c.Metrics.Path, "/"), "监控接口路径必须以 / 开头: %s", c.Metrics.Path)
+	if _, err := c.Log.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Log.Format == LogFormatJSON || c.Log.Format == LogFormatText, "无效的日志格式: %s（可选 json, text）", c.Log.Format)
+	if c.Tracing.Enabled {
+		if c.Tracing.Endpoint != "" {
+			u, err := url.Parse(c.Tracing.Endpoint)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "无效的链路追踪地址: %s", c.Tracing.Endpoint)
+		}
+		check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "链路追踪采样比例必须在0到1之间: %v", c.Tracing.SampleRatio)
+		check(c.Tracing.ServiceName != "", "链路追踪服务名不能为空")
+	}
+	check(c.Audit.MaxSizeMB > 0, "审计日志轮转大小必须大于0: %d", c.Audit.MaxSizeMB)
+	check(c.Audit.Retention >= 0, "审计日志保留时长不能为负数: %s", c.Audit.Retention)
+	check(c.Audit.MaxFiles >= 0, "审计日志保留文件数不能为负数: %d", c.Audit.MaxFiles)
+	check(c.Audit.MaxBodyBytes > 0, "审计日志请求体大小上限必须大于0: %d", c.Audit.MaxBodyBytes)
+	check(c.Replay.Mode == ReplayModeOff || c.Replay.Mode == ReplayModeRecord || c.Replay.Mode == ReplayModeReplay,
+		"无效的录制/回放模式: %s（可选 record, replay）", c.Replay.Mode)
+
+	check(c.Concurrency.MaxPerAccount >= 0, "账户并发上限不能为负数: %d", c.Concurrency.MaxPerAccount)
+	check(c.Concurrency.MaxQueue >= 0, "账户等待队列长度不能为负数: %d", c.Concurrency.MaxQueue)
+	check(c.Concurrency.QueueTimeout > 0, "排队等待时间必须大于0: %s", c.Concurrency.QueueTimeout)
+	for _, account := range sortedKeys(c.Concurrency.Accounts) {
+		check(c.Concurrency.Accounts[account] >= 0, "账户 %s 的并发上限不能为负数: %d", account, c.Concurrency.Accounts[account])
+	}
+	if c.Breaker.Enabled {
+		check(c.Breaker.Window > 0, "熔断统计窗口必须大于0: %s", c.Breaker.Window)
+		check(c.Breaker.MinRequests > 0, "熔断最少请求数必须大于0: %d", c.Breaker.MinRequests)
+		check(c.Breaker.FailureRatio > 0 && c.Breaker.FailureRatio <= 1, "熔断失败率必须在0到1之间: %v", c.Breaker.FailureRatio)
+		check(c.Breaker.Cooldown > 0, "熔断冷却时间必须大于0: %s", c.Breaker.Cooldown)
+	}
+
+	check(c.Notify.Timeout > 0, "通知投递超时必须大于0: %s", c.Notify.Timeout)
+	check(c.Notify.MaxRetries >= 0, "通知重试次数不能为负数: %d", c.Notify.MaxRetries)
+	check(c.Notify.RetryBackoff > 0, "通知重试间隔必须大于0: %s", c.Notify.RetryBackoff)
+	check(c.Notify.DedupeWindow >= 0, "通知去重时间不能为负数: %s", c.Notify.DedupeWindow)
+	for _, name := range sortedKeys(c.Notify.Webhooks) {
+		webhook := c.Notify.Webhooks[name]
+		if webhook == nil {
+			errs = append(errs, fmt.Errorf("webhook %s 配置为空", name))
+			continue
+		}
+		u, err := url.Parse(webhook.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "webhook %s 的地址无效", name)
+		switch webhook.Format {
+		case WebhookFormatJSON, WebhookFormatSlack, WebhookFormatFeishu, WebhookFormatDingTalk:
+		default:
+			errs = append(errs, fmt.Errorf("webhook %s 的格式无效: %s（可选 json, slack, feishu, dingtalk）", name, webhook.Format))
 		}
 	}
-	return defaultValue
-}
 
-func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
+	for _, name := range sortedKeys(c.Proxies) {
+		endpoint := c.Proxies[name]
+		if endpoint == nil {
+			errs = append(errs, fmt.Errorf("命名代理 %s 配置为空", name))
+			continue
 		}
+		errs = append(errs, validateProxy("命名代理 "+name, endpoint.Type, endpoint.Host, endpoint.Port)...)
+	}
+
+	for _, name := range sortedKeys(c.Pools) {
+		pool := c.Pools[name]
+		check(pool != nil && (len(pool.Accounts) > 0 || len(pool.Tags) > 0), "账户池 %s 至少需要配置 accounts 或 tags", name)
+	}
+
+	for _, model := range sortedKeys(c.Pricing) {
+		price := c.Pricing[model]
+		check(price != nil && price.Input >= 0 && price.Output >= 0 && price.CacheWrite >= 0 && price.CacheRead >= 0,
+			"模型 %s 的价格不能为空或负数", model)
 	}
-	return defaultValue
+
+	for _, alias := range sortedKeys(c.ModelAliases) {
+		target := c.ModelAliases[alias]
+		check(target != "" && target != alias, "模型别名 %s 的目标无效: %q", alias, target)
+		_, chained := c.ModelAliases[target]
+		check(target == alias || !chained, "模型别名 %s 指向了另一个别名 %s，不支持多级别名", alias, target)
+	}
+
+	check(c.APIKeys.DefaultTTL >= 0, "API Key默认有效期不能为负数: %s", c.APIKeys.DefaultTTL)
+	check(c.APIKeys.DefaultPool == "" || c.Pools[c.APIKeys.DefaultPool] != nil,
+		"API Key默认账户池不存在: %s", c.APIKeys.DefaultPool)
+
+	return errors.Join(errs...)
 }
 
-// loadGlobalProxyConfig 加载全局代理配置
-func loadGlobalProxyConfig() *GlobalProxyConfig {
-	// 检查是否启用全局代理
-	enabled := getEnvString("GLOBAL_PROXY_ENABLED", "false") == "true"
-	if !enabled {
-		return nil
+// ResolveModel 将模型别名替换为实际模型名，不是别名时原样返回
+func (c *Config) ResolveModel(model string) string {
+	if target, ok := c.ModelAliases[model]; ok {
+		return target
 	}
+	return model
+}
 
-	// 加载代理配置
-	proxyType := getEnvString("GLOBAL_PROXY_TYPE", "")
-	if proxyType == "" {
-		return nil
+// PriceFor 按模型名最长前缀匹配价格，没有匹配时返回nil
+func (c *Config) PriceFor(model string) *ModelPrice {
+	var best string
+	var price *ModelPrice
+	for prefix, p := range c.Pricing {
+		if len(prefix) > len(best) && len(model) >= len(prefix) && model[:len(prefix)] == prefix {
+			best, price = prefix, p
+		}
 	}
+	return price
+}
 
-	host := getEnvString("GLOBAL_PROXY_HOST", "")
+// validateProxy 校验代理参数
+func validateProxy(label, proxyType, host string, port int) []error {
+	var errs []error
+	switch proxyType {
+	case "socks5", "http", "https":
+	default:
+		errs = append(errs, fmt.Errorf("%s: 不支持的代理类型: %q", label, proxyType))
+	}
 	if host == "" {
-		return nil
+		errs = append(errs, fmt.Errorf("%s: 代理地址不能为空", label))
 	}
-
-	port := getEnvInt("GLOBAL_PROXY_PORT", 0)
-	if port <= 0 {
-		return nil
+	if port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("%s: 无效的代理端口: %d", label, port))
 	}
+	return errs
+}
+
+// isAbsoluteURL 是否为带scheme和host的URL
+func isAbsoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
 
-	return &GlobalProxyConfig{
-		Enabled:  true,
-		Type:     proxyType,
-		Host:     host,
-		Port:     port,
-		Username: getEnvString("GLOBAL_PROXY_USERNAME", ""),
-		Password: getEnvString("GLOBAL_PROXY_PASSWORD", ""),
+// sortedKeys 返回排序后的map键，保证错误信息顺序稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-}
\ No newline at end of file
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change 一项配置变化，Path为配置文件中的字段路径（如 claude.timeout）
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// String 以 "路径: 旧值 -> 新值" 的形式展示
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// secretFields 敏感字段，变化时不展示具体值
+var secretFields = map[string]bool{
+	"admin_token": true,
+	"password":    true,
+	"headers":     true,
+	"url":         true, // webhook地址中可能包含令牌
+	"secret":      true,
+}
+
+// restartFields 需要重启才能生效的字段路径前缀：监听地址、数据目录、认证中间件、
+// 回调路由、监控接口、审计日志文件和后台任务间隔在启动时确定
+var restartFields = []string{
+	"server.host",
+	"server.port",
+	"server.data_dir",
+	"server.config_watch_interval",
+	"server.tls.",
+	"server.unix_socket",
+	"auth.",
+	"oauth.loopback_redirect_uri",
+	"oauth.pkce_sweep_interval",
+	"usage.flush_interval",
+	"metrics.",
+	"log.format",
+	"log.access_log",
+	"tracing.",
+	"audit.enabled",
+	"audit.dir",
+}
+
+// RequiresRestart 该字段变化后是否需要重启才能生效
+func (c Change) RequiresRestart() bool {
+	for _, prefix := range restartFields {
+		if strings.HasPrefix(c.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 比较两份配置，按字段路径返回全部变化
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffValue("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), false, &changes)
+	return changes
+}
+
+// diffValue 递归比较结构体、指针和map，叶子字段按展示值比较
+func diffValue(path string, old, new reflect.Value, secret bool, changes *[]Change) {
+	switch old.Kind() {
+	case reflect.Struct:
+		for i := 0; i < old.NumField(); i++ {
+			name := fieldName(old.Type().Field(i))
+			diffValue(joinPath(path, name), old.Field(i), new.Field(i), secret || secretFields[name], changes)
+		}
+		return
+	case reflect.Pointer:
+		if old.IsNil() || new.IsNil() {
+			if old.IsNil() != new.IsNil() {
+				*changes = append(*changes, Change{Path: path, Old: formatPointer(old), New: formatPointer(new)})
+			}
+			return
+		}
+		diffValue(path, old.Elem(), new.Elem(), secret, changes)
+		return
+	case reflect.Map:
+		keys := make(map[string]bool)
+		for _, key := range old.MapKeys() {
+			keys[key.String()] = true
+		}
+		for _, key := range new.MapKeys() {
+			keys[key.String()] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			oldItem := old.MapIndex(reflect.ValueOf(key))
+			newItem := new.MapIndex(reflect.ValueOf(key))
+			switch {
+			case !oldItem.IsValid():
+				*changes = append(*changes, Change{Path: joinPath(path, key), Old: "(无)", New: "(新增)"})
+			case !newItem.IsValid():
+				*changes = append(*changes, Change{Path: joinPath(path, key), Old: "(已有)", New: "(删除)"})
+			default:
+				diffValue(joinPath(path, key), oldItem, newItem, secret, changes)
+			}
+		}
+		return
+	}
+
+	oldText, newText := fmt.Sprintf("%v", old.Interface()), fmt.Sprintf("%v", new.Interface())
+	if oldText == newText {
+		return
+	}
+	if secret {
+		oldText, newText = maskSecret(oldText), maskSecret(newText)+"(已修改)"
+	}
+	*changes = append(*changes, Change{Path: path, Old: oldText, New: newText})
+}
+
+// fieldName 字段在配置文件中的名称
+func fieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// maskSecret 隐藏敏感值，只展示是否为空
+func maskSecret(value string) string {
+	if value == "" {
+		return "(空)"
+	}
+	return "***"
+}
+
+// formatPointer 展示指针字段是否配置
+func formatPointer(v reflect.Value) string {
+	if v.IsNil() {
+		return "(无)"
+	}
+	return "(已配置)"
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
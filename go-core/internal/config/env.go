@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envParser 按环境变量覆盖配置，记录解析失败的变量
+type envParser struct {
+	errs []error
+}
+
+// applyEnv 用已设置的环境变量覆盖配置，返回无法解析的变量
+func applyEnv(c *Config) []error {
+	p := &envParser{}
+
+	p.int(&c.Server.Port, "PORT")
+	p.string(&c.Server.Host, "HOST")
+	p.string(&c.Server.DataDir, "DATA_DIR")
+	p.duration(&c.Server.ConfigWatchInterval, "CONFIG_WATCH_INTERVAL")
+	p.duration(&c.Server.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	p.string(&c.Server.TLS.CertFile, "TLS_CERT_FILE")
+	p.string(&c.Server.TLS.KeyFile, "TLS_KEY_FILE")
+	p.string(&c.Server.TLS.ClientCAFile, "TLS_CLIENT_CA_FILE")
+	p.string(&c.Server.UnixSocket, "UNIX_SOCKET")
+	p.string(&c.Server.UnixSocketMode, "UNIX_SOCKET_MODE")
+
+	p.string(&c.OAuth.ClientID, "OAUTH_CLIENT_ID")
+	p.string(&c.OAuth.AuthorizeURL, "OAUTH_AUTHORIZE_URL")
+	p.string(&c.OAuth.TokenURL, "OAUTH_TOKEN_URL")
+	p.string(&c.OAuth.RedirectURI, "OAUTH_REDIRECT_URI")
+	p.string(&c.OAuth.Scopes, "OAUTH_SCOPES")
+	p.string(&c.OAuth.ProfileURL, "OAUTH_PROFILE_URL")
+	p.string(&c.OAuth.CallbackMode, "OAUTH_CALLBACK_MODE")
+	p.string(&c.OAuth.LoopbackRedirectURI, "OAUTH_LOOPBACK_REDIRECT_URI")
+	p.duration(&c.OAuth.PKCETTL, "OAUTH_PKCE_TTL")
+	p.duration(&c.OAuth.PKCESweepInterval, "OAUTH_PKCE_SWEEP_INTERVAL")
+
+	p.string(&c.Claude.APIUrl, "CLAUDE_API_URL")
+	p.string(&c.Claude.APIVersion, "CLAUDE_API_VERSION")
+	p.string(&c.Claude.BetaHeader, "CLAUDE_BETA_HEADER")
+	p.duration(&c.Claude.Timeout, "CLAUDE_TIMEOUT")
+
+	p.duration(&c.Proxy.Timeout, "PROXY_TIMEOUT")
+	p.int(&c.Proxy.MaxRetries, "PROXY_MAX_RETRIES")
+	p.globalProxy(c)
+
+	p.string(&c.Auth.AdminToken, "ADMIN_TOKEN")
+	p.bool(&c.Auth.RequireAPIKey, "REQUIRE_API_KEY")
+
+	p.duration(&c.Usage.FlushInterval, "USAGE_FLUSH_INTERVAL")
+	p.bool(&c.Metrics.Enabled, "METRICS_ENABLED")
+	p.string(&c.Metrics.Path, "METRICS_PATH")
+	p.bool(&c.Metrics.RequireAuth, "METRICS_REQUIRE_AUTH")
+	p.string(&c.Log.Level, "LOG_LEVEL")
+	p.string(&c.Log.Format, "LOG_FORMAT")
+	p.bool(&c.Log.AccessLog, "LOG_ACCESS")
+	p.bool(&c.Tracing.Enabled, "TRACING_ENABLED")
+	p.string(&c.Tracing.Endpoint, "TRACING_ENDPOINT")
+	p.float(&c.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO")
+	p.string(&c.Tracing.ServiceName, "TRACING_SERVICE_NAME")
+	p.bool(&c.Audit.Enabled, "AUDIT_ENABLED")
+	p.string(&c.Audit.Dir, "AUDIT_DIR")
+	p.int(&c.Audit.MaxSizeMB, "AUDIT_MAX_SIZE_MB")
+	p.duration(&c.Audit.Retention, "AUDIT_RETENTION")
+	p.int(&c.Audit.MaxFiles, "AUDIT_MAX_FILES")
+	p.bool(&c.Audit.IncludeBodies, "AUDIT_INCLUDE_BODIES")
+	p.int(&c.Audit.MaxBodyBytes, "AUDIT_MAX_BODY_BYTES")
+	p.string(&c.Replay.Mode, "REPLAY_MODE")
+	p.string(&c.Replay.Dir, "REPLAY_DIR")
+	p.bool(&c.Replay.Realtime, "REPLAY_REALTIME")
+	p.bool(&c.Scheduler.OpusPreferHigherTier, "SCHEDULER_OPUS_PREFER_HIGHER_TIER")
+	p.int(&c.Concurrency.MaxPerAccount, "CONCURRENCY_MAX_PER_ACCOUNT")
+	p.int(&c.Concurrency.MaxQueue, "CONCURRENCY_MAX_QUEUE")
+	p.duration(&c.Concurrency.QueueTimeout, "CONCURRENCY_QUEUE_TIMEOUT")
+	p.bool(&c.Concurrency.Spillover, "CONCURRENCY_SPILLOVER")
+	p.bool(&c.Breaker.Enabled, "CIRCUIT_BREAKER_ENABLED")
+	p.duration(&c.Breaker.Window, "CIRCUIT_BREAKER_WINDOW")
+	p.int(&c.Breaker.MinRequests, "CIRCUIT_BREAKER_MIN_REQUESTS")
+	p.float(&c.Breaker.FailureRatio, "CIRCUIT_BREAKER_FAILURE_RATIO")
+	p.duration(&c.Breaker.Cooldown, "CIRCUIT_BREAKER_COOLDOWN")
+	p.duration(&c.Notify.Timeout, "NOTIFY_TIMEOUT")
+	p.int(&c.Notify.MaxRetries, "NOTIFY_MAX_RETRIES")
+	p.duration(&c.Notify.RetryBackoff, "NOTIFY_RETRY_BACKOFF")
+	p.duration(&c.Notify.DedupeWindow, "NOTIFY_DEDUPE_WINDOW")
+	p.string(&c.Notify.DeadLetterFile, "NOTIFY_DEAD_LETTER_FILE")
+	p.webhook(c)
+
+	p.duration(&c.APIKeys.DefaultTTL, "API_KEY_DEFAULT_TTL")
+	p.string(&c.APIKeys.DefaultPool, "API_KEY_DEFAULT_POOL")
+
+	return p.errs
+}
+
+// globalProxy 全局代理环境变量：设置了任一 GLOBAL_PROXY_* 变量时覆盖对应字段
+func (p *envParser) globalProxy(c *Config) {
+	keys := []string{
+		"GLOBAL_PROXY_ENABLED", "GLOBAL_PROXY_NAME", "GLOBAL_PROXY_TYPE", "GLOBAL_PROXY_HOST",
+		"GLOBAL_PROXY_PORT", "GLOBAL_PROXY_USERNAME", "GLOBAL_PROXY_PASSWORD",
+	}
+	set := false
+	for _, key := range keys {
+		if os.Getenv(key) != "" {
+			set = true
+		}
+	}
+	if !set {
+		return
+	}
+
+	if c.Proxy.GlobalProxy == nil {
+		c.Proxy.GlobalProxy = &GlobalProxyConfig{}
+	}
+	global := c.Proxy.GlobalProxy
+	p.bool(&global.Enabled, "GLOBAL_PROXY_ENABLED")
+	p.string(&global.Proxy, "GLOBAL_PROXY_NAME")
+	p.string(&global.Type, "GLOBAL_PROXY_TYPE")
+	p.string(&global.Host, "GLOBAL_PROXY_HOST")
+	p.int(&global.Port, "GLOBAL_PROXY_PORT")
+	p.string(&global.Username, "GLOBAL_PROXY_USERNAME")
+	p.string(&global.Password, "GLOBAL_PROXY_PASSWORD")
+}
+
+// webhook 通过 NOTIFY_WEBHOOK_* 变量配置名为 default 的webhook，设置了URL时生效
+func (p *envParser) webhook(c *Config) {
+	url := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+
+	if c.Notify.Webhooks == nil {
+		c.Notify.Webhooks = make(map[string]*WebhookConfig)
+	}
+	webhook := c.Notify.Webhooks["default"]
+	if webhook == nil {
+		webhook = &WebhookConfig{}
+		c.Notify.Webhooks["default"] = webhook
+	}
+	webhook.URL = url
+	p.string(&webhook.Secret, "NOTIFY_WEBHOOK_SECRET")
+	p.string(&webhook.Format, "NOTIFY_WEBHOOK_FORMAT")
+	if events := os.Getenv("NOTIFY_WEBHOOK_EVENTS"); events != "" {
+		webhook.Events = nil
+		for _, event := range strings.Split(events, ",") {
+			if event = strings.TrimSpace(event); event != "" {
+				webhook.Events = append(webhook.Events, event)
+			}
+		}
+	}
+}
+
+func (p *envParser) string(target *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*target = value
+	}
+}
+
+func (p *envParser) int(target *int, key string) {
+	if value := os.Getenv(key); value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("环境变量 %s 不是有效的整数: %q", key, value))
+			return
+		}
+		*target = intValue
+	}
+}
+
+func (p *envParser) float(target *float64, key string) {
+	if value := os.Getenv(key); value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("环境变量 %s 不是有效的数字: %q", key, value))
+			return
+		}
+		*target = floatValue
+	}
+}
+
+func (p *envParser) bool(target *bool, key string) {
+	if value := os.Getenv(key); value != "" {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("环境变量 %s 不是有效的布尔值: %q", key, value))
+			return
+		}
+		*target = boolValue
+	}
+}
+
+func (p *envParser) duration(target *time.Duration, key string) {
+	if value := os.Getenv(key); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			p.errs = append(p.errs, fmt.Errorf("环境变量 %s 不是有效的时长: %q", key, value))
+			return
+		}
+		*target = duration
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile 读取配置文件并覆盖到config上，按扩展名识别格式：
+// .yaml/.yml 和 .json 按YAML解析（JSON是YAML的子集），.toml 先转换为通用结构再解析。
+// 文件中出现未知字段时报错，避免拼写错误被静默忽略
+func loadFile(path string, config *Config) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	case ".toml":
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("解析TOML配置文件失败: %w", err)
+		}
+		if raw, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("转换TOML配置文件失败: %w", err)
+		}
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s（支持 .yaml、.yml、.toml、.json）", ext)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) { // 空文件视为没有配置
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
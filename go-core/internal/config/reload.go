@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader 配置热更新：配置文件变化或收到SIGHUP时重新加载，
+// 新配置通过验证后整体替换并通知订阅者，验证失败时保留当前配置
+type Reloader struct {
+	opts LoadOptions
+
+	current atomic.Pointer[Config]
+
+	mu          sync.Mutex // 串行化重新加载
+	modTime     time.Time
+	size        int64
+	subscribers []func(*Config)
+}
+
+// NewReloader 创建配置热更新器，opts应与加载初始配置时一致，
+// 命令行参数覆盖在每次重新加载时都会重新应用
+func NewReloader(opts LoadOptions, cfg *Config) *Reloader {
+	if opts.File == "" {
+		opts.File = os.Getenv("CONFIG_FILE")
+	}
+
+	r := &Reloader{opts: opts}
+	r.current.Store(cfg)
+	r.modTime, r.size = r.stat()
+	return r
+}
+
+// Current 返回当前生效的配置
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// File 监听的配置文件路径，为空表示没有配置文件
+func (r *Reloader) File() string {
+	return r.opts.File
+}
+
+// OnReload 注册配置替换后的回调
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Reload 重新加载配置，返回生效的变化
+func (r *Reloader) Reload() ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modTime, r.size = r.stat()
+
+	cfg, err := LoadWithOptions(r.opts)
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用当前配置", "error", err)
+		return nil, err
+	}
+
+	changes := Diff(r.Current(), cfg)
+	if len(changes) == 0 {
+		slog.Info("配置已重新加载，没有变化")
+		return nil, nil
+	}
+
+	r.current.Store(cfg)
+	for _, fn := range r.subscribers {
+		fn(cfg)
+	}
+
+	slog.Info("配置已重新加载", "changes", len(changes))
+	for _, change := range changes {
+		slog.Info("配置变化", "path", change.Path, "old", change.Old, "new", change.New,
+			"requires_restart", change.RequiresRestart())
+	}
+	return changes, nil
+}
+
+// Watch 定期检查配置文件的修改时间和大小，变化时重新加载，直到ctx取消。
+// 没有配置文件或间隔不大于0时不检查
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if r.opts.File == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.changed() {
+				r.Reload()
+			}
+		}
+	}
+}
+
+// changed 配置文件是否在上次加载后发生变化
+func (r *Reloader) changed() bool {
+	modTime, size := r.stat()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !modTime.Equal(r.modTime) || size != r.size
+}
+
+// stat 配置文件的修改时间和大小，读取失败（如编辑器替换文件的间隙）时返回零值
+func (r *Reloader) stat() (time.Time, int64) {
+	if r.opts.File == "" {
+		return time.Time{}, 0
+	}
+	info, err := os.Stat(r.opts.File)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,254 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/metrics"
+	"claude-relay-core/internal/oauth"
+)
+
+// Status 检查结果
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// 组件名称
+const (
+	ComponentStorage  = "storage"
+	ComponentAccounts = "accounts"
+	ComponentProxies  = "proxies"
+)
+
+// proxyDialTimeout 探测单个代理的超时
+const proxyDialTimeout = 3 * time.Second
+
+// Component 单个组件的检查结果
+type Component struct {
+	Name       string `json:"name"`
+	Status     Status `json:"status"`
+	Message    string `json:"message,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Details    any    `json:"details,omitempty"`
+}
+
+// Report 就绪检查报告，所有组件正常时为ok
+type Report struct {
+	Status     Status      `json:"status"`
+	Components []Component `json:"components"`
+}
+
+// Ready 是否可以接收请求
+func (r *Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// AccountStatus 账户检查结果
+type AccountStatus struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Usable bool   `json:"usable"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ProxyStatus 代理检查结果
+type ProxyStatus struct {
+	Proxy     string   `json:"proxy"`
+	Accounts  []string `json:"accounts,omitempty"` // 使用该代理的账户，全局代理为空
+	Global    bool     `json:"global,omitempty"`
+	Reachable bool     `json:"reachable"`
+	LatencyMS int64    `json:"latency_ms,omitempty"`
+	Error     string   `json:"error,omitempty"`
+
+	addr string
+}
+
+// AccountStorage 检查所需的账户存储
+type AccountStorage interface {
+	ListAccounts() ([]*oauth.AccountInfo, error)
+	LoadOAuthData(accountRef string) (*oauth.OAuthData, error)
+}
+
+// Checker 就绪检查：存储可读、至少一个账户可用、正在使用的代理可连接
+type Checker struct {
+	config  func() *config.Config
+	storage AccountStorage
+}
+
+// NewChecker 创建就绪检查，cfg返回当前生效的配置
+func NewChecker(cfg func() *config.Config, storage AccountStorage) *Checker {
+	return &Checker{config: cfg, storage: storage}
+}
+
+// Check 检查所有组件
+func (c *Checker) Check(ctx context.Context) *Report {
+	start := time.Now()
+	accounts, err := c.loadAccounts()
+	storage := Component{Name: ComponentStorage, Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		storage.Status, storage.Message = StatusFail, err.Error()
+	} else {
+		storage.Details = map[string]int{"accounts": len(accounts)}
+	}
+
+	report := &Report{Status: StatusOK, Components: []Component{
+		storage,
+		checkAccounts(accounts, err),
+		c.checkProxies(ctx, accounts),
+	}}
+	for _, component := range report.Components {
+		if component.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// loadAccounts 读取全部账户数据
+func (c *Checker) loadAccounts() ([]*oauth.OAuthData, error) {
+	infos, err := c.storage.ListAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("读取账户列表失败: %w", err)
+	}
+
+	accounts := make([]*oauth.OAuthData, 0, len(infos))
+	for _, info := range infos {
+		data, err := c.storage.LoadOAuthData(info.ID)
+		if err != nil {
+			return nil, fmt.Errorf("读取账户 %s 失败: %w", info.Name, err)
+		}
+		accounts = append(accounts, data)
+	}
+	return accounts, nil
+}
+
+// checkAccounts 至少一个账户可用：未禁用、未被隔离，且token有效或可以刷新
+func checkAccounts(accounts []*oauth.OAuthData, storageErr error) Component {
+	component := Component{Name: ComponentAccounts, Status: StatusFail}
+	if storageErr != nil {
+		component.Message = "存储不可读"
+		return component
+	}
+
+	statuses := make([]AccountStatus, 0, len(accounts))
+	usable := 0
+	for _, account := range accounts {
+		status := AccountStatus{ID: account.ID, Name: account.Name, Status: account.Status()}
+		switch {
+		case account.Disabled:
+			status.Reason = "账户已禁用"
+		case account.Quarantine != nil:
+			status.Reason = "凭据已失效，需要重新授权: " + account.Quarantine.Message
+		case !account.IsValid() && account.RefreshToken == "":
+			status.Reason = "token已过期且没有refresh token"
+		default:
+			status.Usable = true
+			usable++
+		}
+		statuses = append(statuses, status)
+	}
+
+	component.Details = statuses
+	if usable == 0 {
+		component.Message = "没有可用的账户"
+		return component
+	}
+	component.Status = StatusOK
+	component.Message = fmt.Sprintf("%d/%d 个账户可用", usable, len(accounts))
+	return component
+}
+
+// checkProxies 探测正在使用的代理：启用全局代理时只检查全局代理，否则检查可用账户绑定的代理
+func (c *Checker) checkProxies(ctx context.Context, accounts []*oauth.OAuthData) Component {
+	start := time.Now()
+	proxies := c.proxiesInUse(accounts)
+
+	var wg sync.WaitGroup
+	for _, status := range proxies {
+		wg.Add(1)
+		go func(status *ProxyStatus) {
+			defer wg.Done()
+			probeProxy(ctx, status)
+		}(status)
+	}
+	wg.Wait()
+
+	component := Component{Name: ComponentProxies, Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	if len(proxies) == 0 {
+		component.Message = "未使用代理"
+		return component
+	}
+
+	details := make([]ProxyStatus, 0, len(proxies))
+	failed := 0
+	for _, status := range proxies {
+		if !status.Reachable {
+			failed++
+		}
+		details = append(details, *status)
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Proxy < details[j].Proxy })
+
+	component.Details = details
+	if failed > 0 {
+		component.Status = StatusFail
+		component.Message = fmt.Sprintf("%d/%d 个代理无法连接", failed, len(details))
+	}
+	return component
+}
+
+// proxiesInUse 按地址去重的代理列表
+func (c *Checker) proxiesInUse(accounts []*oauth.OAuthData) map[string]*ProxyStatus {
+	proxies := make(map[string]*ProxyStatus)
+
+	if global := c.config().Proxy.GlobalProxy; global != nil && global.Enabled {
+		label, addr := proxyAddress(global.Type, global.Host, global.Port)
+		proxies[label] = &ProxyStatus{Proxy: label, Global: true, addr: addr}
+		return proxies
+	}
+
+	for _, account := range accounts {
+		if account.Disabled || account.ProxyConfig == nil {
+			continue
+		}
+		label, addr := proxyAddress(account.ProxyConfig.Type, account.ProxyConfig.Host, account.ProxyConfig.Port)
+		status, ok := proxies[label]
+		if !ok {
+			status = &ProxyStatus{Proxy: label, addr: addr}
+			proxies[label] = status
+		}
+		status.Accounts = append(status.Accounts, account.Name)
+	}
+	return proxies
+}
+
+// probeProxy 建立到代理的TCP连接
+func probeProxy(ctx context.Context, status *ProxyStatus) {
+	start := time.Now()
+	dialer := net.Dialer{Timeout: proxyDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", status.addr)
+	metrics.ProxyResult(status.Proxy, err)
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+	conn.Close()
+	status.Reachable = true
+	status.LatencyMS = time.Since(start).Milliseconds()
+}
+
+// proxyAddress 代理的展示标签（不含认证信息，与监控指标中的代理标签一致）和连接地址
+func proxyAddress(proxyType, host string, port int) (string, string) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return proxyType + "://" + addr, addr
+}
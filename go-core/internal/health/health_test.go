@@ -0,0 +1,168 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/oauth"
+)
+
+// fakeStorage 内存中的账户存储，err不为空时读取失败
+type fakeStorage struct {
+	accounts []*oauth.OAuthData
+	err      error
+}
+
+func (s *fakeStorage) ListAccounts() ([]*oauth.AccountInfo, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	infos := make([]*oauth.AccountInfo, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		infos = append(infos, account.Info())
+	}
+	return infos, nil
+}
+
+func (s *fakeStorage) LoadOAuthData(accountRef string) (*oauth.OAuthData, error) {
+	for _, account := range s.accounts {
+		if account.ID == accountRef {
+			return account, nil
+		}
+	}
+	return nil, oauth.ErrAccountNotFound
+}
+
+// proxyAt 指向本地端口的代理配置
+func proxyAt(t *testing.T, addr string) *oauth.ProxyConfig {
+	host, port, _ := net.SplitHostPort(addr)
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("解析端口失败: %v", err)
+	}
+	return &oauth.ProxyConfig{Type: "socks5", Host: host, Port: p}
+}
+
+// listen 可连接的代理地址
+func listen(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+// closedAddr 无法连接的代理地址
+func closedAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func account(id, name string, modify func(a *oauth.OAuthData)) *oauth.OAuthData {
+	a := &oauth.OAuthData{ID: id, Name: name, AccessToken: "access", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}
+	if modify != nil {
+		modify(a)
+	}
+	return a
+}
+
+func component(t *testing.T, report *Report, name string) Component {
+	t.Helper()
+	for _, c := range report.Components {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("报告中缺少组件 %s: %+v", name, report)
+	return Component{}
+}
+
+func check(storage AccountStorage, cfg *config.Config) *Report {
+	return NewChecker(func() *config.Config { return cfg }, storage).Check(context.Background())
+}
+
+func TestCheckReady(t *testing.T) {
+	up := listen(t)
+	storage := &fakeStorage{accounts: []*oauth.OAuthData{
+		account("acct_1", "alice", func(a *oauth.OAuthData) { a.ProxyConfig = proxyAt(t, up) }),
+		account("acct_2", "bob", func(a *oauth.OAuthData) { a.ProxyConfig = proxyAt(t, up) }),
+		account("acct_3", "carol", func(a *oauth.OAuthData) { a.Disabled = true }),
+	}}
+
+	report := check(storage, config.Default())
+	if !report.Ready() {
+		t.Fatalf("有可用账户且代理可连接时应就绪: %+v", report)
+	}
+	accounts := component(t, report, ComponentAccounts)
+	if accounts.Message != "2/3 个账户可用" {
+		t.Errorf("账户检查结果不正确: %+v", accounts)
+	}
+	proxies := component(t, report, ComponentProxies).Details.([]ProxyStatus)
+	if len(proxies) != 1 || len(proxies[0].Accounts) != 2 || !proxies[0].Reachable {
+		t.Errorf("相同地址的代理应合并检查: %+v", proxies)
+	}
+}
+
+func TestCheckNoUsableAccount(t *testing.T) {
+	storage := &fakeStorage{accounts: []*oauth.OAuthData{
+		account("acct_1", "alice", func(a *oauth.OAuthData) { a.Disabled = true }),
+		account("acct_2", "bob", func(a *oauth.OAuthData) {
+			a.Quarantine = &oauth.Quarantine{Reason: "token_revoked", Message: "revoked", At: time.Now()}
+		}),
+		account("acct_3", "carol", func(a *oauth.OAuthData) {
+			a.RefreshToken = ""
+			a.ExpiresAt = time.Now().Add(-time.Hour)
+		}),
+	}}
+
+	report := check(storage, config.Default())
+	if report.Ready() {
+		t.Fatalf("没有可用账户时不应就绪")
+	}
+	statuses := component(t, report, ComponentAccounts).Details.([]AccountStatus)
+	for _, status := range statuses {
+		if status.Usable || status.Reason == "" {
+			t.Errorf("账户 %s 不可用时应说明原因: %+v", status.Name, status)
+		}
+	}
+	if component(t, report, ComponentProxies).Status != StatusOK {
+		t.Errorf("未使用代理时代理检查应通过")
+	}
+}
+
+func TestCheckStorageAndProxyFailure(t *testing.T) {
+	report := check(&fakeStorage{err: errors.New("磁盘不可读")}, config.Default())
+	if report.Ready() || component(t, report, ComponentStorage).Status != StatusFail ||
+		component(t, report, ComponentAccounts).Status != StatusFail {
+		t.Errorf("存储不可读时应不就绪: %+v", report)
+	}
+
+	// 启用全局代理时只检查全局代理
+	down := closedAddr(t)
+	host, port, _ := net.SplitHostPort(down)
+	cfg := config.Default()
+	cfg.Proxy.GlobalProxy = &config.GlobalProxyConfig{Enabled: true, Type: "http", Host: host}
+	cfg.Proxy.GlobalProxy.Port, _ = strconv.Atoi(port)
+	storage := &fakeStorage{accounts: []*oauth.OAuthData{
+		account("acct_1", "alice", func(a *oauth.OAuthData) { a.ProxyConfig = proxyAt(t, listen(t)) }),
+	}}
+
+	report = check(storage, cfg)
+	proxies := component(t, report, ComponentProxies)
+	details := proxies.Details.([]ProxyStatus)
+	if report.Ready() || proxies.Status != StatusFail || len(details) != 1 || !details[0].Global ||
+		details[0].Proxy != "http://"+down || details[0].Error == "" {
+		t.Errorf("全局代理无法连接时应不就绪: %+v", proxies)
+	}
+}
@@ -0,0 +1,80 @@
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"claude-relay-core/internal/config"
+)
+
+// Listener 一个监听地址及其展示用的URL
+type Listener struct {
+	net.Listener
+	URL string
+}
+
+// Listen 按服务器配置创建监听器：host:port（配置证书时为HTTPS），以及可选的Unix socket
+func Listen(cfg config.ServerConfig) ([]*Listener, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听 %s 失败: %w", addr, err)
+	}
+
+	listeners := []*Listener{{Listener: tcp, URL: "http://" + addr}}
+	if cfg.TLS.Enabled() {
+		reloader, err := NewCertReloader(cfg.TLS)
+		if err != nil {
+			tcp.Close()
+			return nil, err
+		}
+		listeners[0] = &Listener{Listener: tls.NewListener(tcp, reloader.TLSConfig()), URL: "https://" + addr}
+	}
+
+	if cfg.UnixSocket != "" {
+		unix, err := listenUnix(cfg)
+		if err != nil {
+			tcp.Close()
+			return nil, err
+		}
+		listeners = append(listeners, &Listener{Listener: unix, URL: "unix://" + cfg.UnixSocket})
+	}
+	return listeners, nil
+}
+
+// listenUnix 监听Unix socket：清理上次异常退出残留的socket文件（仍有进程在监听时报错），并设置文件权限
+func listenUnix(cfg config.ServerConfig) (net.Listener, error) {
+	mode, err := cfg.SocketMode()
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(cfg.UnixSocket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Unix socket路径已存在且不是socket: %s", cfg.UnixSocket)
+		}
+		if conn, err := net.Dial("unix", cfg.UnixSocket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Unix socket %s 已被其他进程监听", cfg.UnixSocket)
+		}
+		if err := os.Remove(cfg.UnixSocket); err != nil {
+			return nil, fmt.Errorf("清理残留的Unix socket失败: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("检查Unix socket路径失败: %w", err)
+	}
+
+	ln, err := net.Listen("unix", cfg.UnixSocket)
+	if err != nil {
+		return nil, fmt.Errorf("监听Unix socket %s 失败: %w", cfg.UnixSocket, err)
+	}
+	if err := os.Chmod(cfg.UnixSocket, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("设置Unix socket权限失败: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,122 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/config"
+)
+
+// CertReloader 按文件修改时间自动重新加载TLS证书和客户端CA，
+// 证书续期后新连接直接使用新证书，无需重启
+type CertReloader struct {
+	config config.TLSConfig
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	caPool  *x509.CertPool
+	caMod   time.Time
+}
+
+// NewCertReloader 加载证书，文件无效时返回错误
+func NewCertReloader(cfg config.TLSConfig) (*CertReloader, error) {
+	c := &CertReloader{config: cfg}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TLSConfig 返回服务端TLS配置，配置了客户端CA时要求并验证客户端证书
+func (c *CertReloader) TLSConfig() *tls.Config {
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: c.getCertificate,
+	}
+	if c.config.ClientCAFile != "" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.reloadIfChanged()
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			clientConfig := tlsConfig.Clone()
+			clientConfig.GetConfigForClient = nil
+			clientConfig.ClientCAs = c.caPool
+			return clientConfig, nil
+		}
+	}
+	return tlsConfig
+}
+
+// getCertificate 握手时返回当前证书
+func (c *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.reloadIfChanged()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
+
+// reloadIfChanged 文件有变化时重新加载，失败时继续使用旧证书
+func (c *CertReloader) reloadIfChanged() {
+	c.mu.Lock()
+	changed := modTime(c.config.CertFile) != c.certMod || modTime(c.config.KeyFile) != c.keyMod ||
+		(c.config.ClientCAFile != "" && modTime(c.config.ClientCAFile) != c.caMod)
+	c.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if err := c.reload(); err != nil {
+		slog.Warn("重新加载TLS证书失败，继续使用旧证书", "error", err)
+		return
+	}
+	slog.Info("TLS证书已重新加载", "cert_file", c.config.CertFile)
+}
+
+// reload 读取证书、私钥和客户端CA
+func (c *CertReloader) reload() error {
+	certMod, keyMod := modTime(c.config.CertFile), modTime(c.config.KeyFile)
+	cert, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("加载TLS证书失败: %w", err)
+	}
+
+	var caPool *x509.CertPool
+	var caMod time.Time
+	if c.config.ClientCAFile != "" {
+		caMod = modTime(c.config.ClientCAFile)
+		pem, err := os.ReadFile(c.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("读取客户端CA失败: %w", err)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("客户端CA文件中没有有效的证书: %s", c.config.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert, c.certMod, c.keyMod = &cert, certMod, keyMod
+	c.caPool, c.caMod = caPool, caMod
+	return nil
+}
+
+// modTime 文件修改时间，读取失败时返回零值
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"claude-relay-core/internal/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// level 当前日志级别，配置热更新时直接调整，无需重建logger
+var level = new(slog.LevelVar)
+
+// Setup 按配置创建日志输出并设为默认logger（标准库 log 包的输出也会经过它）
+func Setup(w io.Writer, cfg config.LogConfig) error {
+	logger, err := New(w, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New 创建logger：输出JSON或文本，自动附加请求ID并脱敏
+func New(w io.Writer, cfg config.LogConfig) (*slog.Logger, error) {
+	if err := SetLevel(cfg); err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if cfg.Format == config.LogFormatText {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// SetLevel 调整日志级别（配置热更新时调用）
+func SetLevel(cfg config.LogConfig) error {
+	l, err := cfg.SlogLevel()
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// contextHandler 从context中读取请求ID和链路追踪ID附加到日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
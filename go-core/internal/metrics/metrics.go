@@ -0,0 +1,341 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "claude_relay"
+
+// UnknownAccount 无法确定账户ID时（如账户不存在）使用的账户标签值，避免客户端传入的账户名成为标签
+const UnknownAccount = "unknown"
+
+// 上游错误类型
+const (
+	ErrorNetwork        = "network"               // 连接失败、超时等
+	ErrorRateLimit      = "rate_limit"            // 429或响应提示限流
+	ErrorAuth           = "auth"                  // 401，OAuth token无效或已被吊销
+	ErrorPermission     = "permission"            // 403，账户没有权限
+	ErrorOrgDisabled    = "organization_disabled" // 账户所属组织被禁用
+	ErrorInvalidRequest = "invalid_request"       // 请求本身有误（400/404/413等），与账户无关
+	ErrorClient         = "client_error"          // 其他4xx
+	ErrorServer         = "server_error"          // 5xx
+	ErrorOverloaded     = "overloaded"            // 529
+	ErrorToken          = "token"                 // 获取或刷新token失败
+	ErrorInvalidBody    = "invalid_body"          // 响应无法解析
+)
+
+// 账户排队被拒绝的原因
+const (
+	QueueFull     = "queue_full" // 等待队列已满
+	QueueTimeout  = "timeout"    // 排队超时
+	QueueCanceled = "canceled"   // 排队期间客户端断开
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP请求数，按路由、方法和状态码统计",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP请求耗时，按路由、方法和状态码统计",
+		Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"route", "method", "status"})
+
+	relayRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "转发到Claude API的请求数，按模型、账户和结果统计",
+	}, []string{"model", "account", "status"})
+
+	relayDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "转发请求耗时（含token刷新），按模型、账户和结果统计",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "account", "status"})
+
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "上游错误数，按账户和错误类型统计",
+	}, []string{"account", "type"})
+
+	tokensUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "token用量，按模型、账户和类型（input, output, cache_write, cache_read）统计",
+	}, []string{"model", "account", "type"})
+
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "账户token刷新次数，按账户和结果统计",
+	}, []string{"account", "result"})
+
+	oauthRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oauth_requests_total",
+		Help:      "OAuth接口请求数，按操作（exchange, refresh, profile）和结果统计",
+	}, []string{"operation", "result"})
+
+	oauthDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "oauth_request_duration_seconds",
+		Help:      "OAuth接口请求耗时，按操作统计",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	inflightRelays = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_relays",
+		Help:      "正在转发（含等待上游响应和传输响应体）的请求数，按账户统计",
+	}, []string{"account"})
+
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "account_queue_depth",
+		Help:      "因账户达到并发上限而排队等待的请求数，按账户统计",
+	}, []string{"account"})
+
+	queueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "account_queue_wait_seconds",
+		Help:      "请求等待账户并发名额的时间（不排队的请求记为0），按账户统计",
+		Buckets:   []float64{0, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"account"})
+
+	queueRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "account_queue_rejected_total",
+		Help:      "因账户并发已满被拒绝的请求数，按账户和原因（queue_full, timeout, canceled）统计",
+	}, []string{"account", "reason"})
+
+	circuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_state",
+		Help:      "熔断状态（0关闭，1半开，2熔断），kind为account（name为账户ID）或egress（name为代理地址或direct）",
+	}, []string{"kind", "name"})
+
+	circuitTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_transitions_total",
+		Help:      "熔断状态变化次数，按类型和变化后的状态统计",
+	}, []string{"kind", "state"})
+
+	quarantines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "account_quarantines_total",
+		Help:      "账户因凭据失效被隔离的次数，按账户和原因（token_revoked, refresh_rejected, organization_disabled）统计",
+	}, []string{"account", "reason"})
+
+	notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "事件通知投递结果，按webhook和结果（delivered, dead_letter）统计",
+	}, []string{"webhook", "result"})
+
+	notificationsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_dropped_total",
+		Help:      "通知队列已满时丢弃的事件数",
+	})
+
+	rateLimited = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "account_rate_limited",
+		Help:      "账户最近一次请求是否被限流（1为限流中）",
+	}, []string{"account"})
+
+	rateLimitReset = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "account_rate_limit_reset_timestamp_seconds",
+		Help:      "账户限流预计解除的时间（Unix秒），取自上游的 retry-after",
+	}, []string{"account"})
+
+	proxyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "proxy_up",
+		Help:      "代理最近一次使用或探测是否成功（1为可用）",
+	}, []string{"proxy"})
+
+	proxyErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_errors_total",
+		Help:      "经代理连接失败的次数",
+	}, []string{"proxy"})
+)
+
+// Handler Prometheus抓取接口
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware 统计HTTP请求数和耗时，路由取注册的路径模板，未匹配的路由统一记为 unmatched
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		httpDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveRelay 记录一次转发请求的结果和耗时
+func ObserveRelay(model, account string, start time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	model = ModelLabel(model)
+	relayRequests.WithLabelValues(model, account, status).Inc()
+	relayDuration.WithLabelValues(model, account, status).Observe(time.Since(start).Seconds())
+}
+
+// UpstreamError 记录上游错误
+func UpstreamError(account, errorType string) {
+	upstreamErrors.WithLabelValues(account, errorType).Inc()
+}
+
+// AddTokens 累加token用量
+func AddTokens(model, account string, input, output, cacheWrite, cacheRead int64) {
+	model = ModelLabel(model)
+	tokensUsed.WithLabelValues(model, account, "input").Add(float64(input))
+	tokensUsed.WithLabelValues(model, account, "output").Add(float64(output))
+	tokensUsed.WithLabelValues(model, account, "cache_write").Add(float64(cacheWrite))
+	tokensUsed.WithLabelValues(model, account, "cache_read").Add(float64(cacheRead))
+}
+
+// TokenRefresh 记录账户token刷新结果
+func TokenRefresh(account string, err error) {
+	tokenRefreshes.WithLabelValues(account, result(err)).Inc()
+}
+
+// ObserveOAuth 记录OAuth接口请求的结果和耗时
+func ObserveOAuth(operation string, start time.Time, err error) {
+	oauthRequests.WithLabelValues(operation, result(err)).Inc()
+	oauthDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// RelayStarted 转发开始，返回结束时调用的函数
+func RelayStarted(account string) func() {
+	gauge := inflightRelays.WithLabelValues(account)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// SetQueueDepth 更新账户等待队列长度
+func SetQueueDepth(account string, depth int) {
+	queueDepth.WithLabelValues(account).Set(float64(depth))
+}
+
+// ObserveQueueWait 记录请求等待账户并发名额的时间
+func ObserveQueueWait(account string, wait time.Duration) {
+	queueWait.WithLabelValues(account).Observe(wait.Seconds())
+}
+
+// QueueRejected 记录因账户并发已满被拒绝的请求
+func QueueRejected(account, reason string) {
+	queueRejected.WithLabelValues(account, reason).Inc()
+}
+
+// CircuitChanged 记录熔断状态变化，state为 closed, half_open 或 open
+func CircuitChanged(kind, name, state string) {
+	value := 0.0
+	switch state {
+	case "half_open":
+		value = 1
+	case "open":
+		value = 2
+	}
+	circuitState.WithLabelValues(kind, name).Set(value)
+	circuitTransitions.WithLabelValues(kind, state).Inc()
+}
+
+// ForgetCircuit 删除熔断状态的时间序列
+func ForgetCircuit(kind, name string) {
+	circuitState.DeleteLabelValues(kind, name)
+}
+
+// AccountQuarantined 记录账户因凭据失效被隔离
+func AccountQuarantined(account, reason string) {
+	quarantines.WithLabelValues(account, reason).Inc()
+}
+
+// NotificationResult 记录一次事件通知的投递结果，result为 delivered 或 dead_letter
+func NotificationResult(webhook, result string) {
+	notifications.WithLabelValues(webhook, result).Inc()
+}
+
+// NotificationDropped 记录因通知队列已满被丢弃的事件
+func NotificationDropped() {
+	notificationsDropped.Inc()
+}
+
+// SetRateLimited 更新账户限流状态，resetAt为零值时不更新预计解除时间
+func SetRateLimited(account string, limited bool, resetAt time.Time) {
+	if !limited {
+		rateLimited.WithLabelValues(account).Set(0)
+		return
+	}
+	rateLimited.WithLabelValues(account).Set(1)
+	if !resetAt.IsZero() {
+		rateLimitReset.WithLabelValues(account).Set(float64(resetAt.Unix()))
+	}
+}
+
+// ProxyResult 记录代理的可用性，proxy为不含认证信息的代理地址
+func ProxyResult(proxy string, err error) {
+	if err != nil {
+		proxyUp.WithLabelValues(proxy).Set(0)
+		proxyErrors.WithLabelValues(proxy).Inc()
+		return
+	}
+	proxyUp.WithLabelValues(proxy).Set(1)
+}
+
+// ForgetAccount 删除账户相关的时间序列（账户被删除时调用）
+func ForgetAccount(account string) {
+	labels := prometheus.Labels{"account": account}
+	for _, vec := range []*prometheus.MetricVec{
+		relayRequests.MetricVec, relayDuration.MetricVec, upstreamErrors.MetricVec, tokensUsed.MetricVec,
+		tokenRefreshes.MetricVec, inflightRelays.MetricVec, rateLimited.MetricVec, rateLimitReset.MetricVec,
+		queueDepth.MetricVec, queueWait.MetricVec, queueRejected.MetricVec, quarantines.MetricVec,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// ModelLabel 模型名作为标签值：只保留Claude模型名，避免任意请求内容导致标签基数失控
+func ModelLabel(model string) string {
+	if model == "" {
+		return "unknown"
+	}
+	if !strings.HasPrefix(model, "claude-") || len(model) > 64 {
+		return "other"
+	}
+	return model
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,252 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reply 编排的 /v1/messages 错误响应，按先进先出顺序用于之后通过认证的请求
+type Reply struct {
+	Status  int    `json:"status"`
+	Type    string `json:"type,omitempty"`    // 为空时按状态码推断
+	Message string `json:"message,omitempty"` // 为空时使用默认说明
+	// RetryAfter Retry-After 响应头（秒），为0时不返回
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// RateLimited 429 限流响应
+func RateLimited(retryAfter time.Duration) Reply {
+	return Reply{Status: http.StatusTooManyRequests, RetryAfter: int(retryAfter.Seconds())}
+}
+
+// Overloaded 529 上游过载响应
+func Overloaded() Reply {
+	return Reply{Status: 529}
+}
+
+// Unauthorized 401 认证失败响应（token有效但被上游拒绝）
+func Unauthorized() Reply {
+	return Reply{Status: http.StatusUnauthorized}
+}
+
+// ParseScript 解析逗号分隔的状态码列表，如 "429,529,401"
+func ParseScript(spec string) ([]Reply, error) {
+	var replies []Reply
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		status, err := strconv.Atoi(field)
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("无效的状态码: %q", field)
+		}
+		replies = append(replies, Reply{Status: status})
+	}
+	return replies, nil
+}
+
+// Script 追加编排的响应
+func (s *Server) Script(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, replies...)
+}
+
+// nextReply 取出下一个编排的响应
+func (s *Server) nextReply() (Reply, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.script) == 0 {
+		return Reply{}, false
+	}
+	reply := s.script[0]
+	s.script = s.script[1:]
+	return reply, true
+}
+
+// record 记录收到的请求
+func (s *Server) record(req Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+}
+
+// Body 编排的错误响应体，测试可以据此检查转发服务是否原样透传
+func (r Reply) Body() map[string]interface{} {
+	errorType, message := r.Type, r.Message
+	if errorType == "" {
+		errorType = errorTypeFor(r.Status)
+	}
+	if message == "" {
+		message = fmt.Sprintf("mock upstream scripted %d response", r.Status)
+	}
+	return errorBody(errorType, message)
+}
+
+// write 写出编排的错误响应
+func (r Reply) write(w http.ResponseWriter) {
+	if r.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(r.RetryAfter))
+	}
+	writeJSON(w, r.Status, r.Body())
+}
+
+// errorTypeFor 状态码对应的Claude API错误类型
+func errorTypeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// messagesRequest /v1/messages 请求中模拟上游关心的字段
+type messagesRequest struct {
+	Model    string            `json:"model"`
+	Stream   bool              `json:"stream"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// handleMessages 模拟 /v1/messages：校验token，优先返回编排的响应，否则返回固定文本（stream为true时为SSE）
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	var req messagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "request body must be JSON")
+		return
+	}
+	entry := Request{Time: time.Now(), Model: req.Model, Stream: req.Stream}
+
+	account, message := s.authenticate(r)
+	if message != "" {
+		entry.Status = http.StatusUnauthorized
+		s.record(entry)
+		writeError(w, http.StatusUnauthorized, "authentication_error", message)
+		return
+	}
+	entry.Account = account.Name
+
+	if reply, ok := s.nextReply(); ok {
+		entry.Status = reply.Status
+		s.record(entry)
+		reply.write(w)
+		return
+	}
+	if req.Model == "" || len(req.Messages) == 0 {
+		entry.Status = http.StatusBadRequest
+		s.record(entry)
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "model and messages are required")
+		return
+	}
+
+	entry.Status = http.StatusOK
+	s.record(entry)
+
+	text := fmt.Sprintf("Hello from the mock upstream, %s.", account.Name)
+	inputTokens := 10 * len(req.Messages)
+	if req.Stream {
+		s.writeStream(w, r, req.Model, text, inputTokens)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":            "msg_mock_" + randomID(12),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         req.Model,
+		"content":       []map[string]string{{"type": "text", "text": text}},
+		"stop_reason":   "end_turn",
+		"stop_sequence": nil,
+		"usage":         map[string]int{"input_tokens": inputTokens, "output_tokens": len(strings.Fields(text))},
+	})
+}
+
+// sseEvent SSE事件
+type sseEvent struct {
+	name string
+	data interface{}
+}
+
+// writeStream 以SSE事件流返回文本，每个单词一个 content_block_delta，事件之间间隔 StreamDelay
+func (s *Server) writeStream(w http.ResponseWriter, r *http.Request, model, text string, inputTokens int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	words := strings.SplitAfter(text, " ")
+	events := []sseEvent{
+		{"message_start", map[string]interface{}{"type": "message_start", "message": map[string]interface{}{
+			"id": "msg_mock_" + randomID(12), "type": "message", "role": "assistant", "model": model,
+			"content": []interface{}{}, "stop_reason": nil, "stop_sequence": nil,
+			"usage": map[string]int{"input_tokens": inputTokens, "output_tokens": 1},
+		}}},
+		{"content_block_start", map[string]interface{}{"type": "content_block_start", "index": 0,
+			"content_block": map[string]string{"type": "text", "text": ""}}},
+		{"ping", map[string]string{"type": "ping"}},
+	}
+	for _, word := range words {
+		events = append(events, sseEvent{"content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": 0,
+			"delta": map[string]string{"type": "text_delta", "text": word}}})
+	}
+	events = append(events, []sseEvent{
+		{"content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": 0}},
+		{"message_delta", map[string]interface{}{"type": "message_delta",
+			"delta": map[string]interface{}{"stop_reason": "end_turn", "stop_sequence": nil},
+			"usage": map[string]int{"output_tokens": len(words)}}},
+		{"message_stop", map[string]string{"type": "message_stop"}},
+	}...)
+
+	for i, event := range events {
+		if i > 0 && s.opts.StreamDelay > 0 {
+			select {
+			case <-time.After(s.opts.StreamDelay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		data, _ := json.Marshal(event.data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleScript 控制接口：追加编排的响应 {"replies": [{"status": 429, "retry_after": 30}]}
+func (s *Server) handleScript(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Replies []Reply `json:"replies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "request body must be JSON")
+		return
+	}
+	for _, reply := range req.Replies {
+		if reply.Status < 400 || reply.Status > 599 {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid status %d", reply.Status))
+			return
+		}
+	}
+	s.Script(req.Replies...)
+
+	s.mu.Lock()
+	pending := len(s.script)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]int{"pending": pending})
+}
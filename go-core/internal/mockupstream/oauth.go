@@ -0,0 +1,234 @@
+package mockupstream
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// codeTTL 授权码有效期
+const codeTTL = 10 * time.Minute
+
+// tokenRequest token接口请求，与 oauth.Client 发送的JSON字段一致
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	ClientID     string `json:"client_id"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	State        string `json:"state"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// handleAuthorize 模拟授权页面：自动同意并签发授权码。
+// 回调地址是本机地址时直接重定向，否则（如托管回调页面）展示 code#state 供手动复制。
+// 可以用 account 参数指定登录的账户，不指定时创建新账户
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	challenge := query.Get("code_challenge")
+	switch {
+	case query.Get("client_id") == "":
+		http.Error(w, "missing client_id", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case challenge == "" || query.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	case redirectURI == "":
+		http.Error(w, "missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	account := query.Get("account")
+	if account == "" {
+		account = "mock-" + randomID(4)
+	}
+	code := randomID(16)
+
+	s.mu.Lock()
+	s.codes[code] = &authorization{
+		account:     account,
+		challenge:   challenge,
+		redirectURI: redirectURI,
+		scopes:      strings.Fields(query.Get("scope")),
+		expiresAt:   time.Now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+
+	state := query.Get("state")
+	if query.Get("code") != "true" && isLocalRedirect(redirectURI) {
+		target, _ := url.Parse(redirectURI)
+		params := target.Query()
+		params.Set("code", code)
+		params.Set("state", state)
+		target.RawQuery = params.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html><title>Mock authorization</title><p>Authorization code for %s:</p><pre>%s</pre>",
+		html.EscapeString(account), html.EscapeString(code+"#"+state))
+}
+
+// handleToken 模拟token接口：authorization_code 校验授权码（一次性）、回调地址和PKCE，
+// refresh_token 校验refresh token，失败时返回 invalid_grant
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOAuthError(w, "invalid_request", "request body must be JSON")
+		return
+	}
+	if req.ClientID == "" {
+		writeOAuthError(w, "invalid_client", "missing client_id")
+		return
+	}
+
+	var (
+		account *Account
+		message string
+	)
+	switch req.GrantType {
+	case "authorization_code":
+		account, message = s.exchangeCode(&req)
+	case "refresh_token":
+		account, message = s.refreshToken(req.RefreshToken)
+	default:
+		writeOAuthError(w, "unsupported_grant_type", fmt.Sprintf("grant_type %q is not supported", req.GrantType))
+		return
+	}
+	if account == nil {
+		writeOAuthError(w, "invalid_grant", message)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  account.AccessToken,
+		"refresh_token": account.RefreshToken,
+		"expires_in":    int(time.Until(account.ExpiresAt).Seconds()),
+		"token_type":    "Bearer",
+		"scope":         strings.Join(account.Scopes, " "),
+	})
+}
+
+// exchangeCode 用授权码换取token，返回账户的快照；失败时返回错误说明
+func (s *Server) exchangeCode(req *tokenRequest) (*Account, string) {
+	code, _, _ := strings.Cut(req.Code, "#")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.codes[code]
+	if !ok {
+		return nil, "Invalid authorization code"
+	}
+	// 授权码只能使用一次，校验失败也作废
+	delete(s.codes, code)
+
+	switch {
+	case time.Now().After(auth.expiresAt):
+		return nil, "Authorization code has expired"
+	case req.RedirectURI != auth.redirectURI:
+		return nil, "redirect_uri does not match the authorization request"
+	case pkceChallenge(req.CodeVerifier) != auth.challenge:
+		return nil, "Invalid code_verifier"
+	}
+
+	account, ok := s.accounts[auth.account]
+	if !ok {
+		account = s.addAccount(auth.account, s.opts.Organization)
+	} else {
+		s.issueAccess(account)
+		s.issueRefresh(account)
+	}
+	if len(auth.scopes) > 0 {
+		account.Scopes = auth.scopes
+	}
+	snapshot := *account
+	return &snapshot, ""
+}
+
+// refreshToken 用refresh token签发新的access token，返回账户的快照；失败时返回错误说明
+func (s *Server) refreshToken(refreshToken string) (*Account, string) {
+	if refreshToken == "" {
+		return nil, "missing refresh_token"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.refresh[refreshToken]
+	if !ok {
+		return nil, "Refresh token not found or invalid"
+	}
+	s.issueAccess(account)
+	if !s.opts.StaticRefreshTokens {
+		s.issueRefresh(account)
+	}
+	snapshot := *account
+	return &snapshot, ""
+}
+
+// handleProfile 模拟profile接口，按Bearer token返回账户和组织信息
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	account, message := s.authenticate(r)
+	if message != "" {
+		writeError(w, http.StatusUnauthorized, "authentication_error", message)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"account": map[string]interface{}{
+			"uuid":           account.UUID,
+			"email":          account.Email,
+			"full_name":      account.Name,
+			"has_claude_max": account.Organization == OrganizationMax,
+			"has_claude_pro": account.Organization == OrganizationPro,
+		},
+		"organization": map[string]interface{}{
+			"uuid":              account.UUID,
+			"name":              account.Name + "'s Organization",
+			"organization_type": account.Organization,
+			"rate_limit_tier":   "default_" + account.Organization,
+		},
+	})
+}
+
+// writeOAuthError 写出OAuth格式的错误响应（RFC 6749 5.2）
+func writeOAuthError(w http.ResponseWriter, code, description string) {
+	status := http.StatusBadRequest
+	if code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// pkceChallenge 由code verifier计算S256 code challenge
+func pkceChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// isLocalRedirect 回调地址是否指向本机
+func isLocalRedirect(redirectURI string) bool {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	host := target.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
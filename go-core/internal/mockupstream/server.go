@@ -0,0 +1,316 @@
+// Package mockupstream 模拟Anthropic上游：OAuth授权、token和profile接口以及 /v1/messages，
+// 可以通过 httptest 在Go测试中使用，也可以由 cmd/mockupstream 独立运行。
+package mockupstream
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/oauth"
+)
+
+// 模拟上游的接口路径，与真实服务一致
+const (
+	AuthorizePath = "/oauth/authorize"
+	TokenPath     = "/v1/oauth/token"
+	ProfilePath   = "/api/oauth/profile"
+	MessagesPath  = "/v1/messages"
+)
+
+// DefaultTokenTTL 签发的access token默认有效期
+const DefaultTokenTTL = time.Hour
+
+// 组织类型，决定profile接口返回的订阅类型
+const (
+	OrganizationPro        = "claude_pro"
+	OrganizationMax        = "claude_max"
+	OrganizationTeam       = "claude_team"
+	OrganizationEnterprise = "claude_enterprise"
+)
+
+// Options 模拟上游选项
+type Options struct {
+	// TokenTTL 签发的access token有效期，为0时使用 DefaultTokenTTL
+	TokenTTL time.Duration
+	// StaticRefreshTokens 刷新时不轮换refresh token（默认与真实服务一样每次签发新的并作废旧的）
+	StaticRefreshTokens bool
+	// StreamDelay SSE响应中相邻事件的间隔
+	StreamDelay time.Duration
+	// Organization 通过授权流程创建的账户的组织类型，为空时为 claude_max
+	Organization string
+}
+
+// Account 模拟上游中的账户及其当前token
+type Account struct {
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	UUID         string    `json:"uuid"`
+	Organization string    `json:"organization"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Scopes       []string  `json:"scopes"`
+}
+
+// Credentials 转换为Claude Code CLI凭据格式，可直接导入转发服务
+func (a Account) Credentials() *oauth.ClaudeCredentials {
+	return &oauth.ClaudeCredentials{ClaudeAiOauth: &oauth.ClaudeAiOauth{
+		AccessToken:      a.AccessToken,
+		RefreshToken:     a.RefreshToken,
+		ExpiresAt:        a.ExpiresAt.UnixMilli(),
+		Scopes:           append([]string(nil), a.Scopes...),
+		SubscriptionType: strings.TrimPrefix(a.Organization, "claude_"),
+	}}
+}
+
+// OAuthData 转换为转发服务保存的账户数据
+func (a Account) OAuthData() *oauth.OAuthData {
+	return &oauth.OAuthData{
+		Name:         a.Name,
+		AccessToken:  a.AccessToken,
+		RefreshToken: a.RefreshToken,
+		ExpiresAt:    a.ExpiresAt,
+		Scopes:       append([]string(nil), a.Scopes...),
+	}
+}
+
+// Request 模拟上游收到的 /v1/messages 请求，用于测试断言
+type Request struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account,omitempty"` // 按token识别的账户，token无效时为空
+	Model   string    `json:"model,omitempty"`
+	Stream  bool      `json:"stream"`
+	Status  int       `json:"status"`
+}
+
+// authorization 已签发未使用的授权码
+type authorization struct {
+	account     string
+	challenge   string
+	redirectURI string
+	scopes      []string
+	expiresAt   time.Time
+}
+
+// Server 模拟上游，实现 http.Handler
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+	access   map[string]*Account // access token → 账户
+	refresh  map[string]*Account // refresh token → 账户
+	codes    map[string]*authorization
+	script   []Reply
+	requests []Request
+}
+
+// New 创建模拟上游
+func New(opts Options) *Server {
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = DefaultTokenTTL
+	}
+	if opts.Organization == "" {
+		opts.Organization = OrganizationMax
+	}
+
+	s := &Server{
+		opts:     opts,
+		mux:      http.NewServeMux(),
+		accounts: make(map[string]*Account),
+		access:   make(map[string]*Account),
+		refresh:  make(map[string]*Account),
+		codes:    make(map[string]*authorization),
+	}
+	s.mux.HandleFunc("GET "+AuthorizePath, s.handleAuthorize)
+	s.mux.HandleFunc("POST "+TokenPath, s.handleToken)
+	s.mux.HandleFunc("GET "+ProfilePath, s.handleProfile)
+	s.mux.HandleFunc("POST "+MessagesPath, s.handleMessages)
+
+	// 控制接口，独立运行时用于编排响应和查看请求
+	s.mux.HandleFunc("POST /mock/accounts", s.handleAddAccount)
+	s.mux.HandleFunc("POST /mock/script", s.handleScript)
+	s.mux.HandleFunc("GET /mock/requests", s.handleRequests)
+	return s
+}
+
+// ServeHTTP 实现 http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Configure 将配置中的OAuth和Claude API地址指向baseURL上的模拟上游
+func (s *Server) Configure(cfg *config.Config, baseURL string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	cfg.OAuth.AuthorizeURL = baseURL + AuthorizePath
+	cfg.OAuth.TokenURL = baseURL + TokenPath
+	cfg.OAuth.ProfileURL = baseURL + ProfilePath
+	cfg.Claude.APIUrl = baseURL + MessagesPath
+}
+
+// AddAccount 直接创建账户并签发token（跳过授权流程），organization为空时使用选项中的组织类型
+func (s *Server) AddAccount(name, organization string) Account {
+	if organization == "" {
+		organization = s.opts.Organization
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.addAccount(name, organization)
+}
+
+// addAccount 创建账户并签发token，同名账户的旧token作废（调用方需持有锁）
+func (s *Server) addAccount(name, organization string) *Account {
+	account := &Account{
+		Name:         name,
+		Email:        name + "@mock.example.com",
+		UUID:         randomID(16),
+		Organization: organization,
+		Scopes:       strings.Fields(config.Default().OAuth.Scopes),
+	}
+	if old, ok := s.accounts[name]; ok {
+		delete(s.access, old.AccessToken)
+		delete(s.refresh, old.RefreshToken)
+	}
+	s.accounts[name] = account
+	s.issueAccess(account)
+	s.issueRefresh(account)
+	return account
+}
+
+// Account 返回账户的当前状态
+func (s *Server) Account(name string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[name]
+	if !ok {
+		return Account{}, false
+	}
+	return *account, true
+}
+
+// ExpireAccessToken 使账户当前的access token立即过期，之后的请求返回401
+func (s *Server) ExpireAccessToken(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if account, ok := s.accounts[name]; ok {
+		account.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+// RevokeRefreshToken 作废账户当前的refresh token，之后刷新返回 invalid_grant
+func (s *Server) RevokeRefreshToken(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if account, ok := s.accounts[name]; ok {
+		delete(s.refresh, account.RefreshToken)
+	}
+}
+
+// Requests 返回收到的 /v1/messages 请求
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Reset 清空编排的响应和请求记录，账户和token保留
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = nil
+	s.requests = nil
+}
+
+// issueAccess 签发新的access token（调用方需持有锁）
+func (s *Server) issueAccess(account *Account) {
+	delete(s.access, account.AccessToken)
+	account.AccessToken = "sk-ant-oat01-mock-" + randomID(24)
+	account.ExpiresAt = time.Now().Add(s.opts.TokenTTL)
+	s.access[account.AccessToken] = account
+}
+
+// issueRefresh 签发新的refresh token并作废旧的（调用方需持有锁）
+func (s *Server) issueRefresh(account *Account) {
+	delete(s.refresh, account.RefreshToken)
+	account.RefreshToken = "sk-ant-ort01-mock-" + randomID(24)
+	s.refresh[account.RefreshToken] = account
+}
+
+// authenticate 按Bearer token查找账户，token未知或已过期时返回错误信息
+func (s *Server) authenticate(r *http.Request) (*Account, string) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, "missing bearer token"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.access[token]
+	if !ok {
+		return nil, "invalid bearer token"
+	}
+	if time.Now().After(account.ExpiresAt) {
+		return account, "OAuth token has expired"
+	}
+	return account, ""
+}
+
+// handleAddAccount 控制接口：创建账户 {"name": "...", "organization": "claude_pro"}
+func (s *Server) handleAddAccount(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name         string `json:"name"`
+		Organization string `json:"organization"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "name is required")
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.AddAccount(req.Name, req.Organization))
+}
+
+// handleRequests 控制接口：查看收到的 /v1/messages 请求
+func (s *Server) handleRequests(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"requests": s.Requests()})
+}
+
+// writeJSON 写出JSON响应
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError 写出Claude API格式的错误响应
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, errorBody(errorType, message))
+}
+
+// errorBody Claude API格式的错误响应体
+func errorBody(errorType, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": errorType, "message": message},
+	}
+}
+
+// randomID 随机十六进制字符串
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("生成随机数失败: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,161 @@
+package mockupstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// call 向模拟上游发送JSON请求，token不为空时带上Bearer认证
+func call(t *testing.T, server *httptest.Server, method, path, token string, body interface{}) (*http.Response, []byte) {
+	t.Helper()
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func newServer(t *testing.T, opts Options) (*Server, *httptest.Server) {
+	mock := New(opts)
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	return mock, server
+}
+
+func messages(stream bool) map[string]interface{} {
+	return map[string]interface{}{
+		"model":    "claude-sonnet-4-20250514",
+		"stream":   stream,
+		"messages": []map[string]string{{"role": "user", "content": "hi"}},
+	}
+}
+
+func TestMessages(t *testing.T) {
+	mock, server := newServer(t, Options{})
+	alice := mock.AddAccount("alice", "")
+
+	resp, body := call(t, server, http.MethodPost, MessagesPath, alice.AccessToken, messages(false))
+	var message struct {
+		Content []struct{ Text string }
+		Usage   struct {
+			InputTokens int `json:"input_tokens"`
+		}
+	}
+	if err := json.Unmarshal(body, &message); err != nil || resp.StatusCode != http.StatusOK ||
+		len(message.Content) != 1 || !strings.Contains(message.Content[0].Text, "alice") || message.Usage.InputTokens != 10 {
+		t.Fatalf("非流式响应不正确: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = call(t, server, http.MethodPost, MessagesPath, alice.AccessToken, messages(true))
+	if resp.Header.Get("Content-Type") != "text/event-stream" ||
+		!strings.HasPrefix(string(body), "event: message_start\n") || !strings.HasSuffix(string(body), "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") {
+		t.Errorf("流式响应不正确: %s", body)
+	}
+
+	if resp, _ := call(t, server, http.MethodPost, MessagesPath, "unknown-token", messages(false)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("未知token应返回401，实际 %d", resp.StatusCode)
+	}
+
+	requests := mock.Requests()
+	if len(requests) != 3 || requests[0].Account != "alice" || !requests[1].Stream || requests[2].Account != "" || requests[2].Status != http.StatusUnauthorized {
+		t.Errorf("请求记录不正确: %+v", requests)
+	}
+}
+
+func TestScriptedReplies(t *testing.T) {
+	mock, server := newServer(t, Options{})
+	alice := mock.AddAccount("alice", "")
+
+	replies, err := ParseScript("529, 401")
+	if err != nil || len(replies) != 2 {
+		t.Fatalf("解析编排失败: %v %+v", err, replies)
+	}
+	if _, err := ParseScript("200"); err == nil {
+		t.Errorf("非错误状态码应解析失败")
+	}
+	mock.Script(RateLimited(30 * time.Second))
+	mock.Script(replies...)
+
+	wants := []struct {
+		status    int
+		errorType string
+	}{
+		{http.StatusTooManyRequests, "rate_limit_error"},
+		{529, "overloaded_error"},
+		{http.StatusUnauthorized, "authentication_error"},
+		{http.StatusOK, ""},
+	}
+	for i, want := range wants {
+		resp, body := call(t, server, http.MethodPost, MessagesPath, alice.AccessToken, messages(false))
+		if resp.StatusCode != want.status || (want.errorType != "" && !strings.Contains(string(body), want.errorType)) {
+			t.Errorf("第%d个请求应返回 %d %s，实际 %d %s", i+1, want.status, want.errorType, resp.StatusCode, body)
+		}
+		if i == 0 && resp.Header.Get("Retry-After") != "30" {
+			t.Errorf("限流响应应带 Retry-After: %v", resp.Header)
+		}
+	}
+
+	// 控制接口拒绝非错误状态码
+	if resp, _ := call(t, server, http.MethodPost, "/mock/script", "", map[string]interface{}{"replies": []Reply{{Status: 200}}}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("编排非错误状态码应返回400，实际 %d", resp.StatusCode)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	mock, server := newServer(t, Options{TokenTTL: time.Minute})
+	alice := mock.AddAccount("alice", OrganizationPro)
+
+	// access token过期后请求返回401
+	mock.ExpireAccessToken("alice")
+	if resp, body := call(t, server, http.MethodPost, MessagesPath, alice.AccessToken, messages(false)); resp.StatusCode != http.StatusUnauthorized ||
+		!strings.Contains(string(body), "expired") {
+		t.Errorf("过期的token应返回401: %d %s", resp.StatusCode, body)
+	}
+
+	refresh := map[string]string{"grant_type": "refresh_token", "client_id": "client", "refresh_token": alice.RefreshToken}
+	resp, body := call(t, server, http.MethodPost, TokenPath, "", refresh)
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || resp.StatusCode != http.StatusOK ||
+		tokens.AccessToken == alice.AccessToken || tokens.RefreshToken == alice.RefreshToken || tokens.ExpiresIn > 60 {
+		t.Fatalf("刷新应签发新的token: %d %s", resp.StatusCode, body)
+	}
+
+	// 旧的refresh token已轮换作废
+	if resp, body := call(t, server, http.MethodPost, TokenPath, "", refresh); resp.StatusCode != http.StatusBadRequest ||
+		!strings.Contains(string(body), "invalid_grant") {
+		t.Errorf("已轮换的refresh token应返回 invalid_grant: %d %s", resp.StatusCode, body)
+	}
+
+	// 新token可以访问profile
+	resp, body = call(t, server, http.MethodGet, ProfilePath, tokens.AccessToken, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"organization_type":"claude_pro"`) {
+		t.Errorf("profile不正确: %d %s", resp.StatusCode, body)
+	}
+
+	mock.RevokeRefreshToken("alice")
+	refresh["refresh_token"] = tokens.RefreshToken
+	if resp, _ := call(t, server, http.MethodPost, TokenPath, "", refresh); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("作废的refresh token应刷新失败，实际 %d", resp.StatusCode)
+	}
+}
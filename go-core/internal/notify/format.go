@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-relay-core/internal/config"
+)
+
+// JSON格式webhook的请求头
+const (
+	HeaderEvent     = "X-Relay-Event"
+	HeaderDelivery  = "X-Relay-Delivery"
+	HeaderTimestamp = "X-Relay-Timestamp"
+	HeaderSignature = "X-Relay-Signature"
+)
+
+// eventTitles 事件的中文标题
+var eventTitles = map[string]string{
+	EventTokenRefreshFailed: "Token刷新失败",
+	EventAccountQuarantined: "账户已隔离",
+	EventRateLimitEntered:   "账户被限流",
+	EventRateLimitCleared:   "账户限流解除",
+	EventQuotaExhausted:     "账户额度用尽",
+	EventProxyDown:          "代理不可用",
+	EventProxyRecovered:     "代理已恢复",
+	EventTest:               "测试通知",
+}
+
+// severityIcons 事件级别对应的图标
+var severityIcons = map[string]string{
+	SeverityInfo:     "ℹ️",
+	SeverityWarning:  "⚠️",
+	SeverityCritical: "🚨",
+}
+
+// Text 聊天机器人消息的文本内容
+func (e Event) Text() string {
+	icon := severityIcons[e.Severity]
+	if icon == "" {
+		icon = severityIcons[SeverityInfo]
+	}
+	title := eventTitles[e.Type]
+	if title == "" {
+		title = e.Type
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [Claude Relay] %s", icon, title)
+	if e.Account != "" {
+		fmt.Fprintf(&b, "\n账户: %s", e.Account)
+	}
+	if e.Proxy != "" {
+		fmt.Fprintf(&b, "\n代理: %s", e.Proxy)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, "\n说明: %s", e.Message)
+	}
+	keys := make([]string, 0, len(e.Details))
+	for key := range e.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n%s: %s", key, e.Details[key])
+	}
+	fmt.Fprintf(&b, "\n时间: %s", e.Time.Format(time.RFC3339))
+	return b.String()
+}
+
+// Sign JSON格式webhook的签名：HMAC-SHA256(secret, 时间戳 + "." + 请求体)，
+// 接收方用相同方式计算后与 X-Relay-Signature 比较，并检查时间戳防止重放
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newRequest 按webhook格式构造投递请求
+func newRequest(ctx context.Context, webhook *config.WebhookConfig, event Event, now time.Time) (*http.Request, error) {
+	target := webhook.URL
+	headers := http.Header{}
+	var payload any
+
+	switch webhook.Format {
+	case config.WebhookFormatSlack:
+		payload = map[string]any{"text": event.Text()}
+
+	case config.WebhookFormatFeishu:
+		body := map[string]any{
+			"msg_type": "text",
+			"content":  map[string]string{"text": event.Text()},
+		}
+		if webhook.Secret != "" {
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			body["timestamp"] = timestamp
+			body["sign"] = feishuSign(webhook.Secret, timestamp)
+		}
+		payload = body
+
+	case config.WebhookFormatDingTalk:
+		payload = map[string]any{
+			"msgtype": "text",
+			"text":    map[string]string{"content": event.Text()},
+		}
+		if webhook.Secret != "" {
+			signed, err := dingTalkURL(webhook.URL, webhook.Secret, now)
+			if err != nil {
+				return nil, err
+			}
+			target = signed
+		}
+
+	default:
+		payload = event
+		headers.Set(HeaderEvent, event.Type)
+		headers.Set(HeaderDelivery, event.ID)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化通知失败: %w", err)
+	}
+	if webhook.Format == config.WebhookFormatJSON || webhook.Format == "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		headers.Set(HeaderTimestamp, timestamp)
+		if webhook.Secret != "" {
+			headers.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建webhook请求失败: %w", err)
+	}
+	req.Header = headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "claude-relay-notify/1.0")
+	return req, nil
+}
+
+// feishuSign 飞书机器人签名：以 时间戳 + "\n" + 密钥 为key对空字符串做HMAC-SHA256
+func feishuSign(secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// dingTalkURL 钉钉机器人加签：在URL上附加毫秒时间戳和 HMAC-SHA256(密钥, 时间戳 + "\n" + 密钥)
+func dingTalkURL(rawURL, secret string, now time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("解析webhook地址失败: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+
+	query := u.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// checkBotResponse 飞书和钉钉机器人出错时仍返回200，错误码在响应体中
+func checkBotResponse(format string, body []byte) error {
+	var resp struct {
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	switch format {
+	case config.WebhookFormatFeishu:
+		if json.Unmarshal(body, &resp) == nil && resp.Code != nil && *resp.Code != 0 {
+			return fmt.Errorf("飞书机器人返回错误 %d: %s", *resp.Code, resp.Msg)
+		}
+	case config.WebhookFormatDingTalk:
+		if json.Unmarshal(body, &resp) == nil && resp.ErrCode != nil && *resp.ErrCode != 0 {
+			return fmt.Errorf("钉钉机器人返回错误 %d: %s", *resp.ErrCode, resp.ErrMsg)
+		}
+	}
+	return nil
+}
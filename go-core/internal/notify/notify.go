@@ -0,0 +1,451 @@
+// Package notify 账户和代理事件通知：事件进入队列后由后台任务推送到订阅的webhook，
+// 失败时按指数退避重试，重试用尽后写入死信日志
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/metrics"
+)
+
+// 事件类型
+const (
+	EventTokenRefreshFailed = "token_refresh_failed" // 账户刷新token失败
+	EventAccountQuarantined = "account_quarantined"  // 账户凭据失效被隔离
+	EventRateLimitEntered   = "rate_limit_entered"   // 账户开始被限流
+	EventRateLimitCleared   = "rate_limit_cleared"   // 账户限流解除
+	EventQuotaExhausted     = "quota_exhausted"      // 账户的订阅额度用尽
+	EventProxyDown          = "proxy_down"           // 代理出口熔断
+	EventProxyRecovered     = "proxy_recovered"      // 代理出口恢复
+	EventTest               = "test"                 // 管理接口发送的测试通知
+)
+
+// EventTypes 可订阅的事件类型
+var EventTypes = []string{
+	EventTokenRefreshFailed, EventAccountQuarantined, EventRateLimitEntered, EventRateLimitCleared,
+	EventQuotaExhausted, EventProxyDown, EventProxyRecovered, EventTest,
+}
+
+// 事件级别
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// 投递结果（监控指标标签）
+const (
+	resultDelivered  = "delivered"
+	resultDeadLetter = "dead_letter"
+)
+
+// queueSize 等待投递的事件数上限，超出时丢弃新事件
+const queueSize = 256
+
+// webhookQueueSize 单个webhook等待投递的事件数上限，超出时直接写入死信日志
+const webhookQueueSize = 64
+
+// ErrUnknownWebhook 没有该名称的webhook
+var ErrUnknownWebhook = errors.New("webhook不存在")
+
+// Event 一条通知事件
+type Event struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Time      time.Time         `json:"time"`
+	AccountID string            `json:"account_id,omitempty"`
+	Account   string            `json:"account,omitempty"`
+	Proxy     string            `json:"proxy,omitempty"` // 不含认证信息的代理地址
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// delivery 待投递到单个webhook的事件，带上入队时的配置
+type delivery struct {
+	cfg     *config.NotifyConfig
+	webhook *config.WebhookConfig
+	event   Event
+}
+
+// DeadLetter 重试用尽仍未投递成功的通知
+type DeadLetter struct {
+	Time     time.Time `json:"time"`
+	Webhook  string    `json:"webhook"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Event    Event     `json:"event"`
+}
+
+// Notifier 事件通知器，配置随热更新替换，未配置webhook时丢弃全部事件
+type Notifier struct {
+	cfg    atomic.Pointer[config.NotifyConfig]
+	client *http.Client
+	queue  chan Event
+
+	// sent 去重窗口内最近一次通知的时间，按事件类型和对象（账户或代理）记录
+	mu   sync.Mutex
+	sent map[string]time.Time
+
+	// deadLetterMu 串行写入死信日志
+	deadLetterMu sync.Mutex
+}
+
+// New 创建事件通知器
+func New(cfg config.NotifyConfig) *Notifier {
+	n := &Notifier{
+		client: &http.Client{},
+		queue:  make(chan Event, queueSize),
+		sent:   make(map[string]time.Time),
+	}
+	n.setConfig(cfg)
+	return n
+}
+
+// UpdateConfig 热更新webhook、重试和去重配置
+func (n *Notifier) UpdateConfig(cfg *config.Config) {
+	n.setConfig(cfg.Notify)
+}
+
+func (n *Notifier) setConfig(cfg config.NotifyConfig) {
+	for _, name := range webhookNames(cfg) {
+		for _, event := range cfg.Webhooks[name].Events {
+			if !knownEvent(event) {
+				slog.Warn("webhook订阅了未知的事件类型", "webhook", name, "event", event)
+			}
+		}
+	}
+	n.cfg.Store(&cfg)
+}
+
+// Notify 补全事件ID和时间后放入投递队列，不阻塞调用方：
+// 没有订阅的webhook、去重窗口内已通知过或队列已满时丢弃
+func (n *Notifier) Notify(event Event) {
+	cfg := n.cfg.Load()
+	if !subscribed(cfg, event.Type) || n.duplicate(cfg, event) {
+		return
+	}
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		metrics.NotificationDropped()
+		slog.Warn("通知队列已满，丢弃事件", "type", event.Type, "account_id", event.AccountID, "proxy", event.Proxy)
+	}
+}
+
+// duplicate 同一对象的同类事件在去重窗口内是否已经通知过
+func (n *Notifier) duplicate(cfg *config.NotifyConfig, event Event) bool {
+	if cfg.DedupeWindow <= 0 || event.Type == EventTest {
+		return false
+	}
+	key := event.Type + "/" + event.AccountID + "/" + event.Proxy
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if last, ok := n.sent[key]; ok && now.Sub(last) < cfg.DedupeWindow {
+		return true
+	}
+	n.sent[key] = now
+	for k, last := range n.sent {
+		if now.Sub(last) >= cfg.DedupeWindow {
+			delete(n.sent, k)
+		}
+	}
+	return false
+}
+
+// Run 投递队列中的事件直到ctx结束。每个webhook由一个后台任务按顺序投递，
+// 一个webhook重试退避时不影响其他webhook。停止时正在重试的通知和队列中剩余的事件写入死信日志
+func (n *Notifier) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	queues := make(map[string]chan delivery)
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		workers.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.drain()
+			return
+		case event := <-n.queue:
+			cfg := n.cfg.Load()
+			for _, name := range webhookNames(*cfg) {
+				webhook := cfg.Webhooks[name]
+				if !webhook.Subscribed(event.Type) {
+					continue
+				}
+				queue, ok := queues[name]
+				if !ok {
+					queue = make(chan delivery, webhookQueueSize)
+					queues[name] = queue
+					workers.Add(1)
+					go func() {
+						defer workers.Done()
+						n.work(ctx, name, queue)
+					}()
+				}
+				select {
+				case queue <- delivery{cfg: cfg, webhook: webhook, event: event}:
+				default:
+					n.deadLetter(cfg, name, event, 0, errors.New("webhook投递队列已满"))
+				}
+			}
+		}
+	}
+}
+
+// work 按入队顺序投递到单个webhook，服务停止后剩余的事件写入死信日志
+func (n *Notifier) work(ctx context.Context, name string, queue <-chan delivery) {
+	for d := range queue {
+		if ctx.Err() != nil {
+			n.deadLetter(d.cfg, name, d.event, 0, errors.New("服务停止，未投递"))
+			continue
+		}
+		n.deliver(ctx, d.cfg, name, d.webhook, d.event)
+	}
+}
+
+// drain 服务停止时把队列中还没有投递的事件写入死信日志
+func (n *Notifier) drain() {
+	cfg := n.cfg.Load()
+	for {
+		select {
+		case event := <-n.queue:
+			for _, name := range webhookNames(*cfg) {
+				if cfg.Webhooks[name].Subscribed(event.Type) {
+					n.deadLetter(cfg, name, event, 0, errors.New("服务停止，未投递"))
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+// deliver 投递到单个webhook，失败时按指数退避重试，重试用尽或无法重试时写入死信日志
+func (n *Notifier) deliver(ctx context.Context, cfg *config.NotifyConfig, name string, webhook *config.WebhookConfig, event Event) {
+	backoff := cfg.RetryBackoff
+	attempts := 0
+	for {
+		attempts++
+		retryable, err := n.send(ctx, cfg.Timeout, webhook, event)
+		if err == nil {
+			metrics.NotificationResult(name, resultDelivered)
+			slog.Debug("通知已投递", "webhook", name, "type", event.Type, "id", event.ID, "attempts", attempts)
+			return
+		}
+		if !retryable || attempts > cfg.MaxRetries {
+			n.deadLetter(cfg, name, event, attempts, err)
+			return
+		}
+
+		slog.Warn("通知投递失败，稍后重试", "webhook", name, "type", event.Type, "attempt", attempts, "error", err)
+		select {
+		case <-ctx.Done():
+			n.deadLetter(cfg, name, event, attempts, fmt.Errorf("服务停止，放弃重试: %w", err))
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send 发送一次，返回失败时是否值得重试（网络错误、5xx、429）
+func (n *Notifier) send(ctx context.Context, timeout time.Duration, webhook *config.WebhookConfig, event Event) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := newRequest(ctx, webhook, event, time.Now())
+	if err != nil {
+		return false, err
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("发送webhook请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retryable, fmt.Errorf("webhook返回 %d: %s", resp.StatusCode, body)
+	}
+	// 飞书和钉钉的机器人签名错误、关键词不匹配等也返回200，需检查响应中的错误码
+	if err := checkBotResponse(webhook.Format, body); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Test 立即向webhook发送一条测试通知（不重试、不写死信日志），name为空时发送到全部webhook，
+// 返回每个webhook的结果，nil表示成功
+func (n *Notifier) Test(ctx context.Context, name string) (map[string]error, error) {
+	cfg := n.cfg.Load()
+	names := webhookNames(*cfg)
+	if name != "" {
+		if cfg.Webhooks[name] == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownWebhook, name)
+		}
+		names = []string{name}
+	}
+
+	event := Event{
+		ID:       newEventID(),
+		Type:     EventTest,
+		Severity: SeverityInfo,
+		Time:     time.Now(),
+		Message:  "这是一条测试通知",
+	}
+	results := make(map[string]error, len(names))
+	for _, name := range names {
+		_, err := n.send(ctx, cfg.Timeout, cfg.Webhooks[name], event)
+		results[name] = err
+	}
+	return results, nil
+}
+
+// Webhooks 已配置的webhook名称
+func (n *Notifier) Webhooks() []string {
+	return webhookNames(*n.cfg.Load())
+}
+
+// deadLetter 追加写入死信日志，写入失败只打印日志
+func (n *Notifier) deadLetter(cfg *config.NotifyConfig, name string, event Event, attempts int, cause error) {
+	metrics.NotificationResult(name, resultDeadLetter)
+	slog.Error("通知投递失败，已写入死信日志", "webhook", name, "type", event.Type, "id", event.ID,
+		"attempts", attempts, "error", cause)
+
+	line, err := json.Marshal(DeadLetter{Time: time.Now(), Webhook: name, Attempts: attempts, Error: cause.Error(), Event: event})
+	if err != nil {
+		slog.Warn("序列化死信记录失败", "error", err)
+		return
+	}
+
+	n.deadLetterMu.Lock()
+	defer n.deadLetterMu.Unlock()
+	if err := appendLine(cfg.DeadLetterFile, line); err != nil {
+		slog.Warn("写入死信日志失败", "file", cfg.DeadLetterFile, "error", err)
+	}
+}
+
+// DeadLetters 最近的死信记录，按时间从新到旧，最多limit条
+func (n *Notifier) DeadLetters(limit int) ([]DeadLetter, error) {
+	n.deadLetterMu.Lock()
+	defer n.deadLetterMu.Unlock()
+
+	file, err := os.Open(n.cfg.Load().DeadLetterFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return []DeadLetter{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开死信日志失败: %w", err)
+	}
+	defer file.Close()
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			continue
+		}
+		letters = append(letters, letter)
+		if limit > 0 && len(letters) > limit {
+			letters = letters[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取死信日志失败: %w", err)
+	}
+
+	for i, j := 0, len(letters)-1; i < j; i, j = i+1, j-1 {
+		letters[i], letters[j] = letters[j], letters[i]
+	}
+	if letters == nil {
+		letters = []DeadLetter{}
+	}
+	return letters, nil
+}
+
+// appendLine 追加一行到文件，目录不存在时创建
+func appendLine(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// subscribed 是否有webhook订阅了该事件类型
+func subscribed(cfg *config.NotifyConfig, eventType string) bool {
+	for _, webhook := range cfg.Webhooks {
+		if webhook != nil && webhook.Subscribed(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookNames 已配置的webhook名称，按名称排序
+func webhookNames(cfg config.NotifyConfig) []string {
+	names := make([]string, 0, len(cfg.Webhooks))
+	for name, webhook := range cfg.Webhooks {
+		if webhook != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func knownEvent(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// newEventID 随机事件ID，接收方可以按ID去重
+func newEventID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,336 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+)
+
+// receiver 记录收到的webhook请求，按脚本返回状态码，脚本用完后返回200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	server   *httptest.Server
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.requests++
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// testConfig 单个webhook的通知配置，重试间隔很短以加快测试
+func testConfig(t *testing.T, webhook *config.WebhookConfig) config.NotifyConfig {
+	return config.NotifyConfig{
+		Webhooks:       map[string]*config.WebhookConfig{"ops": webhook},
+		Timeout:        time.Second,
+		MaxRetries:     2,
+		RetryBackoff:   time.Millisecond,
+		DeadLetterFile: filepath.Join(t.TempDir(), "dead_letters.jsonl"),
+	}
+}
+
+// run 在后台运行通知器，测试结束时停止并等待投递结束
+func run(t *testing.T, n *Notifier) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		n.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func testEvent() Event {
+	return Event{
+		ID:        "evt_1",
+		Type:      EventAccountQuarantined,
+		Severity:  SeverityCritical,
+		Time:      time.Unix(1760000000, 0),
+		AccountID: "acc_1",
+		Account:   "alice",
+		Message:   "OAuth token has been revoked",
+		Details:   map[string]string{"reason": "token_revoked"},
+	}
+}
+
+func TestJSONWebhookSignature(t *testing.T) {
+	webhook := &config.WebhookConfig{URL: "http://example.com/hook", Secret: "s3cret", Format: config.WebhookFormatJSON}
+	req, err := newRequest(context.Background(), webhook, testEvent(), time.Unix(1760000000, 0))
+	if err != nil {
+		t.Fatalf("构造请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(req.Body)
+
+	if req.Header.Get(HeaderEvent) != EventAccountQuarantined || req.Header.Get(HeaderDelivery) != "evt_1" {
+		t.Errorf("缺少事件类型或投递ID请求头: %v", req.Header)
+	}
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if timestamp != "1760000000" {
+		t.Errorf("时间戳不正确: %q", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get(HeaderSignature); got != want {
+		t.Errorf("签名不正确: %s，应为 %s", got, want)
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil || event.Account != "alice" || event.Details["reason"] != "token_revoked" {
+		t.Errorf("请求体应为事件本身: %s", body)
+	}
+
+	// 未配置secret时不签名
+	webhook.Secret = ""
+	req, _ = newRequest(context.Background(), webhook, testEvent(), time.Now())
+	if req.Header.Get(HeaderSignature) != "" {
+		t.Errorf("未配置secret时不应签名")
+	}
+}
+
+func TestBotPayloads(t *testing.T) {
+	now := time.UnixMilli(1760000000123)
+
+	t.Run("slack", func(t *testing.T) {
+		req, _ := newRequest(context.Background(), &config.WebhookConfig{URL: "http://example.com", Format: config.WebhookFormatSlack}, testEvent(), now)
+		var payload struct{ Text string }
+		decode(t, req, &payload)
+		if !strings.Contains(payload.Text, "账户已隔离") || !strings.Contains(payload.Text, "alice") {
+			t.Errorf("消息内容不正确: %q", payload.Text)
+		}
+	})
+
+	t.Run("feishu", func(t *testing.T) {
+		req, _ := newRequest(context.Background(), &config.WebhookConfig{URL: "http://example.com", Secret: "s3cret", Format: config.WebhookFormatFeishu}, testEvent(), now)
+		var payload struct {
+			MsgType   string `json:"msg_type"`
+			Content   struct{ Text string }
+			Timestamp string
+			Sign      string
+		}
+		decode(t, req, &payload)
+		mac := hmac.New(sha256.New, []byte("1760000000\ns3cret"))
+		if payload.MsgType != "text" || !strings.Contains(payload.Content.Text, "alice") ||
+			payload.Timestamp != "1760000000" || payload.Sign != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("飞书消息或签名不正确: %+v", payload)
+		}
+	})
+
+	t.Run("dingtalk", func(t *testing.T) {
+		req, _ := newRequest(context.Background(), &config.WebhookConfig{URL: "http://example.com/robot/send?access_token=abc", Secret: "s3cret", Format: config.WebhookFormatDingTalk}, testEvent(), now)
+		var payload struct {
+			MsgType string `json:"msgtype"`
+			Text    struct{ Content string }
+		}
+		decode(t, req, &payload)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte("1760000000123\ns3cret"))
+		query := req.URL.Query()
+		if payload.MsgType != "text" || !strings.Contains(payload.Text.Content, "alice") ||
+			query.Get("access_token") != "abc" || query.Get("timestamp") != "1760000000123" ||
+			query.Get("sign") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("钉钉消息或签名不正确: %+v %s", payload, req.URL)
+		}
+	})
+}
+
+func TestBotResponseErrors(t *testing.T) {
+	if err := checkBotResponse(config.WebhookFormatFeishu, []byte(`{"code":19021,"msg":"sign match fail"}`)); err == nil {
+		t.Errorf("飞书返回错误码时应视为失败")
+	}
+	if err := checkBotResponse(config.WebhookFormatDingTalk, []byte(`{"errcode":310000,"errmsg":"sign not match"}`)); err == nil {
+		t.Errorf("钉钉返回错误码时应视为失败")
+	}
+	if err := checkBotResponse(config.WebhookFormatDingTalk, []byte(`{"errcode":0,"errmsg":"ok"}`)); err != nil {
+		t.Errorf("钉钉返回0时应视为成功: %v", err)
+	}
+	if err := checkBotResponse(config.WebhookFormatJSON, []byte(`{"code":1}`)); err != nil {
+		t.Errorf("JSON格式不检查响应体: %v", err)
+	}
+}
+
+func TestRetryThenDeliver(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	n := New(testConfig(t, &config.WebhookConfig{URL: r.server.URL}))
+	run(t, n)
+
+	n.Notify(testEvent())
+	waitFor(t, "重试后投递成功", func() bool { return r.count() == 3 })
+	if letters, _ := n.DeadLetters(0); len(letters) != 0 {
+		t.Errorf("投递成功后不应写入死信日志: %+v", letters)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	r := newReceiver(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadRequest)
+	n := New(testConfig(t, &config.WebhookConfig{URL: r.server.URL}))
+	run(t, n)
+
+	// 重试用尽
+	n.Notify(testEvent())
+	waitFor(t, "写入死信日志", func() bool {
+		letters, _ := n.DeadLetters(0)
+		return len(letters) == 1
+	})
+	if r.count() != 3 {
+		t.Errorf("应请求3次（1次+2次重试），实际 %d 次", r.count())
+	}
+
+	// 4xx不重试
+	event := testEvent()
+	event.Type = EventProxyDown
+	n.Notify(event)
+	waitFor(t, "写入死信日志", func() bool {
+		letters, _ := n.DeadLetters(0)
+		return len(letters) == 2
+	})
+	if r.count() != 4 {
+		t.Errorf("4xx不应重试，实际请求 %d 次", r.count())
+	}
+
+	letters, err := n.DeadLetters(1)
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("读取死信日志失败: %v %+v", err, letters)
+	}
+	if letters[0].Webhook != "ops" || letters[0].Attempts != 1 || letters[0].Event.Type != EventProxyDown ||
+		!strings.Contains(letters[0].Error, "400") {
+		t.Errorf("死信记录不正确（应按时间从新到旧）: %+v", letters[0])
+	}
+}
+
+func TestSlowWebhookIsolated(t *testing.T) {
+	// slow 每次请求耗时50ms并记录同时进行的请求数
+	var mu sync.Mutex
+	inflight, maxInflight, slowCount := 0, 0, 0
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		inflight++
+		maxInflight = max(maxInflight, inflight)
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		slowCount++
+		mu.Unlock()
+	}))
+	t.Cleanup(slow.Close)
+	fast := newReceiver(t)
+
+	cfg := testConfig(t, &config.WebhookConfig{URL: fast.server.URL})
+	cfg.Webhooks["slow"] = &config.WebhookConfig{URL: slow.URL}
+	n := New(cfg)
+	run(t, n)
+
+	for i := 0; i < 5; i++ {
+		event := testEvent()
+		event.AccountID = fmt.Sprintf("acc_%d", i)
+		n.Notify(event)
+	}
+	waitFor(t, "快速webhook收到全部通知", func() bool { return fast.count() == 5 })
+	mu.Lock()
+	if slowCount == 5 {
+		t.Errorf("快速webhook不应等待慢webhook投递完成")
+	}
+	mu.Unlock()
+
+	waitFor(t, "慢webhook收到全部通知", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return slowCount == 5
+	})
+	if maxInflight != 1 {
+		t.Errorf("同一webhook应按顺序投递，同时进行的请求最多 %d 个", maxInflight)
+	}
+}
+
+func TestDedupeAndSubscriptions(t *testing.T) {
+	r := newReceiver(t)
+	cfg := testConfig(t, &config.WebhookConfig{URL: r.server.URL, Events: []string{EventAccountQuarantined}})
+	cfg.DedupeWindow = time.Hour
+	n := New(cfg)
+	run(t, n)
+
+	n.Notify(testEvent())
+	n.Notify(testEvent()) // 去重窗口内同一账户的同类事件
+	other := testEvent()
+	other.AccountID = "acc_2"
+	n.Notify(other)
+	n.Notify(Event{Type: EventRateLimitEntered, AccountID: "acc_1"}) // 未订阅
+	waitFor(t, "投递两条通知", func() bool { return r.count() >= 2 })
+
+	time.Sleep(50 * time.Millisecond)
+	if r.count() != 2 {
+		t.Errorf("去重和订阅过滤后应只投递2条，实际 %d 条", r.count())
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	r := newReceiver(t, http.StatusServiceUnavailable)
+	n := New(testConfig(t, &config.WebhookConfig{URL: r.server.URL}))
+
+	results, err := n.Test(context.Background(), "")
+	if err != nil || results["ops"] == nil {
+		t.Fatalf("测试通知失败时应返回错误且不重试: %v %v", err, results)
+	}
+	results, err = n.Test(context.Background(), "ops")
+	if err != nil || results["ops"] != nil {
+		t.Fatalf("测试通知应投递成功: %v %v", err, results)
+	}
+	if _, err := n.Test(context.Background(), "nobody"); err == nil {
+		t.Errorf("不存在的webhook应返回错误")
+	}
+}
+
+func decode(t *testing.T, req *http.Request, v any) {
+	t.Helper()
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		t.Fatalf("解析请求体失败: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// accountIDPrefix 账户ID前缀
+	accountIDPrefix = "acct_"
+	// maxAccountNameLength 账户名最大长度
+	maxAccountNameLength = 64
+)
+
+var (
+	accountIDPattern   = regexp.MustCompile(`^acct_[0-9a-f]{16}$`)
+	accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	statePattern       = regexp.MustCompile(`^[0-9a-f]{1,128}$`)
+)
+
+// NewAccountID 生成稳定的账户ID（acct_ + 16位十六进制）
+func NewAccountID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("生成账户ID失败: %w", err)
+	}
+	return accountIDPrefix + hex.EncodeToString(bytes), nil
+}
+
+// IsAccountID 判断字符串是否为合法的账户ID
+func IsAccountID(s string) bool {
+	return accountIDPattern.MatchString(s)
+}
+
+// ValidateAccountName 校验账户名是否符合slug规则：
+// 小写字母、数字、下划线和连字符，以字母或数字开头，最长64个字符
+func ValidateAccountName(name string) error {
+	if name == "" {
+		return fmt.Errorf("账户名不能为空")
+	}
+	if len(name) > maxAccountNameLength {
+		return fmt.Errorf("账户名不能超过%d个字符", maxAccountNameLength)
+	}
+	if !accountNamePattern.MatchString(name) {
+		return fmt.Errorf("账户名只能包含小写字母、数字、下划线和连字符，且必须以字母或数字开头: %q", name)
+	}
+	if IsAccountID(name) {
+		return fmt.Errorf("账户名不能与账户ID格式相同: %q", name)
+	}
+	return nil
+}
+
+// SlugifyAccountName 将任意字符串转换为合法的账户名（用于迁移旧数据）
+func SlugifyAccountName(s string) string {
+	var b strings.Builder
+	lastDash := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+			lastDash = false
+		case !lastDash && b.Len() > 0:
+			b.WriteRune('-')
+			lastDash = true
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-_")
+	if len(slug) > maxAccountNameLength {
+		slug = strings.Trim(slug[:maxAccountNameLength], "-_")
+	}
+	if slug == "" || IsAccountID(slug) {
+		return "account"
+	}
+	return slug
+}
+
+// isValidState 校验PKCE state格式，防止被拼接进文件路径
+func isValidState(state string) bool {
+	return statePattern.MatchString(state)
+}
@@ -0,0 +1,186 @@
+package oauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	backupFormat     = "claude-relay-backup"
+	backupVersion    = 1
+	backupKDF        = "pbkdf2-sha256"
+	backupIterations = 600000
+
+	// 恢复时接受的迭代次数范围：迭代次数来自备份文件本身，不设上限会被构造的文件拖住CPU，
+	// 过低则说明文件不是本程序导出的
+	minBackupIterations = backupIterations / 6
+	maxBackupIterations = backupIterations * 4
+
+	// MinBackupPassphraseLength 备份口令最小长度
+	MinBackupPassphraseLength = 8
+)
+
+// 备份恢复结果
+const (
+	RestoreStatusRestored = "restored" // 新建或覆盖
+	RestoreStatusSkipped  = "skipped"  // 已存在且未要求覆盖
+	RestoreStatusFailed   = "failed"
+)
+
+// ErrBadPassphrase 备份口令错误或备份已损坏
+var ErrBadPassphrase = errors.New("备份口令错误或备份文件已损坏")
+
+// Backup 加密的账户备份包
+type Backup struct {
+	Format       string    `json:"format"`
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"created_at"`
+	AccountCount int       `json:"account_count"`
+
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// backupPayload 备份包解密后的内容
+type backupPayload struct {
+	Accounts []*OAuthData `json:"accounts"`
+}
+
+// RestoreResult 单个账户的恢复结果
+type RestoreResult struct {
+	AccountName string `json:"account_name"`
+	AccountID   string `json:"account_id"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ExportBackup 导出全部账户（含代理配置）为加密备份包
+func (s *Storage) ExportBackup(passphrase string) (*Backup, error) {
+	if len(passphrase) < MinBackupPassphraseLength {
+		return nil, fmt.Errorf("备份口令至少需要%d个字符", MinBackupPassphraseLength)
+	}
+
+	s.mu.Lock()
+	accounts, err := s.scanAccounts()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(&backupPayload{Accounts: accounts})
+	if err != nil {
+		return nil, fmt.Errorf("序列化备份数据失败: %w", err)
+	}
+
+	backup := &Backup{
+		Format:       backupFormat,
+		Version:      backupVersion,
+		CreatedAt:    time.Now(),
+		AccountCount: len(accounts),
+		KDF:          backupKDF,
+		Iterations:   backupIterations,
+		Salt:         make([]byte, 16),
+	}
+	if _, err := rand.Read(backup.Salt); err != nil {
+		return nil, fmt.Errorf("生成备份盐值失败: %w", err)
+	}
+
+	aead, err := backup.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	backup.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(backup.Nonce); err != nil {
+		return nil, fmt.Errorf("生成备份随机数失败: %w", err)
+	}
+	backup.Ciphertext = aead.Seal(nil, backup.Nonce, plaintext, backup.additionalData())
+
+	return backup, nil
+}
+
+// RestoreBackup 从加密备份包恢复账户。账户ID已存在时只有overwrite为true才覆盖，
+// 账户名被其他账户占用时该账户恢复失败。
+func (s *Storage) RestoreBackup(backup *Backup, passphrase string, overwrite bool) ([]*RestoreResult, error) {
+	if backup.Format != backupFormat {
+		return nil, fmt.Errorf("不是有效的备份文件: format=%q", backup.Format)
+	}
+	if backup.Version != backupVersion || backup.KDF != backupKDF {
+		return nil, fmt.Errorf("不支持的备份版本: version=%d kdf=%s", backup.Version, backup.KDF)
+	}
+
+	aead, err := backup.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(backup.Nonce) != aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+
+	plaintext, err := aead.Open(nil, backup.Nonce, backup.Ciphertext, backup.additionalData())
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+
+	var payload backupPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("解析备份数据失败: %w", err)
+	}
+
+	results := make([]*RestoreResult, 0, len(payload.Accounts))
+	for _, data := range payload.Accounts {
+		result := &RestoreResult{AccountName: data.Name, AccountID: data.ID, Status: RestoreStatusRestored}
+		results = append(results, result)
+
+		if !overwrite {
+			if _, err := s.LoadOAuthData(data.ID); err == nil {
+				result.Status = RestoreStatusSkipped
+				continue
+			}
+		}
+
+		if err := s.SaveOAuthData(data); err != nil {
+			result.Status = RestoreStatusFailed
+			result.Error = err.Error()
+		}
+	}
+
+	return results, nil
+}
+
+// cipher 由口令派生AES-256-GCM密钥
+func (b *Backup) cipher(passphrase string) (cipher.AEAD, error) {
+	if b.Iterations <= 0 || len(b.Salt) == 0 {
+		return nil, fmt.Errorf("备份文件缺少密钥派生参数")
+	}
+	if b.Iterations < minBackupIterations || b.Iterations > maxBackupIterations {
+		return nil, fmt.Errorf("不支持的备份密钥派生参数: iterations=%d，应在%d到%d之间",
+			b.Iterations, minBackupIterations, maxBackupIterations)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, b.Salt, b.Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("派生备份密钥失败: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建备份加密器失败: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData 将备份头部信息纳入认证，防止被篡改
+func (b *Backup) additionalData() []byte {
+	return []byte(fmt.Sprintf("%s/%d/%d", b.Format, b.Version, b.AccountCount))
+}
@@ -0,0 +1,58 @@
+package oauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestoreBackup(t *testing.T) {
+	source := NewStorage(t.TempDir())
+	id, err := NewAccountID()
+	if err != nil {
+		t.Fatalf("生成账户ID失败: %v", err)
+	}
+	account := &OAuthData{ID: id, Name: "alice", AccessToken: "access", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := source.SaveOAuthData(account); err != nil {
+		t.Fatalf("保存账户失败: %v", err)
+	}
+
+	backup, err := source.ExportBackup("passphrase")
+	if err != nil {
+		t.Fatalf("导出备份失败: %v", err)
+	}
+
+	target := NewStorage(t.TempDir())
+	if _, err := target.RestoreBackup(backup, "wrong-passphrase", false); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("口令错误时应返回 ErrBadPassphrase，实际 %v", err)
+	}
+	results, err := target.RestoreBackup(backup, "passphrase", false)
+	if err != nil || len(results) != 1 || results[0].Status != RestoreStatusRestored {
+		t.Fatalf("恢复备份失败: %v %+v", err, results)
+	}
+	if restored, err := target.LoadOAuthData("alice"); err != nil || restored.ID != id || restored.RefreshToken != "refresh" {
+		t.Errorf("恢复的账户不正确: %v %+v", err, restored)
+	}
+}
+
+func TestRestoreBackupRejectsIterations(t *testing.T) {
+	for _, iterations := range []int{1, minBackupIterations - 1, maxBackupIterations + 1, 1 << 40} {
+		backup := &Backup{
+			Format:     backupFormat,
+			Version:    backupVersion,
+			KDF:        backupKDF,
+			Iterations: iterations,
+			Salt:       make([]byte, 16),
+		}
+
+		start := time.Now()
+		_, err := NewStorage(t.TempDir()).RestoreBackup(backup, "passphrase", false)
+		if err == nil || !strings.Contains(err.Error(), "iterations") {
+			t.Errorf("迭代次数 %d 应被拒绝，实际 %v", iterations, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("迭代次数 %d 应在派生密钥前被拒绝，耗时 %v", iterations, elapsed)
+		}
+	}
+}
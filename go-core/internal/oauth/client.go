@@ -2,50 +2,72 @@ package oauth
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/metrics"
+	"claude-relay-core/internal/tracing"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client OAuth客户端
 type Client struct {
-	config     *config.Config
-	httpClient *http.Client
+	config atomic.Pointer[config.Config]
 }
 
 // NewClient 创建OAuth客户端
 func NewClient(cfg *config.Config) *Client {
-	return &Client{
-		config: cfg,
-		httpClient: &http.Client{
-			Timeout: cfg.Proxy.Timeout,
-		},
-	}
+	c := &Client{}
+	c.config.Store(cfg)
+	return c
+}
+
+// Config 返回当前生效的配置
+func (c *Client) Config() *config.Config {
+	return c.config.Load()
+}
+
+// UpdateConfig 热更新配置，已发出的请求不受影响
+func (c *Client) UpdateConfig(cfg *config.Config) {
+	c.config.Store(cfg)
 }
 
 // ExchangeCodeForToken 交换授权码获取token
-func (c *Client) ExchangeCodeForToken(authorizationCode, codeVerifier, state string, proxyConfig *ProxyConfig) (*OAuthData, error) {
-	// 清理授权码，移除URL片段
+func (c *Client) ExchangeCodeForToken(ctx context.Context, authorizationCode string, pkceData *PKCEData, proxyConfig *ProxyConfig) (*OAuthData, error) {
+	// 清理授权码，移除手动复制时可能带上的URL片段（loopback回调拿到的是干净的code）
 	cleanedCode := strings.Split(authorizationCode, "#")[0]
 	cleanedCode = strings.Split(cleanedCode, "&")[0]
 
+	// redirect_uri必须与生成授权URL时一致，旧版PKCE会话没有记录时使用默认值
+	redirectURI := pkceData.RedirectURI
+	if redirectURI == "" {
+		redirectURI = c.Config().OAuth.RedirectURI
+	}
+
 	// 构建请求参数
 	params := map[string]string{
 		"grant_type":    "authorization_code",
-		"client_id":     c.config.OAuth.ClientID,
+		"client_id":     c.Config().OAuth.ClientID,
 		"code":          cleanedCode,
-		"redirect_uri":  c.config.OAuth.RedirectURI,
-		"code_verifier": codeVerifier,
-		"state":         state,
+		"redirect_uri":  redirectURI,
+		"code_verifier": pkceData.CodeVerifier,
+		"state":         pkceData.State,
 	}
 
 	// 发送token交换请求
-	tokenResp, err := c.sendTokenRequest(params, proxyConfig)
+	ctx, span := tracing.Start(ctx, "oauth.ExchangeCodeForToken", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	tokenResp, err := c.sendTokenRequest(tracing.WithClientTrace(ctx), params, proxyConfig)
+	metrics.ObserveOAuth("exchange", start, err)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("token交换失败: %w", err)
 	}
@@ -66,16 +88,20 @@ func (c *Client) ExchangeCodeForToken(authorizationCode, codeVerifier, state str
 }
 
 // RefreshAccessToken 刷新访问token
-func (c *Client) RefreshAccessToken(refreshToken string, proxyConfig *ProxyConfig) (*OAuthData, error) {
+func (c *Client) RefreshAccessToken(ctx context.Context, refreshToken string, proxyConfig *ProxyConfig) (*OAuthData, error) {
 	// 构建刷新请求参数
 	params := map[string]string{
 		"grant_type":    "refresh_token",
 		"refresh_token": refreshToken,
-		"client_id":     c.config.OAuth.ClientID,
+		"client_id":     c.Config().OAuth.ClientID,
 	}
 
 	// 发送token刷新请求
-	tokenResp, err := c.sendTokenRequest(params, proxyConfig)
+	ctx, span := tracing.Start(ctx, "oauth.RefreshAccessToken", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	tokenResp, err := c.sendTokenRequest(tracing.WithClientTrace(ctx), params, proxyConfig)
+	metrics.ObserveOAuth("refresh", start, err)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("token刷新失败: %w", err)
 	}
@@ -84,9 +110,15 @@ func (c *Client) RefreshAccessToken(refreshToken string, proxyConfig *ProxyConfi
 	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
 	scopes := strings.Fields(tokenResp.Scope)
 
+	// 服务端未轮换refresh token时继续使用原token
+	newRefreshToken := tokenResp.RefreshToken
+	if newRefreshToken == "" {
+		newRefreshToken = refreshToken
+	}
+
 	oauthData := &OAuthData{
 		AccessToken:  tokenResp.AccessToken,
-		RefreshToken: tokenResp.RefreshToken,
+		RefreshToken: newRefreshToken,
 		ExpiresAt:    expiresAt,
 		Scopes:       scopes,
 		ProxyConfig:  proxyConfig,
@@ -96,7 +128,7 @@ func (c *Client) RefreshAccessToken(refreshToken string, proxyConfig *ProxyConfi
 }
 
 // sendTokenRequest 发送token请求的通用方法
-func (c *Client) sendTokenRequest(params map[string]string, proxyConfig *ProxyConfig) (*TokenResponse, error) {
+func (c *Client) sendTokenRequest(ctx context.Context, params map[string]string, proxyConfig *ProxyConfig) (*TokenResponse, error) {
 	// 构建请求体
 	jsonData, err := json.Marshal(params)
 	if err != nil {
@@ -104,7 +136,7 @@ func (c *Client) sendTokenRequest(params map[string]string, proxyConfig *ProxyCo
 	}
 
 	// 创建HTTP请求
-	req, err := http.NewRequest("POST", c.config.OAuth.TokenURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Config().OAuth.TokenURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -118,32 +150,9 @@ func (c *Client) sendTokenRequest(params map[string]string, proxyConfig *ProxyCo
 	req.Header.Set("Origin", "https://claude.ai")
 
 	// 配置代理（优先使用全局代理，然后是请求特定代理）
-	httpClient := c.httpClient
-	var finalProxyConfig *ProxyConfig
-	
-	// 优先使用全局代理配置
-	if c.config.Proxy.GlobalProxy != nil && c.config.Proxy.GlobalProxy.Enabled {
-		finalProxyConfig = &ProxyConfig{
-			Type:     c.config.Proxy.GlobalProxy.Type,
-			Host:     c.config.Proxy.GlobalProxy.Host,
-			Port:     c.config.Proxy.GlobalProxy.Port,
-			Username: c.config.Proxy.GlobalProxy.Username,
-			Password: c.config.Proxy.GlobalProxy.Password,
-		}
-	} else if proxyConfig != nil {
-		// 如果没有全局代理，使用请求特定的代理
-		finalProxyConfig = proxyConfig
-	}
-	
-	if finalProxyConfig != nil {
-		transport, err := createProxyTransport(finalProxyConfig)
-		if err != nil {
-			return nil, fmt.Errorf("创建代理传输失败: %w", err)
-		}
-		httpClient = &http.Client{
-			Transport: transport,
-			Timeout:   c.config.Proxy.Timeout,
-		}
+	httpClient, err := c.proxyHTTPClient(proxyConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	// 发送请求
@@ -171,4 +180,37 @@ func (c *Client) sendTokenRequest(params map[string]string, proxyConfig *ProxyCo
 	}
 
 	return &tokenResp, nil
-}
\ No newline at end of file
+}
+
+// proxyHTTPClient 返回使用代理的HTTP客户端：优先使用全局代理，然后是请求特定代理，都没有时直连
+func (c *Client) proxyHTTPClient(proxyConfig *ProxyConfig) (*http.Client, error) {
+	cfg := c.Config()
+	var finalProxyConfig *ProxyConfig
+	
+	// 优先使用全局代理配置
+	if cfg.Proxy.GlobalProxy != nil && cfg.Proxy.GlobalProxy.Enabled {
+		finalProxyConfig = &ProxyConfig{
+			Type:     cfg.Proxy.GlobalProxy.Type,
+			Host:     cfg.Proxy.GlobalProxy.Host,
+			Port:     cfg.Proxy.GlobalProxy.Port,
+			Username: cfg.Proxy.GlobalProxy.Username,
+			Password: cfg.Proxy.GlobalProxy.Password,
+		}
+	} else if proxyConfig != nil {
+		// 如果没有全局代理，使用请求特定的代理
+		finalProxyConfig = proxyConfig
+	}
+	
+	if finalProxyConfig != nil {
+		transport, err := createProxyTransport(finalProxyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("创建代理传输失败: %w", err)
+		}
+		return &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Proxy.Timeout,
+		}, nil
+	}
+	return &http.Client{Timeout: cfg.Proxy.Timeout}, nil
+}
+
@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/url"
+	"time"
 
 	"claude-relay-core/internal/config"
 )
@@ -42,23 +43,31 @@ func GenerateState() (string, error) {
 }
 
 // GenerateAuthURL 生成OAuth授权URL
-func GenerateAuthURL(cfg *config.Config, codeChallenge, state string) string {
+func GenerateAuthURL(cfg *config.Config, redirectURI, codeChallenge, state string) string {
 	params := url.Values{
-		"code":                  {"true"},
 		"client_id":             {cfg.OAuth.ClientID},
 		"response_type":         {"code"},
-		"redirect_uri":          {cfg.OAuth.RedirectURI},
+		"redirect_uri":          {redirectURI},
 		"scope":                 {cfg.OAuth.Scopes},
 		"code_challenge":        {codeChallenge},
 		"code_challenge_method": {"S256"},
 		"state":                 {state},
 	}
 
+	// 使用托管回调页面时要求授权服务器展示授权码供手动复制
+	if redirectURI == cfg.OAuth.RedirectURI {
+		params.Set("code", "true")
+	}
+
 	return fmt.Sprintf("%s?%s", cfg.OAuth.AuthorizeURL, params.Encode())
 }
 
-// GenerateOAuthParams 生成完整的OAuth参数
-func GenerateOAuthParams(cfg *config.Config) (*PKCEData, error) {
+// GenerateOAuthParams 生成完整的OAuth参数，redirectURI为空时使用托管回调地址
+func GenerateOAuthParams(cfg *config.Config, redirectURI string) (*PKCEData, error) {
+	if redirectURI == "" {
+		redirectURI = cfg.OAuth.RedirectURI
+	}
+
 	// 生成code verifier
 	codeVerifier, err := GenerateCodeVerifier()
 	if err != nil {
@@ -75,12 +84,16 @@ func GenerateOAuthParams(cfg *config.Config) (*PKCEData, error) {
 	}
 
 	// 生成授权URL
-	authURL := GenerateAuthURL(cfg, codeChallenge, state)
+	authURL := GenerateAuthURL(cfg, redirectURI, codeChallenge, state)
 
+	now := time.Now()
 	return &PKCEData{
 		CodeVerifier:  codeVerifier,
 		CodeChallenge: codeChallenge,
 		State:         state,
 		AuthURL:       authURL,
+		RedirectURI:   redirectURI,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(cfg.OAuth.PKCETTL),
 	}, nil
 }
\ No newline at end of file
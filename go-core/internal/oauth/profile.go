@@ -0,0 +1,165 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"claude-relay-core/internal/metrics"
+)
+
+// 订阅类型
+const (
+	SubscriptionFree       = "free"
+	SubscriptionPro        = "pro"
+	SubscriptionTeam       = "team"
+	SubscriptionMax        = "max"
+	SubscriptionEnterprise = "enterprise"
+)
+
+// ProfileScope 读取账户资料所需的scope
+const ProfileScope = "user:profile"
+
+// Profile 账户资料：邮箱、组织和订阅类型
+type Profile struct {
+	AccountUUID      string    `json:"account_uuid,omitempty"`
+	Email            string    `json:"email,omitempty"`
+	FullName         string    `json:"full_name,omitempty"`
+	OrganizationUUID string    `json:"organization_uuid,omitempty"`
+	OrganizationName string    `json:"organization_name,omitempty"`
+	SubscriptionType string    `json:"subscription_type,omitempty"`
+	RateLimitTier    string    `json:"rate_limit_tier,omitempty"`
+	FetchedAt        time.Time `json:"fetched_at"`
+}
+
+// profileResponse OAuth profile接口响应
+type profileResponse struct {
+	Account struct {
+		UUID         string `json:"uuid"`
+		Email        string `json:"email"`
+		FullName     string `json:"full_name"`
+		HasClaudeMax bool   `json:"has_claude_max"`
+		HasClaudePro bool   `json:"has_claude_pro"`
+	} `json:"account"`
+	Organization struct {
+		UUID             string `json:"uuid"`
+		Name             string `json:"name"`
+		OrganizationType string `json:"organization_type"`
+		RateLimitTier    string `json:"rate_limit_tier"`
+	} `json:"organization"`
+}
+
+// HasScope 检查token是否包含指定scope
+func (o *OAuthData) HasScope(scope string) bool {
+	return slices.Contains(o.Scopes, scope)
+}
+
+// FetchProfile 使用访问token读取账户资料（需要 user:profile scope），经账户绑定的代理请求
+func (c *Client) FetchProfile(ctx context.Context, accessToken string, proxyConfig *ProxyConfig) (profile *Profile, err error) {
+	defer func(start time.Time) { metrics.ObserveOAuth("profile", start, err) }(time.Now())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.Config().OAuth.ProfileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("anthropic-beta", "oauth-2025-04-20")
+
+	httpClient, err := c.proxyHTTPClient(proxyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP错误 %d: %s", resp.StatusCode, string(body))
+	}
+
+	var profileResp profileResponse
+	if err := json.Unmarshal(body, &profileResp); err != nil {
+		return nil, fmt.Errorf("解析账户资料失败: %w", err)
+	}
+
+	return &Profile{
+		AccountUUID:      profileResp.Account.UUID,
+		Email:            profileResp.Account.Email,
+		FullName:         profileResp.Account.FullName,
+		OrganizationUUID: profileResp.Organization.UUID,
+		OrganizationName: profileResp.Organization.Name,
+		SubscriptionType: subscriptionType(&profileResp),
+		RateLimitTier:    profileResp.Organization.RateLimitTier,
+		FetchedAt:        time.Now(),
+	}, nil
+}
+
+// UpdateProfile 读取并保存账户资料。token缺少 user:profile scope 时返回错误，账户数据不变
+func UpdateProfile(ctx context.Context, client *Client, storage *Storage, accountRef string) (*OAuthData, error) {
+	data, err := storage.LoadOAuthData(accountRef)
+	if err != nil {
+		return nil, err
+	}
+	if !data.HasScope(ProfileScope) {
+		return nil, fmt.Errorf("账户token缺少 %s scope，无法读取账户资料", ProfileScope)
+	}
+
+	profile, err := client.FetchProfile(ctx, data.AccessToken, data.ProxyConfig)
+	if err != nil {
+		return nil, fmt.Errorf("读取账户资料失败: %w", err)
+	}
+
+	return storage.UpdateAccount(data.ID, func(d *OAuthData) error {
+		d.Profile = profile
+		return nil
+	})
+}
+
+// SubscriptionRank 订阅等级排序值，越高额度越高，未知类型为0
+func SubscriptionRank(subscriptionType string) int {
+	switch subscriptionType {
+	case SubscriptionMax, SubscriptionEnterprise:
+		return 3
+	case SubscriptionTeam:
+		return 2
+	case SubscriptionPro:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// subscriptionType 由组织类型推断订阅类型，组织类型未知时回退到账户标记
+func subscriptionType(resp *profileResponse) string {
+	switch resp.Organization.OrganizationType {
+	case "claude_max":
+		return SubscriptionMax
+	case "claude_pro":
+		return SubscriptionPro
+	case "claude_team":
+		return SubscriptionTeam
+	case "claude_enterprise":
+		return SubscriptionEnterprise
+	}
+
+	switch {
+	case resp.Account.HasClaudeMax:
+		return SubscriptionMax
+	case resp.Account.HasClaudePro:
+		return SubscriptionPro
+	default:
+		return SubscriptionFree
+	}
+}
@@ -47,6 +47,10 @@ func createSOCKS5Transport(proxyConfig *ProxyConfig) (http.RoundTripper, error)
 	transport := &http.Transport{
 		Dial: dialer.Dial,
 	}
+	// 优先使用支持context的拨号：请求取消时中断连接，到代理的连接也能被链路追踪记录
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		transport.DialContext = contextDialer.DialContext
+	}
 
 	return transport, nil
 }
@@ -1,142 +1,661 @@
 package oauth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	// ErrAccountNotFound 账户不存在
+	ErrAccountNotFound = errors.New("账户不存在")
+	// ErrAccountExists 账户已存在
+	ErrAccountExists = errors.New("账户已存在")
+	// ErrPKCENotFound PKCE会话不存在
+	ErrPKCENotFound = errors.New("PKCE会话不存在")
+	// ErrPKCEExpired PKCE会话已过期
+	ErrPKCEExpired = errors.New("PKCE会话已过期")
+)
+
+// accountUsePersistInterval 账户最近使用状态的持久化间隔，避免每个请求都重写账户文件
+const accountUsePersistInterval = time.Minute
+
 // Storage OAuth数据存储
+//
+// 账户文件以稳定的账户ID命名（oauth_<id>.json），账户名只保存在文件内容中，
+// 查找时可以使用账户ID或账户名。
 type Storage struct {
 	dataDir string
+
+	mu    sync.Mutex             // 保护账户文件的读-改-写操作、名称索引和使用状态
+	names map[string]string      // 账户名 -> 账户ID
+	uses  map[string]*accountUse // 账户ID -> 内存中的最近使用状态
+}
+
+// accountUse 账户最近一次使用结果，先记在内存中，按间隔写入账户文件
+type accountUse struct {
+	lastUsedAt  *time.Time
+	lastError   string
+	lastErrorAt *time.Time
+
+	dirty     bool      // 是否有尚未写入文件的变化
+	persisted time.Time // 最近一次写入文件的时间
+}
+
+// apply 把内存中的使用状态覆盖到账户数据上
+func (u *accountUse) apply(data *OAuthData) {
+	data.LastUsedAt = u.lastUsedAt
+	data.LastError = u.lastError
+	data.LastErrorAt = u.lastErrorAt
 }
 
 // NewStorage 创建存储实例
 func NewStorage(dataDir string) *Storage {
 	return &Storage{
 		dataDir: dataDir,
+		names:   make(map[string]string),
+		uses:    make(map[string]*accountUse),
 	}
 }
 
-// SaveOAuthData 保存OAuth数据到文件
-func (s *Storage) SaveOAuthData(accountName string, data *OAuthData) error {
-	// 确保数据目录存在
-	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
-		return fmt.Errorf("创建数据目录失败: %w", err)
-	}
+// SaveOAuthData 保存完整的OAuth数据到文件（data.ID必须已设置）
+func (s *Storage) SaveOAuthData(data *OAuthData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// 序列化数据
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return fmt.Errorf("序列化OAuth数据失败: %w", err)
+	if !IsAccountID(data.ID) {
+		return fmt.Errorf("无效的账户ID: %q", data.ID)
+	}
+	if err := ValidateAccountName(data.Name); err != nil {
+		return err
+	}
+	if id, err := s.lookupName(data.Name); err == nil && id != data.ID {
+		return fmt.Errorf("%w: %s", ErrAccountExists, data.Name)
 	}
 
-	// 写入文件
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("oauth_%s.json", accountName))
-	if err := os.WriteFile(filename, jsonData, 0600); err != nil {
-		return fmt.Errorf("写入OAuth数据文件失败: %w", err)
+	if err := s.saveOAuthData(data); err != nil {
+		return err
 	}
 
-	fmt.Printf("✅ OAuth数据已保存: %s\n", filename)
+	slog.Info("OAuth数据已保存", "account", data.Name, "account_id", data.ID)
 	return nil
 }
 
-// LoadOAuthData 从文件加载OAuth数据
-func (s *Storage) LoadOAuthData(accountName string) (*OAuthData, error) {
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("oauth_%s.json", accountName))
-	
-	// 检查文件是否存在
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return nil, fmt.Errorf("OAuth数据文件不存在: %s", filename)
+// SaveTokens 保存新的token，账户不存在时以accountRef为账户名创建新账户，
+// 已存在时保留其元数据
+func (s *Storage) SaveTokens(accountRef string, tokens *OAuthData) (*OAuthData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.findAccount(accountRef)
+	if errors.Is(err, ErrAccountNotFound) {
+		if err := ValidateAccountName(accountRef); err != nil {
+			return nil, err
+		}
+		id, err := NewAccountID()
+		if err != nil {
+			return nil, err
+		}
+		data = &OAuthData{ID: id, Name: accountRef, CreatedAt: time.Now()}
+	} else if err != nil {
+		return nil, err
 	}
 
-	// 读取文件
-	jsonData, err := os.ReadFile(filename)
+	data.SetTokens(tokens)
+	// 拿到可用的新token说明凭据已恢复
+	data.Quarantine = nil
+	data.UpdatedAt = time.Now()
+	if err := s.saveOAuthData(data); err != nil {
+		return nil, err
+	}
+
+	slog.Info("OAuth数据已保存", "account", data.Name, "account_id", data.ID)
+	return data, nil
+}
+
+// LoadOAuthData 根据账户ID或账户名加载OAuth数据
+func (s *Storage) LoadOAuthData(accountRef string) (*OAuthData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.findAccount(accountRef)
+}
+
+// UpdateAccount 以加锁的读-改-写方式更新账户数据，支持在update中修改账户名
+func (s *Storage) UpdateAccount(accountRef string, update func(data *OAuthData) error) (*OAuthData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.findAccount(accountRef)
 	if err != nil {
-		return nil, fmt.Errorf("读取OAuth数据文件失败: %w", err)
+		return nil, err
 	}
 
-	// 反序列化数据
-	var data OAuthData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		return nil, fmt.Errorf("反序列化OAuth数据失败: %w", err)
+	id, oldName := data.ID, data.Name
+	if err := update(data); err != nil {
+		return nil, err
 	}
+	data.ID = id
 
-	return &data, nil
+	// 重命名时校验新名称并检查冲突
+	if data.Name != oldName {
+		if err := ValidateAccountName(data.Name); err != nil {
+			return nil, err
+		}
+		if otherID, err := s.lookupName(data.Name); err == nil && otherID != id {
+			return nil, fmt.Errorf("%w: %s", ErrAccountExists, data.Name)
+		}
+		delete(s.names, oldName)
+	}
+
+	data.UpdatedAt = time.Now()
+	if err := s.saveOAuthData(data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
-// SavePKCEData 保存PKCE数据到临时文件
-func (s *Storage) SavePKCEData(state string, data *PKCEData) error {
-	// 确保数据目录存在
-	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
-		return fmt.Errorf("创建数据目录失败: %w", err)
+// RecordAccountUse 记录账户最近一次使用结果。结果立即对读取可见，
+// 但每个账户最多每 accountUsePersistInterval 写一次文件，其余由 FlushAccountUse 写入
+func (s *Storage) RecordAccountUse(accountRef string, useErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.findAccount(accountRef)
+	if err != nil {
+		return err
 	}
 
-	// 序列化数据
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+	use := s.uses[data.ID]
+	if use == nil {
+		use = &accountUse{lastUsedAt: data.LastUsedAt, lastError: data.LastError, lastErrorAt: data.LastErrorAt}
+		s.uses[data.ID] = use
+	}
+
+	now := time.Now()
+	use.lastUsedAt = &now
+	if useErr != nil {
+		use.lastError = useErr.Error()
+		use.lastErrorAt = &now
+	} else {
+		use.lastError = ""
+	}
+	use.dirty = true
+
+	if now.Sub(use.persisted) < accountUsePersistInterval {
+		return nil
+	}
+	return s.saveOAuthData(data)
+}
+
+// FlushAccountUse 把内存中尚未写入的账户使用状态写入账户文件
+func (s *Storage) FlushAccountUse() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for id, use := range s.uses {
+		if !use.dirty {
+			continue
+		}
+		data, err := s.loadOAuthData(id)
+		if errors.Is(err, ErrAccountNotFound) {
+			delete(s.uses, id)
+			continue
+		}
+		if err == nil {
+			err = s.saveOAuthData(data)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunAccountUseFlusher 定期写入账户使用状态，ctx被取消时最后写入一次后返回
+func (s *Storage) RunAccountUseFlusher(ctx context.Context) {
+	ticker := time.NewTicker(accountUsePersistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.FlushAccountUse(); err != nil {
+				slog.Warn("写入账户使用状态失败", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.FlushAccountUse(); err != nil {
+				slog.Warn("写入账户使用状态失败", "error", err)
+			}
+		}
+	}
+}
+
+// QuarantineAccount 隔离凭据已失效的账户，返回是否为新隔离；已隔离的账户保留最初的原因和时间
+func (s *Storage) QuarantineAccount(accountRef, reason, message string) (*OAuthData, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.findAccount(accountRef)
+	if err != nil {
+		return nil, false, err
+	}
+	if data.Quarantine != nil {
+		return data, false, nil
+	}
+
+	data.Quarantine = &Quarantine{Reason: reason, Message: message, At: time.Now()}
+	if err := s.saveOAuthData(data); err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// ReleaseAccount 解除账户隔离（管理操作），返回解除前是否处于隔离状态
+func (s *Storage) ReleaseAccount(accountRef string) (*OAuthData, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.findAccount(accountRef)
 	if err != nil {
-		return fmt.Errorf("序列化PKCE数据失败: %w", err)
+		return nil, false, err
+	}
+	if data.Quarantine == nil {
+		return data, false, nil
+	}
+
+	data.Quarantine = nil
+	data.UpdatedAt = time.Now()
+	if err := s.saveOAuthData(data); err != nil {
+		return nil, false, err
+	}
+
+	slog.Info("账户已解除隔离", "account", data.Name, "account_id", data.ID)
+	return data, true, nil
+}
+
+// DeleteAccount 删除账户，返回被删除账户的ID
+func (s *Storage) DeleteAccount(accountRef string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.findAccount(accountRef)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Remove(s.accountFile(data.ID)); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrAccountNotFound
+		}
+		return "", fmt.Errorf("删除OAuth数据文件失败: %w", err)
+	}
+	delete(s.names, data.Name)
+	delete(s.uses, data.ID)
+
+	slog.Info("OAuth数据已删除", "account", data.Name, "account_id", data.ID)
+	return data.ID, nil
+}
+
+// SavePKCEData 保存PKCE数据到临时文件
+func (s *Storage) SavePKCEData(state string, data *PKCEData) error {
+	if !isValidState(state) {
+		return fmt.Errorf("无效的state参数")
 	}
 
 	// 写入临时文件
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("pkce_%s.json", state))
-	if err := os.WriteFile(filename, jsonData, 0600); err != nil {
+	if err := s.writeJSONFile(s.pkceFile(state), data); err != nil {
 		return fmt.Errorf("写入PKCE数据文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// LoadPKCEData 从文件加载PKCE数据
+// LoadPKCEData 从文件加载PKCE数据，过期的会话会被删除并返回ErrPKCEExpired
 func (s *Storage) LoadPKCEData(state string) (*PKCEData, error) {
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("pkce_%s.json", state))
-	
-	// 检查文件是否存在
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return nil, fmt.Errorf("PKCE数据文件不存在: %s", filename)
+	if !isValidState(state) {
+		return nil, fmt.Errorf("%w: 无效的state参数", ErrPKCENotFound)
 	}
 
-	// 读取文件
-	jsonData, err := os.ReadFile(filename)
+	data, err := readPKCEFile(s.pkceFile(state))
 	if err != nil {
-		return nil, fmt.Errorf("读取PKCE数据文件失败: %w", err)
+		if os.IsNotExist(err) {
+			return nil, ErrPKCENotFound
+		}
+		return nil, err
 	}
 
-	// 反序列化数据
-	var data PKCEData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		return nil, fmt.Errorf("反序列化PKCE数据失败: %w", err)
+	if data.IsExpired() {
+		s.DeletePKCEData(state)
+		return nil, fmt.Errorf("%w (过期时间: %s)", ErrPKCEExpired, data.ExpiresAt.Format(time.RFC3339))
 	}
 
-	return &data, nil
+	return data, nil
 }
 
 // DeletePKCEData 删除PKCE临时数据
 func (s *Storage) DeletePKCEData(state string) error {
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("pkce_%s.json", state))
-	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+	if !isValidState(state) {
+		return nil
+	}
+
+	if err := os.Remove(s.pkceFile(state)); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("删除PKCE数据文件失败: %w", err)
 	}
 	return nil
 }
 
-// ListAccounts 列出所有已存储的账户
-func (s *Storage) ListAccounts() ([]string, error) {
+// SweepExpiredPKCE 删除所有已过期或无法解析的PKCE会话，返回删除数量
+func (s *Storage) SweepExpiredPKCE() (int, error) {
+	files, err := filepath.Glob(filepath.Join(s.dataDir, "pkce_*.json"))
+	if err != nil {
+		return 0, fmt.Errorf("扫描PKCE数据文件失败: %w", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		data, err := readPKCEFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil && !data.IsExpired() {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("删除PKCE数据文件失败: %w", err)
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// RunPKCESweeper 定期清理过期的PKCE会话，直到ctx被取消
+func (s *Storage) RunPKCESweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.SweepExpiredPKCE()
+			if err != nil {
+				slog.Warn("清理过期PKCE会话失败", "error", err)
+			} else if removed > 0 {
+				slog.Info("已清理过期PKCE会话", "count", removed)
+			}
+		}
+	}
+}
+
+// ListAccounts 列出所有已存储的账户，按优先级和名称排序
+func (s *Storage) ListAccounts() ([]*AccountInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.scanAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*AccountInfo, 0, len(all))
+	for _, data := range all {
+		accounts = append(accounts, data.Info())
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Priority != accounts[j].Priority {
+			return accounts[i].Priority > accounts[j].Priority
+		}
+		return accounts[i].Name < accounts[j].Name
+	})
+
+	return accounts, nil
+}
+
+// MigrateLegacyAccounts 将旧版按账户名命名的文件（oauth_<name>.json）迁移为按账户ID命名，
+// 返回迁移的账户数量
+func (s *Storage) MigrateLegacyAccounts() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	files, err := filepath.Glob(filepath.Join(s.dataDir, "oauth_*.json"))
+	if err != nil {
+		return 0, fmt.Errorf("扫描OAuth数据文件失败: %w", err)
+	}
+
+	// 先收集已占用的账户名，保证迁移后的名称唯一
+	taken := make(map[string]bool)
+	var legacy []string
+	for _, file := range files {
+		data, err := readOAuthFile(file)
+		if err != nil {
+			slog.Warn("跳过无法读取的账户文件", "file", filepath.Base(file), "error", err)
+			continue
+		}
+		if data.ID == "" {
+			legacy = append(legacy, file)
+			continue
+		}
+		taken[data.Name] = true
+	}
+
+	migrated := 0
+	for _, file := range legacy {
+		data, err := readOAuthFile(file)
+		if err != nil {
+			return migrated, err
+		}
+
+		legacyName := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "oauth_"), ".json")
+		name := SlugifyAccountName(legacyName)
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s-%d", SlugifyAccountName(legacyName), i)
+		}
+		taken[name] = true
+
+		id, err := NewAccountID()
+		if err != nil {
+			return migrated, err
+		}
+		data.ID = id
+		data.Name = name
+		if name != legacyName {
+			data.DisplayName = legacyName
+		}
+		if data.CreatedAt.IsZero() {
+			data.CreatedAt = time.Now()
+		}
+		data.UpdatedAt = time.Now()
+
+		if err := s.saveOAuthData(data); err != nil {
+			return migrated, err
+		}
+		if err := os.Remove(file); err != nil {
+			return migrated, fmt.Errorf("删除旧版账户文件失败: %w", err)
+		}
+
+		slog.Info("账户已迁移", "from", legacyName, "account", name, "account_id", id)
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// findAccount 根据账户ID或账户名查找账户（调用方负责加锁）
+func (s *Storage) findAccount(accountRef string) (*OAuthData, error) {
+	if IsAccountID(accountRef) {
+		return s.loadOAuthData(accountRef)
+	}
+
+	id, err := s.lookupName(accountRef)
+	if err != nil {
+		return nil, err
+	}
+	return s.loadOAuthData(id)
+}
+
+// lookupName 通过名称索引查找账户ID，索引失效时重新扫描（调用方负责加锁）
+func (s *Storage) lookupName(name string) (string, error) {
+	if id, ok := s.names[name]; ok {
+		if data, err := s.loadOAuthData(id); err == nil && data.Name == name {
+			return id, nil
+		}
+	}
+
+	// 索引未命中或已过期（例如文件被外部工具修改），重新扫描
+	if _, err := s.scanAccounts(); err != nil {
+		return "", err
+	}
+	if id, ok := s.names[name]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+}
+
+// scanAccounts 读取全部账户文件并重建名称索引（调用方负责加锁）
+func (s *Storage) scanAccounts() ([]*OAuthData, error) {
+	files, err := filepath.Glob(filepath.Join(s.dataDir, "oauth_"+accountIDPrefix+"*.json"))
 	if err != nil {
 		return nil, fmt.Errorf("扫描OAuth数据文件失败: %w", err)
 	}
 
-	var accounts []string
+	names := make(map[string]string, len(files))
+	accounts := make([]*OAuthData, 0, len(files))
 	for _, file := range files {
-		basename := filepath.Base(file)
-		// 提取账户名：oauth_accountname.json -> accountname
-		if len(basename) > 12 && basename[:6] == "oauth_" && basename[len(basename)-5:] == ".json" {
-			accountName := basename[6 : len(basename)-5]
-			accounts = append(accounts, accountName)
+		data, err := readOAuthFile(file)
+		if err == nil && !IsAccountID(data.ID) {
+			err = fmt.Errorf("无效的账户ID: %q", data.ID)
 		}
+		if err != nil {
+			slog.Warn("跳过无法读取的账户文件", "file", filepath.Base(file), "error", err)
+			continue
+		}
+		names[data.Name] = data.ID
+		if use := s.uses[data.ID]; use != nil {
+			use.apply(data)
+		}
+		accounts = append(accounts, data)
 	}
 
+	s.names = names
 	return accounts, nil
-}
\ No newline at end of file
+}
+
+// accountFile 返回账户数据文件路径
+func (s *Storage) accountFile(accountID string) string {
+	return filepath.Join(s.dataDir, fmt.Sprintf("oauth_%s.json", accountID))
+}
+
+// pkceFile 返回PKCE会话文件路径
+func (s *Storage) pkceFile(state string) string {
+	return filepath.Join(s.dataDir, fmt.Sprintf("pkce_%s.json", state))
+}
+
+// loadOAuthData 按账户ID读取账户数据文件，并带上内存中的使用状态（调用方负责加锁）
+func (s *Storage) loadOAuthData(accountID string) (*OAuthData, error) {
+	data, err := readOAuthFile(s.accountFile(accountID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, accountID)
+		}
+		return nil, err
+	}
+	if use := s.uses[accountID]; use != nil {
+		use.apply(data)
+	}
+	return data, nil
+}
+
+// saveOAuthData 按账户ID写入账户数据文件并更新索引，内存中的使用状态随之写入（调用方负责加锁）
+func (s *Storage) saveOAuthData(data *OAuthData) error {
+	use := s.uses[data.ID]
+	if use != nil {
+		use.apply(data)
+	}
+	if err := s.writeJSONFile(s.accountFile(data.ID), data); err != nil {
+		return fmt.Errorf("写入OAuth数据文件失败: %w", err)
+	}
+	if use != nil {
+		use.dirty = false
+		use.persisted = time.Now()
+	}
+	s.names[data.Name] = data.ID
+	return nil
+}
+
+// readOAuthFile 读取并解析账户数据文件
+func readOAuthFile(filename string) (*OAuthData, error) {
+	// 读取文件
+	jsonData, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("读取OAuth数据文件失败: %w", err)
+	}
+
+	// 反序列化数据
+	var data OAuthData
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, fmt.Errorf("反序列化OAuth数据失败: %w", err)
+	}
+
+	return &data, nil
+}
+
+// readPKCEFile 读取并解析PKCE会话文件
+func readPKCEFile(filename string) (*PKCEData, error) {
+	// 读取文件
+	jsonData, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("读取PKCE数据文件失败: %w", err)
+	}
+
+	// 反序列化数据
+	var data PKCEData
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, fmt.Errorf("反序列化PKCE数据失败: %w", err)
+	}
+
+	return &data, nil
+}
+
+// writeJSONFile 序列化数据并原子写入文件（先写临时文件再重命名）
+func (s *Storage) writeJSONFile(filename string, v interface{}) error {
+	// 确保数据目录存在
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+
+	// 序列化数据
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %w", err)
+	}
+
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, jsonData, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, filename); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
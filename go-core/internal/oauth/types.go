@@ -1,9 +1,22 @@
 package oauth
 
 import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
 	"time"
 )
 
+// 账户状态
+const (
+	AccountStatusActive      = "active"       // 正常可用
+	AccountStatusDisabled    = "disabled"     // 已被管理员禁用
+	AccountStatusNeedsReauth = "needs_reauth" // 凭据已失效（token被吊销、组织被禁用），需要重新授权
+	AccountStatusExpired     = "expired"      // token已过期，等待刷新
+	AccountStatusError       = "error"        // 最近一次请求失败
+)
+
 // ProxyConfig 代理配置
 type ProxyConfig struct {
 	Type     string `json:"type"`     // "socks5", "http", "https"
@@ -15,11 +28,69 @@ type ProxyConfig struct {
 
 // OAuthData OAuth数据结构
 type OAuthData struct {
+	// 账户身份：ID生成后不再变化，Name为可修改的slug，DisplayName为展示名称
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+
 	AccessToken  string       `json:"access_token"`
 	RefreshToken string       `json:"refresh_token"`
 	ExpiresAt    time.Time    `json:"expires_at"`
 	Scopes       []string     `json:"scopes"`
 	ProxyConfig  *ProxyConfig `json:"proxy_config,omitempty"`
+
+	// 账户资料（邮箱、组织、订阅类型），登录或导入时通过OAuth profile接口读取
+	Profile *Profile `json:"profile,omitempty"`
+
+	// 账户元数据（由管理接口维护）
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Priority    int       `json:"priority"`
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// 运行状态（由转发服务维护）
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// 凭据失效时由转发服务隔离，隔离期间不参与调度
+	Quarantine *Quarantine `json:"quarantine,omitempty"`
+}
+
+// Quarantine 账户隔离信息：转发服务发现凭据已失效时设置。
+// 重新授权、导入或刷新token成功后自动解除，也可由管理员手动解除
+type Quarantine struct {
+	Reason  string    `json:"reason"`  // 失效类型：token_revoked, refresh_rejected, organization_disabled
+	Message string    `json:"message"` // 上游返回的错误信息
+	At      time.Time `json:"at"`
+}
+
+// AccountInfo 账户概要信息（不包含token等敏感数据）
+type AccountInfo struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Priority    int        `json:"priority"`
+	Enabled     bool       `json:"enabled"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Scopes      []string   `json:"scopes"`
+	Proxy       string     `json:"proxy,omitempty"`
+
+	Email            string `json:"email,omitempty"`
+	OrganizationUUID string `json:"organization_uuid,omitempty"`
+	SubscriptionType string `json:"subscription_type,omitempty"`
+
+	LastUsedAt  *time.Time  `json:"last_used_at,omitempty"`
+	LastError   string      `json:"last_error,omitempty"`
+	LastErrorAt *time.Time  `json:"last_error_at,omitempty"`
+	NeedsReauth bool        `json:"needs_reauth"`
+	Quarantine  *Quarantine `json:"quarantine,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
 }
 
 // PKCEData PKCE流程数据
@@ -28,6 +99,18 @@ type PKCEData struct {
 	CodeChallenge string `json:"code_challenge"`
 	State         string `json:"state"`
 	AuthURL       string `json:"auth_url"`
+
+	RedirectURI   string `json:"redirect_uri,omitempty"`
+
+	// 生成授权URL时选择的代理，token交换及之后的请求沿用同一出口
+	ProxyConfig *ProxyConfig `json:"proxy_config,omitempty"`
+
+	// 生成授权URL时指定的账户，loopback回调据此保存账户
+	AccountName string `json:"account_name,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // TokenResponse token响应结构
@@ -48,4 +131,139 @@ func (o *OAuthData) IsValid() bool {
 func (o *OAuthData) NeedRefresh() bool {
 	// 提前60秒刷新
 	return time.Now().After(o.ExpiresAt.Add(-60*time.Second))
-}
\ No newline at end of file
+}
+
+// IsExpired 检查PKCE会话是否已过期（没有过期时间的旧数据视为已过期）
+func (p *PKCEData) IsExpired() bool {
+	return !time.Now().Before(p.ExpiresAt)
+}
+
+// SetTokens 用新的token数据覆盖当前账户的token字段，保留账户元数据
+func (o *OAuthData) SetTokens(tokens *OAuthData) {
+	o.AccessToken = tokens.AccessToken
+	o.RefreshToken = tokens.RefreshToken
+	o.ExpiresAt = tokens.ExpiresAt
+	o.Scopes = tokens.Scopes
+	o.ProxyConfig = tokens.ProxyConfig
+}
+
+// Status 计算账户当前状态
+func (o *OAuthData) Status() string {
+	switch {
+	case o.Disabled:
+		return AccountStatusDisabled
+	case o.Quarantine != nil:
+		return AccountStatusNeedsReauth
+	case o.LastError != "":
+		return AccountStatusError
+	case !o.IsValid():
+		return AccountStatusExpired
+	default:
+		return AccountStatusActive
+	}
+}
+
+// Info 生成账户概要信息
+func (o *OAuthData) Info() *AccountInfo {
+	info := &AccountInfo{
+		ID:          o.ID,
+		Name:        o.Name,
+		DisplayName: o.DisplayName,
+		Description: o.Description,
+		Tags:        o.Tags,
+		Priority:    o.Priority,
+		Enabled:     !o.Disabled,
+		Status:      o.Status(),
+		ExpiresAt:   o.ExpiresAt,
+		Scopes:      o.Scopes,
+		Proxy:       o.ProxyConfig.String(),
+		LastUsedAt:  o.LastUsedAt,
+		LastError:   o.LastError,
+		LastErrorAt: o.LastErrorAt,
+		NeedsReauth: o.Quarantine != nil,
+		Quarantine:  o.Quarantine,
+		CreatedAt:   o.CreatedAt,
+		UpdatedAt:   o.UpdatedAt,
+	}
+	if o.Profile != nil {
+		info.Email = o.Profile.Email
+		info.OrganizationUUID = o.Profile.OrganizationUUID
+		info.SubscriptionType = o.Profile.SubscriptionType
+	}
+	return info
+}
+
+// Validate 校验代理配置
+func (p *ProxyConfig) Validate() error {
+	switch p.Type {
+	case "socks5", "http", "https":
+	default:
+		return fmt.Errorf("不支持的代理类型: %s", p.Type)
+	}
+	if p.Host == "" {
+		return fmt.Errorf("代理地址不能为空")
+	}
+	if p.Port <= 0 || p.Port > 65535 {
+		return fmt.Errorf("无效的代理端口: %d", p.Port)
+	}
+	return nil
+}
+
+// Equal 判断两个代理配置是否指向同一出口（含认证信息）
+func (p *ProxyConfig) Equal(other *ProxyConfig) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	return *p == *other
+}
+
+// String 返回不含认证信息的代理地址
+func (p *ProxyConfig) String() string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s", p.Type, net.JoinHostPort(p.Host, strconv.Itoa(p.Port)))
+}
+
+// LogValue 日志中只输出不含认证信息的代理地址
+func (p *ProxyConfig) LogValue() slog.Value {
+	return slog.StringValue(p.String())
+}
+
+// LogValue 日志中只输出账户身份、有效期和代理地址，不输出token
+func (o *OAuthData) LogValue() slog.Value {
+	if o == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("id", o.ID),
+		slog.String("name", o.Name),
+		slog.Time("expires_at", o.ExpiresAt),
+		slog.String("proxy", o.ProxyConfig.String()),
+	)
+}
+
+// LogValue 日志中只输出state和有效期，不输出code_verifier
+func (p *PKCEData) LogValue() slog.Value {
+	if p == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("state", p.State),
+		slog.String("account_name", p.AccountName),
+		slog.String("proxy", p.ProxyConfig.String()),
+		slog.Time("expires_at", p.ExpiresAt),
+	)
+}
+
+// LogValue 日志中只输出token类型、有效期和scope，不输出token
+func (t *TokenResponse) LogValue() slog.Value {
+	if t == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("token_type", t.TokenType),
+		slog.Int("expires_in", t.ExpiresIn),
+		slog.String("scope", t.Scope),
+	)
+}
@@ -0,0 +1,349 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/metrics"
+)
+
+// ErrCircuitOpen 账户或出口处于熔断状态
+var ErrCircuitOpen = errors.New("熔断中")
+
+// ErrCircuitNotFound 没有该账户或出口的熔断记录
+var ErrCircuitNotFound = errors.New("熔断记录不存在")
+
+// 熔断类型
+const (
+	CircuitAccount = "account" // 按账户ID统计：401/403、token刷新失败
+	CircuitEgress  = "egress"  // 按出口统计：连接失败、超时
+)
+
+// DirectEgress 不经代理直连上游时的出口名
+const DirectEgress = "direct"
+
+// 熔断状态
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// maxCircuitEvents 每个熔断器保留的状态变化记录数
+const maxCircuitEvents = 100
+
+// maxCircuitReason 错误原因保留的最大长度
+const maxCircuitReason = 300
+
+// CircuitStatus 单个账户或出口的熔断状态
+type CircuitStatus struct {
+	Kind        string     `json:"kind"`
+	Name        string     `json:"name"`
+	State       string     `json:"state"`
+	Requests    int        `json:"requests"` // 统计窗口内的请求数
+	Failures    int        `json:"failures"` // 统计窗口内的失败数
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	ChangedAt   *time.Time `json:"changed_at,omitempty"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"` // 熔断中时最早放行试探请求的时间
+}
+
+// CircuitEvent 一次熔断状态变化
+type CircuitEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+}
+
+// Breaker 按名称（账户ID或出口）维护熔断状态：关闭时统计窗口内的失败率，超过阈值后熔断；
+// 冷却结束后进入半开状态，只放行一个试探请求，成功则关闭，失败则重新熔断
+type Breaker struct {
+	kind string
+	now  func() time.Time
+
+	// onTransition 状态变化回调，在持有锁时调用，不能阻塞
+	onTransition func(CircuitEvent)
+
+	mu       sync.Mutex
+	cfg      config.BreakerConfig
+	circuits map[string]*circuit
+	events   []CircuitEvent
+}
+
+// circuit 单个名称的熔断状态
+type circuit struct {
+	state       string
+	outcomes    []outcome // 统计窗口内的请求结果，按时间排序
+	changedAt   time.Time
+	probeAt     time.Time // 半开状态下试探请求的放行时间
+	lastError   string
+	lastErrorAt time.Time
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+// NewBreaker 创建熔断器，kind为 account 或 egress
+func NewBreaker(kind string, cfg config.BreakerConfig) *Breaker {
+	return &Breaker{
+		kind:     kind,
+		now:      time.Now,
+		cfg:      cfg,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// OnTransition 设置状态变化回调（用于事件通知），需在使用熔断器之前设置。
+// 回调在持有锁时调用，不能阻塞或再调用熔断器的方法
+func (b *Breaker) OnTransition(fn func(CircuitEvent)) {
+	b.onTransition = fn
+}
+
+// SetConfig 热更新熔断配置，关闭熔断时清除全部状态
+func (b *Breaker) SetConfig(cfg config.BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = cfg
+	if !cfg.Enabled {
+		for name := range b.circuits {
+			metrics.ForgetCircuit(b.kind, name)
+		}
+		b.circuits = make(map[string]*circuit)
+	}
+}
+
+// Allow 请求前检查是否放行。熔断冷却结束后转为半开并放行一个试探请求；
+// 试探请求超过冷却时间仍没有结果时（如被取消）再放行一个
+func (b *Breaker) Allow(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[name]
+	if !b.cfg.Enabled || !ok {
+		return true
+	}
+	now := b.now()
+	switch c.state {
+	case CircuitOpen:
+		if now.Before(c.changedAt.Add(b.cfg.Cooldown)) {
+			return false
+		}
+		b.transition(name, c, CircuitHalfOpen, "冷却结束，放行试探请求")
+		c.probeAt = now
+		return true
+	case CircuitHalfOpen:
+		if !c.probeAt.IsZero() && now.Before(c.probeAt.Add(b.cfg.Cooldown)) {
+			return false
+		}
+		c.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+// Available 是否会放行请求（不放行试探请求，供调度时过滤）
+func (b *Breaker) Available(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[name]
+	if !b.cfg.Enabled || !ok {
+		return true
+	}
+	now := b.now()
+	switch c.state {
+	case CircuitOpen:
+		return !now.Before(c.changedAt.Add(b.cfg.Cooldown))
+	case CircuitHalfOpen:
+		return c.probeAt.IsZero() || !now.Before(c.probeAt.Add(b.cfg.Cooldown))
+	default:
+		return true
+	}
+}
+
+// Record 记录请求结果，err为nil表示成功
+func (b *Breaker) Record(name string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.cfg.Enabled {
+		return
+	}
+
+	now := b.now()
+	c, ok := b.circuits[name]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[name] = c
+	}
+	if err != nil {
+		c.lastError = truncateReason(err.Error())
+		c.lastErrorAt = now
+	}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if err != nil {
+			b.transition(name, c, CircuitOpen, "试探请求失败: "+c.lastError)
+		} else {
+			b.transition(name, c, CircuitClosed, "试探请求成功")
+		}
+	case CircuitClosed:
+		c.outcomes = append(c.outcomes, outcome{at: now, failed: err != nil})
+		c.trim(now.Add(-b.cfg.Window))
+		requests, failures := c.counts()
+		if err != nil && requests >= b.cfg.MinRequests && float64(failures) >= b.cfg.FailureRatio*float64(requests) {
+			b.transition(name, c, CircuitOpen, fmt.Sprintf("%d/%d 个请求失败: %s", failures, requests, c.lastError))
+		}
+	}
+	// 熔断中收到的是熔断前放行的请求的结果，不改变状态
+}
+
+// Reset 手动关闭熔断（管理操作）
+func (b *Breaker) Reset(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[name]
+	if !ok {
+		return fmt.Errorf("%w: %s %s", ErrCircuitNotFound, b.kind, name)
+	}
+	if c.state != CircuitClosed {
+		b.transition(name, c, CircuitClosed, "管理员手动恢复")
+	}
+	c.outcomes = nil
+	return nil
+}
+
+// Forget 删除名称的熔断状态（账户被删除时调用）
+func (b *Breaker) Forget(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.circuits, name)
+	metrics.ForgetCircuit(b.kind, name)
+}
+
+// Status 名称当前的熔断状态，没有记录时为关闭
+func (b *Breaker) Status(name string) CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[name]
+	if !ok {
+		return CircuitStatus{Kind: b.kind, Name: name, State: CircuitClosed}
+	}
+	return b.status(name, c)
+}
+
+// Statuses 全部有记录的熔断状态，按名称排序
+func (b *Breaker) Statuses() []CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]CircuitStatus, 0, len(b.circuits))
+	for name, c := range b.circuits {
+		statuses = append(statuses, b.status(name, c))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Events 最近的状态变化，按时间从旧到新
+func (b *Breaker) Events() []CircuitEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]CircuitEvent(nil), b.events...)
+}
+
+// status 构建状态视图（调用方需持有锁）
+func (b *Breaker) status(name string, c *circuit) CircuitStatus {
+	c.trim(b.now().Add(-b.cfg.Window))
+	requests, failures := c.counts()
+	status := CircuitStatus{
+		Kind:      b.kind,
+		Name:      name,
+		State:     c.state,
+		Requests:  requests,
+		Failures:  failures,
+		LastError: c.lastError,
+	}
+	if !c.lastErrorAt.IsZero() {
+		at := c.lastErrorAt
+		status.LastErrorAt = &at
+	}
+	if !c.changedAt.IsZero() {
+		at := c.changedAt
+		status.ChangedAt = &at
+	}
+	if c.state == CircuitOpen {
+		retry := c.changedAt.Add(b.cfg.Cooldown)
+		status.RetryAt = &retry
+	}
+	return status
+}
+
+// transition 切换状态，记录事件、日志和监控（调用方需持有锁）
+func (b *Breaker) transition(name string, c *circuit, to, reason string) {
+	from := c.state
+	now := b.now()
+	c.state = to
+	c.changedAt = now
+	c.probeAt = time.Time{}
+	if to == CircuitClosed {
+		c.outcomes = nil
+	}
+
+	event := CircuitEvent{Time: now, Kind: b.kind, Name: name, From: from, To: to, Reason: reason}
+	b.events = append(b.events, event)
+	if len(b.events) > maxCircuitEvents {
+		b.events = b.events[len(b.events)-maxCircuitEvents:]
+	}
+	metrics.CircuitChanged(b.kind, name, to)
+	if b.onTransition != nil {
+		b.onTransition(event)
+	}
+
+	log := slog.Info
+	if to == CircuitOpen {
+		log = slog.Warn
+	}
+	log("熔断状态变化", "kind", b.kind, "name", name, "from", from, "to", to, "reason", reason)
+}
+
+// trim 丢弃统计窗口之前的结果
+func (c *circuit) trim(since time.Time) {
+	i := 0
+	for i < len(c.outcomes) && c.outcomes[i].at.Before(since) {
+		i++
+	}
+	c.outcomes = c.outcomes[i:]
+}
+
+// counts 统计窗口内的请求数和失败数
+func (c *circuit) counts() (requests, failures int) {
+	for _, o := range c.outcomes {
+		if o.failed {
+			failures++
+		}
+	}
+	return len(c.outcomes), failures
+}
+
+// truncateReason 截断过长的错误信息（上游错误可能包含完整响应体）
+func truncateReason(reason string) string {
+	runes := []rune(reason)
+	if len(runes) <= maxCircuitReason {
+		return reason
+	}
+	return string(runes[:maxCircuitReason]) + "…"
+}
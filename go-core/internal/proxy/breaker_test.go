@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+)
+
+var errUpstream = errors.New("upstream failed")
+
+// newTestBreaker 创建使用可控时钟的熔断器：窗口1分钟，至少4个请求，失败率50%，冷却30秒
+func newTestBreaker() (*Breaker, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(CircuitAccount, config.BreakerConfig{
+		Enabled:      true,
+		Window:       time.Minute,
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		Cooldown:     30 * time.Second,
+	})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerOpensOnFailureRatio(t *testing.T) {
+	b, _ := newTestBreaker()
+
+	b.Record("acc", nil)
+	b.Record("acc", errUpstream)
+	b.Record("acc", nil)
+	if state := b.Status("acc").State; state != CircuitClosed {
+		t.Fatalf("请求数不足时不应熔断: %s", state)
+	}
+
+	b.Record("acc", errUpstream)
+	status := b.Status("acc")
+	if status.State != CircuitOpen || status.Requests != 4 || status.Failures != 2 || status.RetryAt == nil {
+		t.Fatalf("失败率达到阈值后应熔断: %+v", status)
+	}
+	if b.Allow("acc") || b.Available("acc") {
+		t.Fatalf("熔断期间不应放行请求")
+	}
+	if !b.Allow("other") {
+		t.Fatalf("其他名称不受影响")
+	}
+}
+
+func TestBreakerWindowExpires(t *testing.T) {
+	b, now := newTestBreaker()
+
+	b.Record("acc", errUpstream)
+	b.Record("acc", errUpstream)
+	b.Record("acc", errUpstream)
+	*now = now.Add(2 * time.Minute)
+
+	// 窗口外的失败不再计入
+	b.Record("acc", errUpstream)
+	if status := b.Status("acc"); status.State != CircuitClosed || status.Requests != 1 {
+		t.Fatalf("窗口外的结果应被丢弃: %+v", status)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b, now := newTestBreaker()
+	for i := 0; i < 4; i++ {
+		b.Record("acc", errUpstream)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if !b.Available("acc") {
+		t.Fatalf("冷却结束后应可调度")
+	}
+	if !b.Allow("acc") {
+		t.Fatalf("冷却结束后应放行试探请求")
+	}
+	if b.Status("acc").State != CircuitHalfOpen {
+		t.Fatalf("放行试探请求后应为半开状态")
+	}
+	if b.Allow("acc") || b.Available("acc") {
+		t.Fatalf("半开状态只放行一个试探请求")
+	}
+
+	// 试探失败重新熔断
+	b.Record("acc", errUpstream)
+	if b.Status("acc").State != CircuitOpen || b.Allow("acc") {
+		t.Fatalf("试探失败后应重新熔断")
+	}
+
+	// 再次冷却后试探成功，关闭熔断
+	*now = now.Add(30 * time.Second)
+	if !b.Allow("acc") {
+		t.Fatalf("冷却结束后应再次放行试探请求")
+	}
+	b.Record("acc", nil)
+	status := b.Status("acc")
+	if status.State != CircuitClosed || status.Requests != 0 {
+		t.Fatalf("试探成功后应关闭熔断并清空统计: %+v", status)
+	}
+
+	var transitions []string
+	for _, event := range b.Events() {
+		transitions = append(transitions, event.From+">"+event.To)
+	}
+	want := []string{"closed>open", "open>half_open", "half_open>open", "open>half_open", "half_open>closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("状态变化记录不正确: %v", transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("状态变化记录不正确: %v", transitions)
+		}
+	}
+}
+
+func TestBreakerStaleProbe(t *testing.T) {
+	b, now := newTestBreaker()
+	for i := 0; i < 4; i++ {
+		b.Record("acc", errUpstream)
+	}
+	*now = now.Add(30 * time.Second)
+	b.Allow("acc")
+
+	// 试探请求一直没有结果（如被取消），超过冷却时间后放行新的试探请求
+	*now = now.Add(30 * time.Second)
+	if !b.Allow("acc") {
+		t.Fatalf("试探请求没有结果时应再放行一个")
+	}
+}
+
+func TestBreakerResetAndDisable(t *testing.T) {
+	b, _ := newTestBreaker()
+	if err := b.Reset("acc"); !errors.Is(err, ErrCircuitNotFound) {
+		t.Fatalf("没有记录时应返回ErrCircuitNotFound，实际 %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		b.Record("acc", errUpstream)
+	}
+
+	if err := b.Reset("acc"); err != nil {
+		t.Fatalf("手动恢复失败: %v", err)
+	}
+	if !b.Allow("acc") || b.Status("acc").State != CircuitClosed {
+		t.Fatalf("手动恢复后应关闭熔断")
+	}
+
+	for i := 0; i < 4; i++ {
+		b.Record("acc", errUpstream)
+	}
+	cfg := b.cfg
+	cfg.Enabled = false
+	b.SetConfig(cfg)
+	if !b.Allow("acc") || len(b.Statuses()) != 0 {
+		t.Fatalf("关闭熔断后应清除状态并放行全部请求")
+	}
+	for i := 0; i < 4; i++ {
+		b.Record("acc", errUpstream)
+	}
+	if !b.Allow("acc") {
+		t.Fatalf("关闭熔断后不应再统计失败")
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"claude-relay-core/internal/metrics"
+)
+
+// ErrAccountNeedsReauth 账户凭据已失效并被隔离，需要重新授权或由管理员解除
+var ErrAccountNeedsReauth = errors.New("账户凭据已失效，需要重新授权")
+
+// 账户被隔离的原因
+const (
+	QuarantineTokenRevoked    = "token_revoked"         // 上游明确提示OAuth token已被吊销
+	QuarantineRefreshRejected = "refresh_rejected"      // refresh token被拒绝（invalid_grant）
+	QuarantineOrgDisabled     = "organization_disabled" // 账户所属组织被禁用
+)
+
+// UpstreamError 上游返回的错误响应及其分类
+type UpstreamError struct {
+	Status  int    // HTTP状态码
+	Kind    string // 错误分类，取值同 metrics.Error* 常量
+	Type    string // 响应体中的 error.type，无法解析时为空
+	Message string // 响应体中的 error.message，无法解析时为空
+	Body    string // 原始响应体，原样返回给客户端
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("Claude API错误 %d: %s", e.Status, e.Body)
+}
+
+// Quarantine 错误说明账户凭据已失效时返回隔离原因，否则返回空字符串。
+// 普通401可能只是access token过期，由调用方强制刷新后再判断
+func (e *UpstreamError) Quarantine() string {
+	switch {
+	case e.Kind == metrics.ErrorOrgDisabled:
+		return QuarantineOrgDisabled
+	case e.Kind == metrics.ErrorAuth && strings.Contains(strings.ToLower(e.Message), "revoked"):
+		return QuarantineTokenRevoked
+	default:
+		return ""
+	}
+}
+
+// accountFault 错误是否由账户本身引起（凭据无效、权限不足、组织被禁用），计入账户的熔断统计
+func (e *UpstreamError) accountFault() bool {
+	return e.Kind == metrics.ErrorAuth || e.Kind == metrics.ErrorPermission || e.Kind == metrics.ErrorOrgDisabled
+}
+
+// clientStatus 返回给客户端的状态码：限流、过载和请求本身的错误原样透传上游状态码，
+// 账户相关的错误与客户端无关，返回0由调用方决定
+func (e *UpstreamError) clientStatus() int {
+	switch e.Kind {
+	case metrics.ErrorRateLimit, metrics.ErrorOverloaded, metrics.ErrorInvalidRequest:
+		if e.Status >= 400 {
+			return e.Status
+		}
+		return 0
+	default:
+		return 0
+	}
+}
+
+// Passthrough 限流、过载和请求本身的错误需要原样返回给客户端时，返回上游状态码和原始响应体；
+// 其他错误或响应体不是JSON时ok为false，由调用方按 ErrorStatus 返回转发服务自己的错误
+func Passthrough(err error) (status int, body []byte, ok bool) {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) || upstreamErr.clientStatus() == 0 || !json.Valid([]byte(upstreamErr.Body)) {
+		return 0, nil, false
+	}
+	return upstreamErr.clientStatus(), []byte(upstreamErr.Body), true
+}
+
+// classifyUpstreamError 按状态码、响应体中的错误类型和错误信息归类上游错误
+func classifyUpstreamError(status int, body []byte) *UpstreamError {
+	var parsed struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &parsed)
+
+	e := &UpstreamError{
+		Status:  status,
+		Type:    parsed.Error.Type,
+		Message: parsed.Error.Message,
+		Body:    string(body),
+	}
+	message := strings.ToLower(e.Message)
+	if message == "" {
+		message = strings.ToLower(e.Body)
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests || e.Type == "rate_limit_error" || strings.Contains(message, "rate limit"):
+		e.Kind = metrics.ErrorRateLimit
+	case status == 529 || e.Type == "overloaded_error":
+		e.Kind = metrics.ErrorOverloaded
+	case isOrgDisabled(message):
+		e.Kind = metrics.ErrorOrgDisabled
+	case status == http.StatusUnauthorized || e.Type == "authentication_error":
+		e.Kind = metrics.ErrorAuth
+	case status == http.StatusForbidden || e.Type == "permission_error":
+		e.Kind = metrics.ErrorPermission
+	case status == http.StatusBadRequest || status == http.StatusNotFound ||
+		status == http.StatusRequestEntityTooLarge || status == http.StatusUnprocessableEntity ||
+		e.Type == "invalid_request_error" || e.Type == "not_found_error" || e.Type == "request_too_large":
+		e.Kind = metrics.ErrorInvalidRequest
+	case status >= 500:
+		e.Kind = metrics.ErrorServer
+	default:
+		e.Kind = metrics.ErrorClient
+	}
+	return e
+}
+
+// isOrgDisabled 错误信息是否说明账户所属组织被禁用
+func isOrgDisabled(message string) bool {
+	if !strings.Contains(message, "organization") {
+		return false
+	}
+	for _, word := range []string{"disabled", "suspended", "banned", "deactivated"} {
+		if strings.Contains(message, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRefreshRejected 刷新失败是否因为refresh token被拒绝（已被吊销或已轮换作废），重试也不会成功
+func isRefreshRejected(err error) bool {
+	return strings.Contains(err.Error(), "invalid_grant")
+}
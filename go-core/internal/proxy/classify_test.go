@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"claude-relay-core/internal/metrics"
+)
+
+// errorBody Claude API格式的错误响应体
+func errorBody(errorType, message string) []byte {
+	return []byte(fmt.Sprintf(`{"type":"error","error":{"type":%q,"message":%q}}`, errorType, message))
+}
+
+func TestClassifyUpstreamError(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		body       []byte
+		kind       string
+		quarantine string
+	}{
+		{"限流", http.StatusTooManyRequests, errorBody("rate_limit_error", "Number of requests has exceeded your rate limit"), metrics.ErrorRateLimit, ""},
+		{"限流（仅错误信息）", http.StatusBadRequest, []byte("This request would exceed your account's rate limit"), metrics.ErrorRateLimit, ""},
+		{"过载", 529, errorBody("overloaded_error", "Overloaded"), metrics.ErrorOverloaded, ""},
+		{"token过期", http.StatusUnauthorized, errorBody("authentication_error", "OAuth token has expired"), metrics.ErrorAuth, ""},
+		{"token被吊销", http.StatusUnauthorized, errorBody("authentication_error", "OAuth token has been revoked"), metrics.ErrorAuth, QuarantineTokenRevoked},
+		{"组织被禁用", http.StatusForbidden, errorBody("permission_error", "This organization has been disabled."), metrics.ErrorOrgDisabled, QuarantineOrgDisabled},
+		{"组织被封禁", http.StatusBadRequest, errorBody("invalid_request_error", "Your organization has been suspended"), metrics.ErrorOrgDisabled, QuarantineOrgDisabled},
+		{"权限不足", http.StatusForbidden, errorBody("permission_error", "Your API key does not have permission to use the specified resource."), metrics.ErrorPermission, ""},
+		{"请求有误", http.StatusBadRequest, errorBody("invalid_request_error", "max_tokens: Field required"), metrics.ErrorInvalidRequest, ""},
+		{"模型不存在", http.StatusNotFound, errorBody("not_found_error", "model: claude-unknown"), metrics.ErrorInvalidRequest, ""},
+		{"请求过大", http.StatusRequestEntityTooLarge, errorBody("request_too_large", "Request exceeds the maximum allowed number of bytes."), metrics.ErrorInvalidRequest, ""},
+		{"服务端错误", http.StatusInternalServerError, errorBody("api_error", "Internal server error"), metrics.ErrorServer, ""},
+		{"无法解析的响应", http.StatusBadGateway, []byte("<html>bad gateway</html>"), metrics.ErrorServer, ""},
+		{"其他4xx", http.StatusConflict, []byte("conflict"), metrics.ErrorClient, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := classifyUpstreamError(tc.status, tc.body)
+			if e.Kind != tc.kind {
+				t.Errorf("分类应为 %s，实际 %s", tc.kind, e.Kind)
+			}
+			if got := e.Quarantine(); got != tc.quarantine {
+				t.Errorf("隔离原因应为 %q，实际 %q", tc.quarantine, got)
+			}
+			if e.Status != tc.status || e.Body != string(tc.body) {
+				t.Errorf("应保留原始状态码和响应体: %+v", e)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorStatus(t *testing.T) {
+	cases := []struct {
+		status int
+		body   []byte
+		want   int
+	}{
+		{http.StatusTooManyRequests, errorBody("rate_limit_error", "rate limited"), http.StatusTooManyRequests},
+		{529, errorBody("overloaded_error", "Overloaded"), 529},
+		{http.StatusBadRequest, errorBody("invalid_request_error", "messages: Field required"), http.StatusBadRequest},
+		// 账户相关的错误与客户端无关，不透传上游状态码
+		{http.StatusUnauthorized, errorBody("authentication_error", "invalid token"), http.StatusServiceUnavailable},
+		{http.StatusForbidden, errorBody("permission_error", "forbidden"), http.StatusServiceUnavailable},
+		{http.StatusInternalServerError, errorBody("api_error", "Internal server error"), http.StatusBadGateway},
+	}
+	for _, tc := range cases {
+		err := fmt.Errorf("转发失败: %w", classifyUpstreamError(tc.status, tc.body))
+		if got := ErrorStatus(err); got != tc.want {
+			t.Errorf("上游 %d 返回给客户端的状态码应为 %d，实际 %d", tc.status, tc.want, got)
+		}
+	}
+
+	// 透传的错误原样返回上游响应体，账户相关的错误不透传
+	body := errorBody("rate_limit_error", "rate limited")
+	if status, got, ok := Passthrough(fmt.Errorf("转发失败: %w", classifyUpstreamError(http.StatusTooManyRequests, body))); !ok ||
+		status != http.StatusTooManyRequests || string(got) != string(body) {
+		t.Errorf("限流错误应原样透传: %v %d %s", ok, status, got)
+	}
+	if _, _, ok := Passthrough(classifyUpstreamError(http.StatusUnauthorized, errorBody("authentication_error", "invalid token"))); ok {
+		t.Errorf("账户相关的错误不应透传")
+	}
+
+	if got := ErrorStatus(fmt.Errorf("%w: alice", ErrAccountNeedsReauth)); got != http.StatusForbidden {
+		t.Errorf("已隔离的账户应返回403，实际 %d", got)
+	}
+}
+
+func TestRefreshRejected(t *testing.T) {
+	rejected := fmt.Errorf("HTTP错误 400: %s", `{"error":"invalid_grant","error_description":"Refresh token not found or invalid"}`)
+	if !isRefreshRejected(rejected) {
+		t.Errorf("invalid_grant 应视为refresh token被拒绝")
+	}
+	if isRefreshRejected(fmt.Errorf("HTTP错误 503: upstream unavailable")) {
+		t.Errorf("临时错误不应视为refresh token被拒绝")
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"claude-relay-core/internal/metrics"
+	"claude-relay-core/internal/notify"
+)
+
+// EventNotifier 事件通知接口，Notify不能阻塞
+type EventNotifier interface {
+	Notify(event notify.Event)
+}
+
+// notify 发送事件通知，未配置通知时忽略
+func (r *RelayService) notify(event notify.Event) {
+	if r.notifier != nil {
+		r.notifier.Notify(event)
+	}
+}
+
+// notifyRefreshFailed 账户刷新token失败
+func (r *RelayService) notifyRefreshFailed(oauthData *OAuthData, err error) {
+	r.notify(notify.Event{
+		Type:      notify.EventTokenRefreshFailed,
+		Severity:  notify.SeverityWarning,
+		AccountID: oauthData.ID,
+		Account:   oauthData.Name,
+		Message:   truncateReason(err.Error()),
+	})
+}
+
+// notifyQuarantined 账户凭据失效被隔离
+func (r *RelayService) notifyQuarantined(oauthData *OAuthData, reason, message string) {
+	r.notify(notify.Event{
+		Type:      notify.EventAccountQuarantined,
+		Severity:  notify.SeverityCritical,
+		AccountID: oauthData.ID,
+		Account:   oauthData.Name,
+		Message:   message,
+		Details:   map[string]string{"reason": reason},
+	})
+}
+
+// trackRateLimit 跟踪账户的限流状态，在开始限流（或额度用尽）和恢复正常时各通知一次
+func (r *RelayService) trackRateLimit(oauthData *OAuthData, resp *http.Response, upstreamErr *UpstreamError) {
+	if upstreamErr == nil {
+		if _, limited := r.rateLimited.LoadAndDelete(oauthData.ID); limited {
+			r.notify(notify.Event{
+				Type:      notify.EventRateLimitCleared,
+				Severity:  notify.SeverityInfo,
+				AccountID: oauthData.ID,
+				Account:   oauthData.Name,
+				Message:   "账户请求恢复正常",
+			})
+		}
+		return
+	}
+	if upstreamErr.Kind != metrics.ErrorRateLimit {
+		return
+	}
+
+	event := notify.Event{
+		Type:      notify.EventRateLimitEntered,
+		Severity:  notify.SeverityWarning,
+		AccountID: oauthData.ID,
+		Account:   oauthData.Name,
+		Message:   upstreamErr.Message,
+	}
+	if quotaExhausted(resp, upstreamErr) {
+		event.Type = notify.EventQuotaExhausted
+		event.Severity = notify.SeverityCritical
+	}
+	// 限流期间只在首次限流、或从普通限流变为额度用尽时通知
+	if previous, limited := r.rateLimited.Load(oauthData.ID); limited && (previous == event.Type || previous == notify.EventQuotaExhausted) {
+		return
+	}
+	r.rateLimited.Store(oauthData.ID, event.Type)
+
+	if reset := retryAfter(resp); !reset.IsZero() {
+		event.Details = map[string]string{"retry_at": reset.Format(time.RFC3339)}
+	}
+	if event.Message == "" {
+		event.Message = truncateReason(upstreamErr.Body)
+	}
+	r.notify(event)
+}
+
+// quotaExhausted 限流是否因为订阅的用量额度用尽（需要等到额度重置），而不是短时间内请求过多
+func quotaExhausted(resp *http.Response, upstreamErr *UpstreamError) bool {
+	if resp.Header.Get("anthropic-ratelimit-unified-status") == "rejected" {
+		return true
+	}
+	message := strings.ToLower(upstreamErr.Message + " " + upstreamErr.Body)
+	return strings.Contains(message, "usage limit") || strings.Contains(message, "quota")
+}
+
+// onEgressTransition 代理出口熔断时通知代理不可用，恢复时通知代理已恢复；直连出口不通知
+func (r *RelayService) onEgressTransition(event CircuitEvent) {
+	if event.Name == DirectEgress {
+		return
+	}
+	switch {
+	case event.From == CircuitClosed && event.To == CircuitOpen:
+		r.notify(notify.Event{
+			Type:     notify.EventProxyDown,
+			Severity: notify.SeverityCritical,
+			Proxy:    event.Name,
+			Message:  event.Reason,
+			Time:     event.Time,
+		})
+	case event.From != CircuitClosed && event.To == CircuitClosed:
+		r.notify(notify.Event{
+			Type:     notify.EventProxyRecovered,
+			Severity: notify.SeverityInfo,
+			Proxy:    event.Name,
+			Message:  event.Reason,
+			Time:     event.Time,
+		})
+	}
+}
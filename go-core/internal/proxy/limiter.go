@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/metrics"
+)
+
+// ErrAccountBusy 账户并发请求已达上限，且等待队列已满（或未开启排队）
+var ErrAccountBusy = errors.New("账户并发请求已达上限")
+
+// ErrQueueTimeout 排队等待账户并发名额超时
+var ErrQueueTimeout = errors.New("等待账户并发名额超时")
+
+// ConcurrencyStatus 账户的并发状态
+type ConcurrencyStatus struct {
+	Limit  int `json:"limit"` // 并发上限，0表示不限制
+	Active int `json:"active"`
+	Queued int `json:"queued"`
+}
+
+// Limiter 按账户限制并发请求数。超出上限的请求在该账户的FIFO队列中等待，
+// 请求结束时名额按排队顺序交给下一个请求
+type Limiter struct {
+	mu    sync.Mutex
+	slots map[string]*slot
+}
+
+// slot 单个账户的并发名额和等待队列
+type slot struct {
+	limit   int // 最近一次请求使用的上限，热更新后由下一次获取或释放生效
+	active  int
+	waiters *list.List // 元素为 chan struct{}，获得名额时关闭
+}
+
+// NewLimiter 创建并发限制器
+func NewLimiter() *Limiter {
+	return &Limiter{slots: make(map[string]*slot)}
+}
+
+// Acquire 获取账户的并发名额，返回释放名额的函数和排队等待的时间。
+// limit为0时不限制；已达上限时最多maxQueue个请求排队，超过timeout或ctx结束时放弃
+func (l *Limiter) Acquire(ctx context.Context, accountID string, limit, maxQueue int, timeout time.Duration) (func(), time.Duration, error) {
+	l.mu.Lock()
+	s, ok := l.slots[accountID]
+	if !ok {
+		s = &slot{waiters: list.New()}
+		l.slots[accountID] = s
+	}
+	s.limit = limit
+	if s.grant() {
+		metrics.SetQueueDepth(accountID, s.waiters.Len())
+	}
+
+	if s.available() {
+		s.active++
+		l.mu.Unlock()
+		metrics.ObserveQueueWait(accountID, 0)
+		return l.releaser(accountID, s), 0, nil
+	}
+	if s.waiters.Len() >= maxQueue {
+		active := s.active
+		l.mu.Unlock()
+		metrics.QueueRejected(accountID, metrics.QueueFull)
+		return nil, 0, fmt.Errorf("%w: %d/%d 个请求进行中，等待队列已满", ErrAccountBusy, active, limit)
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	metrics.SetQueueDepth(accountID, s.waiters.Len())
+	l.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	reason := metrics.QueueTimeout
+	select {
+	case <-ready:
+	case <-timer.C:
+		err = fmt.Errorf("%w（%s）", ErrQueueTimeout, timeout)
+	case <-ctx.Done():
+		err, reason = ctx.Err(), metrics.QueueCanceled
+	}
+	waited := time.Since(start)
+
+	if err != nil {
+		l.mu.Lock()
+		select {
+		case <-ready:
+			// 放弃的同时已经获得名额，照常转发
+			err = nil
+		default:
+			s.waiters.Remove(elem)
+			metrics.SetQueueDepth(accountID, s.waiters.Len())
+		}
+		l.mu.Unlock()
+	}
+	if err != nil {
+		metrics.QueueRejected(accountID, reason)
+		return nil, waited, err
+	}
+	metrics.ObserveQueueWait(accountID, waited)
+	return l.releaser(accountID, s), waited, nil
+}
+
+// releaser 返回只生效一次的释放函数
+func (l *Limiter) releaser(accountID string, s *slot) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			s.active--
+			if s.grant() {
+				metrics.SetQueueDepth(accountID, s.waiters.Len())
+			}
+			if s.active == 0 && s.waiters.Len() == 0 && l.slots[accountID] == s {
+				delete(l.slots, accountID)
+			}
+		})
+	}
+}
+
+// Available 账户是否还有空闲名额（不需要排队）
+func (l *Limiter) Available(accountID string, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.slots[accountID]
+	if !ok {
+		return true
+	}
+	return limit <= 0 || (s.active < limit && s.waiters.Len() == 0)
+}
+
+// Status 账户当前的并发状态
+func (l *Limiter) Status(accountID string, limit int) ConcurrencyStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	status := ConcurrencyStatus{Limit: limit}
+	if s, ok := l.slots[accountID]; ok {
+		status.Active = s.active
+		status.Queued = s.waiters.Len()
+	}
+	return status
+}
+
+// Forget 删除空闲账户的并发状态。仍有进行中或排队中的请求时保留，
+// 以免之后的请求绕过上限，最后一个请求释放名额时自动删除
+func (l *Limiter) Forget(accountID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.slots[accountID]; ok && s.active == 0 && s.waiters.Len() == 0 {
+		delete(l.slots, accountID)
+	}
+}
+
+// available 不排队即可获得名额（调用方需持有锁）
+func (s *slot) available() bool {
+	return s.limit <= 0 || (s.active < s.limit && s.waiters.Len() == 0)
+}
+
+// grant 按排队顺序把空闲名额交给等待的请求，返回是否有请求出队（调用方需持有锁）
+func (s *slot) grant() bool {
+	granted := false
+	for s.waiters.Len() > 0 && (s.limit <= 0 || s.active < s.limit) {
+		ready := s.waiters.Remove(s.waiters.Front()).(chan struct{})
+		s.active++
+		close(ready)
+		granted = true
+	}
+	return granted
+}
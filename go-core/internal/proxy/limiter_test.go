@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustAcquire(t *testing.T, l *Limiter, limit, maxQueue int) func() {
+	t.Helper()
+	release, _, err := l.Acquire(context.Background(), "acc", limit, maxQueue, time.Second)
+	if err != nil {
+		t.Fatalf("获取名额失败: %v", err)
+	}
+	return release
+}
+
+// waitQueued 等待队列长度达到n
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Status("acc", 0).Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("队列长度应为 %d，实际 %d", n, l.Status("acc", 0).Queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter()
+	for i := 0; i < 10; i++ {
+		mustAcquire(t, l, 0, 0)
+	}
+	if status := l.Status("acc", 0); status.Active != 10 || status.Queued != 0 {
+		t.Fatalf("不限制时不应排队: %+v", status)
+	}
+}
+
+func TestLimiterQueueFull(t *testing.T) {
+	l := NewLimiter()
+	release := mustAcquire(t, l, 1, 0)
+
+	if l.Available("acc", 1) {
+		t.Fatalf("达到上限后不应有空闲名额")
+	}
+	if _, _, err := l.Acquire(context.Background(), "acc", 1, 0, time.Second); !errors.Is(err, ErrAccountBusy) {
+		t.Fatalf("不排队时应返回ErrAccountBusy，实际 %v", err)
+	}
+
+	release()
+	release() // 重复释放不生效
+	if status := l.Status("acc", 1); status.Active != 0 {
+		t.Fatalf("释放后进行中的请求数应为0: %+v", status)
+	}
+	mustAcquire(t, l, 1, 0)
+}
+
+func TestLimiterFIFO(t *testing.T) {
+	l := NewLimiter()
+	release := mustAcquire(t, l, 1, 3)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			next, waited, err := l.Acquire(context.Background(), "acc", 1, 3, 2*time.Second)
+			if err != nil || waited <= 0 {
+				t.Errorf("排队请求 %d 获取名额失败: %v (%s)", i, err, waited)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			next()
+		}(i)
+		// 按顺序进入队列
+		waitQueued(t, l, i+1)
+	}
+
+	if _, _, err := l.Acquire(context.Background(), "acc", 1, 3, time.Second); !errors.Is(err, ErrAccountBusy) {
+		t.Fatalf("队列已满时应返回ErrAccountBusy，实际 %v", err)
+	}
+
+	release()
+	wg.Wait()
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Fatalf("应按排队顺序获得名额: %v", order)
+	}
+	if status := l.Status("acc", 1); status.Active != 0 || status.Queued != 0 {
+		t.Fatalf("全部结束后状态应为空: %+v", status)
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := NewLimiter()
+	mustAcquire(t, l, 1, 1)
+
+	_, waited, err := l.Acquire(context.Background(), "acc", 1, 1, 20*time.Millisecond)
+	if !errors.Is(err, ErrQueueTimeout) || waited < 20*time.Millisecond {
+		t.Fatalf("排队超时应返回ErrQueueTimeout，实际 %v (%s)", err, waited)
+	}
+	if status := l.Status("acc", 1); status.Queued != 0 {
+		t.Fatalf("超时的请求应离开队列: %+v", status)
+	}
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	l := NewLimiter()
+	mustAcquire(t, l, 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for l.Status("acc", 1).Queued == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, _, err := l.Acquire(ctx, "acc", 1, 1, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("客户端断开时应放弃排队，实际 %v", err)
+	}
+	if status := l.Status("acc", 1); status.Queued != 0 {
+		t.Fatalf("放弃的请求应离开队列: %+v", status)
+	}
+}
+
+func TestLimiterRaisedLimit(t *testing.T) {
+	l := NewLimiter()
+	mustAcquire(t, l, 1, 1)
+
+	granted := make(chan error, 1)
+	go func() {
+		_, _, err := l.Acquire(context.Background(), "acc", 1, 1, 2*time.Second)
+		granted <- err
+	}()
+	waitQueued(t, l, 1)
+
+	// 热更新调高上限后，下一次获取名额时排队的请求先出队
+	mustAcquire(t, l, 3, 1)
+	if err := <-granted; err != nil {
+		t.Fatalf("调高上限后排队的请求应获得名额: %v", err)
+	}
+	if status := l.Status("acc", 3); status.Active != 3 || status.Queued != 0 {
+		t.Fatalf("调高上限后的状态不正确: %+v", status)
+	}
+}
+
+func TestLimiterForgetWhileActive(t *testing.T) {
+	l := NewLimiter()
+	release := mustAcquire(t, l, 1, 0)
+
+	// 账户被删除或重新导入时，进行中的请求仍要计入上限
+	l.Forget("acc")
+	if _, _, err := l.Acquire(context.Background(), "acc", 1, 0, time.Second); !errors.Is(err, ErrAccountBusy) {
+		t.Fatalf("Forget后进行中的请求仍应占用名额，实际 %v", err)
+	}
+
+	release()
+	if _, ok := l.slots["acc"]; ok {
+		t.Errorf("最后一个请求结束后应删除并发状态")
+	}
+	mustAcquire(t, l, 1, 0)
+	l.Forget("acc")
+	if status := l.Status("acc", 1); status.Active != 1 {
+		t.Errorf("Forget不应丢弃进行中的请求: %+v", status)
+	}
+}
@@ -2,10 +2,14 @@ package proxy
 
 import (
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
+	"claude-relay-core/internal/metrics"
 	"golang.org/x/net/proxy"
 )
 
@@ -18,6 +22,19 @@ type ProxyConfig struct {
 	Password string `json:"password"`
 }
 
+// label 监控用的代理标识，不含认证信息，未配置代理时为空
+func (p *ProxyConfig) label() string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s", p.Type, net.JoinHostPort(p.Host, strconv.Itoa(p.Port)))
+}
+
+// LogValue 日志中只输出不含认证信息的代理地址
+func (p *ProxyConfig) LogValue() slog.Value {
+	return slog.StringValue(p.label())
+}
+
 // CreateProxyTransport 创建代理传输
 func CreateProxyTransport(proxyConfig *ProxyConfig) (http.RoundTripper, error) {
 	if proxyConfig == nil {
@@ -57,6 +74,10 @@ func createSOCKS5Transport(proxyConfig *ProxyConfig) (http.RoundTripper, error)
 	transport := &http.Transport{
 		Dial: dialer.Dial,
 	}
+	// 优先使用支持context的拨号：请求取消时中断连接，到代理的连接也能被链路追踪记录
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		transport.DialContext = contextDialer.DialContext
+	}
 
 	return transport, nil
 }
@@ -114,7 +135,7 @@ func TestProxyConnection(proxyConfig *ProxyConfig) error {
 	}
 
 	// 简单的连接测试
-	addr := fmt.Sprintf("%s:%d", proxyConfig.Host, proxyConfig.Port)
+	addr := net.JoinHostPort(proxyConfig.Host, strconv.Itoa(proxyConfig.Port))
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("代理连接测试失败: %w", err)
@@ -122,4 +143,47 @@ func TestProxyConnection(proxyConfig *ProxyConfig) error {
 	defer conn.Close()
 
 	return nil
-}
\ No newline at end of file
+}
+// ProbeResult 代理探测结果
+type ProbeResult struct {
+	DialLatency    time.Duration `json:"dial_latency"`
+	RequestLatency time.Duration `json:"request_latency"`
+	StatusCode     int           `json:"status_code"`
+}
+
+// ProbeProxy 探测代理可用性：先建立到代理的TCP连接，再经代理请求targetURL，
+// 收到任意HTTP响应即视为可达
+func ProbeProxy(proxyConfig *ProxyConfig, targetURL string, timeout time.Duration) (result *ProbeResult, err error) {
+	if proxyConfig != nil {
+		defer func() { metrics.ProxyResult(proxyConfig.label(), err) }()
+	}
+	result = &ProbeResult{}
+
+	if proxyConfig != nil {
+		start := time.Now()
+		addr := net.JoinHostPort(proxyConfig.Host, strconv.Itoa(proxyConfig.Port))
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return result, fmt.Errorf("连接代理失败: %w", err)
+		}
+		conn.Close()
+		result.DialLatency = time.Since(start)
+	}
+
+	client, err := CreateProxyClient(proxyConfig)
+	if err != nil {
+		return result, err
+	}
+	client.Timeout = timeout
+
+	start := time.Now()
+	resp, err := client.Get(targetURL)
+	if err != nil {
+		return result, fmt.Errorf("经代理请求 %s 失败: %w", targetURL, err)
+	}
+	resp.Body.Close()
+
+	result.RequestLatency = time.Since(start)
+	result.StatusCode = resp.StatusCode
+	return result, nil
+}
@@ -2,50 +2,151 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"strings"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"claude-relay-core/internal/audit"
 	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/logging"
+	"claude-relay-core/internal/metrics"
+	"claude-relay-core/internal/replay"
+	"claude-relay-core/internal/tracing"
+	"claude-relay-core/internal/usage"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // OAuthData OAuth数据结构（简化版，避免循环导入）
 type OAuthData struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
 	AccessToken  string       `json:"access_token"`
 	RefreshToken string       `json:"refresh_token"`
 	ExpiresAt    time.Time    `json:"expires_at"`
 	Scopes       []string     `json:"scopes"`
 	ProxyConfig  *ProxyConfig `json:"proxy_config,omitempty"`
+	Disabled     bool         `json:"disabled"`
+	NeedsReauth  bool         `json:"needs_reauth"` // 凭据已失效被隔离
+}
+
+// LogValue 日志中只输出账户身份、有效期和代理地址，不输出token
+func (o *OAuthData) LogValue() slog.Value {
+	if o == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("id", o.ID),
+		slog.String("name", o.Name),
+		slog.Time("expires_at", o.ExpiresAt),
+		slog.String("proxy", o.ProxyConfig.label()),
+	)
+}
+
+// ErrAccountDisabled 账户已被禁用
+var ErrAccountDisabled = errors.New("账户已被禁用")
+
+// ErrUnknownPool 请求的账户池未在配置中定义
+var ErrUnknownPool = errors.New("账户池不存在")
+
+// ErrAccountNotInPool 指定的账户不属于请求的账户池
+var ErrAccountNotInPool = errors.New("账户不属于指定的账户池")
+
+// RequestOptions 单次转发请求的选项
+type RequestOptions struct {
+	Account  string // 指定账户名或ID，为空时由调度器选择
+	Pool     string // 限定调度的账户池，为空时不限
+	APIKeyID string // 用于用量统计，可以为空
+	ClientIP string // 用于审计日志，可以为空
 }
 
 // Storage 存储接口
 type Storage interface {
 	LoadOAuthData(accountName string) (*OAuthData, error)
 	SaveOAuthData(accountName string, data *OAuthData) error
+	RecordAccountUse(accountName string, useErr error) error
+	// QuarantineAccount 隔离凭据已失效的账户，返回是否为新隔离（已隔离的账户保持原状）
+	QuarantineAccount(accountName, reason, message string) (bool, error)
+	ListAccounts() ([]*AccountSummary, error)
+}
+
+// UsageRecorder 用量记录接口
+type UsageRecorder interface {
+	Record(accountID, apiKeyID, model string, tokens usage.Tokens)
+}
+
+// AuditRecorder 审计日志接口
+type AuditRecorder interface {
+	Record(entry *audit.Entry)
 }
 
 // OAuthClient OAuth客户端接口
 type OAuthClient interface {
-	RefreshAccessToken(refreshToken string, proxyConfig *ProxyConfig) (*OAuthData, error)
+	RefreshAccessToken(ctx context.Context, refreshToken string, proxyConfig *ProxyConfig) (*OAuthData, error)
 }
 
 // RelayService 请求转发服务
 type RelayService struct {
-	config      *config.Config
+	config      atomic.Pointer[config.Config]
 	oauthClient OAuthClient
 	storage     Storage
+	usage       UsageRecorder
+	audit       AuditRecorder
+	notifier    EventNotifier
+	scheduler   *Scheduler
+	limiter     *Limiter
+
+	// 账户和出口的熔断状态
+	accountCircuits *Breaker
+	egressCircuits  *Breaker
+
+	// refreshLocks 每个账户ID一把锁，避免并发请求重复刷新token
+	refreshLocks sync.Map
+	// rateLimited 正在被限流的账户ID，值为已通知的事件类型
+	rateLimited sync.Map
 }
 
-// NewRelayService 创建转发服务
-func NewRelayService(cfg *config.Config, oauthClient OAuthClient, storage Storage) *RelayService {
-	return &RelayService{
-		config:      cfg,
+// NewRelayService 创建转发服务，usageRecorder、auditRecorder和notifier可以为nil
+func NewRelayService(cfg *config.Config, oauthClient OAuthClient, storage Storage, usageRecorder UsageRecorder, auditRecorder AuditRecorder, notifier EventNotifier) *RelayService {
+	r := &RelayService{
 		oauthClient: oauthClient,
 		storage:     storage,
+		usage:       usageRecorder,
+		audit:       auditRecorder,
+		notifier:    notifier,
+		scheduler:   NewScheduler(cfg.Scheduler.OpusPreferHigherTier),
+		limiter:     NewLimiter(),
+
+		accountCircuits: NewBreaker(CircuitAccount, cfg.Breaker),
+		egressCircuits:  NewBreaker(CircuitEgress, cfg.Breaker),
 	}
+	r.egressCircuits.OnTransition(r.onEgressTransition)
+	r.config.Store(cfg)
+	return r
+}
+
+// Config 返回当前生效的配置
+func (r *RelayService) Config() *config.Config {
+	return r.config.Load()
+}
+
+// UpdateConfig 热更新配置：之后的请求使用新配置，进行中的请求不受影响
+func (r *RelayService) UpdateConfig(cfg *config.Config) {
+	r.config.Store(cfg)
+	r.scheduler.SetPreferHigherTierForOpus(cfg.Scheduler.OpusPreferHigherTier)
+	r.accountCircuits.SetConfig(cfg.Breaker)
+	r.egressCircuits.SetConfig(cfg.Breaker)
 }
 
 // IsValid 检查token是否有效
@@ -56,69 +157,328 @@ func (o *OAuthData) IsValid() bool {
 // NeedRefresh 检查是否需要刷新token
 func (o *OAuthData) NeedRefresh() bool {
 	// 提前60秒刷新
-	return time.Now().After(o.ExpiresAt.Add(-60*time.Second))
+	return time.Now().After(o.ExpiresAt.Add(-60 * time.Second))
 }
 
 // RelayRequest 转发请求到Claude API
-func (r *RelayService) RelayRequest(accountName string, requestBody []byte) (*http.Response, error) {
+func (r *RelayService) RelayRequest(ctx context.Context, accountName string, requestBody []byte) (*http.Response, error) {
+	resp, _, err := r.relay(ctx, accountName, requestBody)
+	return resp, err
+}
+
+// relay 转发请求，同时返回实际使用的账户数据（加载账户之后的失败也会返回）。
+// 响应体关闭前计入进行中的转发数，上游请求的span也在响应体关闭时结束
+func (r *RelayService) relay(ctx context.Context, accountName string, requestBody []byte) (*http.Response, *OAuthData, error) {
 	// 1. 获取有效的OAuth token
-	oauthData, err := r.getValidToken(accountName)
+	oauthData, err := r.getValidToken(ctx, accountName)
 	if err != nil {
-		return nil, fmt.Errorf("获取有效token失败: %w", err)
+		if !errors.Is(err, ErrAccountDisabled) && !errors.Is(err, ErrAccountNeedsReauth) && !errors.Is(err, ErrCircuitOpen) {
+			r.recordAccountUse(accountName, err)
+			metrics.UpstreamError(r.accountLabel(accountName), metrics.ErrorToken)
+		}
+		return nil, nil, fmt.Errorf("获取有效token失败: %w", err)
+	}
+
+	// 账户达到并发上限时排队等待名额，名额在响应体关闭时释放
+	concurrency := r.Config().Concurrency
+	release, waited, err := r.limiter.Acquire(ctx, oauthData.ID, concurrency.Limit(oauthData.ID, oauthData.Name),
+		concurrency.MaxQueue, concurrency.QueueTimeout)
+	if err != nil {
+		slog.WarnContext(ctx, "账户并发已满，请求被拒绝", "account_id", oauthData.ID, "waited_ms", waited.Milliseconds(), "error", err)
+		return nil, oauthData, err
+	}
+	if waited > 0 {
+		slog.DebugContext(ctx, "排队获得账户并发名额", "account_id", oauthData.ID, "waited_ms", waited.Milliseconds())
+	}
+
+	done := metrics.RelayStarted(oauthData.ID)
+	ctx, span := tracing.Start(ctx, "claude.messages",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("account.id", oauthData.ID)),
+	)
+	finish := func(err error) {
+		tracing.End(span, err)
+		done()
+		release()
 	}
 
 	// 2. 创建HTTP客户端（支持代理）
-	httpClient, err := r.createHTTPClient(oauthData.ProxyConfig)
+	httpClient, proxyLabel, err := r.createHTTPClient(oauthData.ProxyConfig)
 	if err != nil {
-		return nil, fmt.Errorf("创建HTTP客户端失败: %w", err)
+		err = fmt.Errorf("创建HTTP客户端失败: %w", err)
+		finish(err)
+		return nil, oauthData, err
+	}
+	if proxyLabel != "" {
+		span.SetAttributes(attribute.String("proxy", proxyLabel))
+	}
+	egress := egressName(proxyLabel)
+	if !r.egressCircuits.Allow(egress) {
+		err = fmt.Errorf("%w: 出口 %s", ErrCircuitOpen, egress)
+		finish(err)
+		return nil, oauthData, err
 	}
 
-	// 3. 构建Claude API请求
-	req, err := r.buildClaudeRequest(requestBody, oauthData.AccessToken)
+	// 3. 构建Claude API请求，连接阶段（代理连接、TLS握手）和首字节时间记录到span
+	req, err := r.buildClaudeRequest(tracing.WithClientTrace(ctx), requestBody, oauthData.AccessToken)
 	if err != nil {
-		return nil, fmt.Errorf("构建Claude API请求失败: %w", err)
+		err = fmt.Errorf("构建Claude API请求失败: %w", err)
+		finish(err)
+		return nil, oauthData, err
 	}
 
 	// 4. 发送请求
 	resp, err := httpClient.Do(req)
+	if proxyLabel != "" {
+		metrics.ProxyResult(proxyLabel, err)
+	}
+	if ctx.Err() == nil {
+		// 客户端取消的请求不计入出口的熔断统计
+		r.egressCircuits.Record(egress, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("发送Claude API请求失败: %w", err)
+		finish(err)
+		r.recordAccountUse(accountName, err)
+		metrics.UpstreamError(oauthData.ID, metrics.ErrorNetwork)
+		return nil, oauthData, fmt.Errorf("发送Claude API请求失败: %w", err)
 	}
-
-	// 5. 检查响应状态
-	if err := r.handleResponse(resp, accountName); err != nil {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	// 5. 检查响应状态，凭据或权限错误计入账户的熔断统计，其他响应说明账户本身可用
+	upstreamErr := r.handleResponse(resp, accountName, oauthData.ID)
+	r.trackRateLimit(oauthData, resp, upstreamErr)
+	if upstreamErr != nil && upstreamErr.accountFault() {
+		r.accountCircuits.Record(oauthData.ID, upstreamErr)
+	} else {
+		r.accountCircuits.Record(oauthData.ID, nil)
+	}
+	if upstreamErr != nil {
 		resp.Body.Close()
-		return nil, err
+		finish(upstreamErr)
+		r.recordAccountUse(accountName, upstreamErr)
+		r.checkCredentials(ctx, oauthData, upstreamErr)
+		return nil, oauthData, upstreamErr
 	}
 
-	return resp, nil
+	r.recordAccountUse(accountName, nil)
+	gotResponse := time.Now()
+	resp.Body = &trackedBody{ReadCloser: resp.Body, done: func() {
+		span.SetAttributes(tracing.AttrStreamDuration.Int64(time.Since(gotResponse).Milliseconds()))
+		finish(nil)
+	}}
+	return resp, oauthData, nil
+}
+
+// trackedBody 响应体关闭时结束进行中的转发计数和上游请求的span
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// ForgetAccount 清理账户在本地缓存的运行时状态（账户被删除时调用）
+func (r *RelayService) ForgetAccount(accountID string) {
+	r.refreshLocks.Delete(accountID)
+	r.scheduler.Forget(accountID)
+	r.limiter.Forget(accountID)
+	r.accountCircuits.Forget(accountID)
+	r.rateLimited.Delete(accountID)
+	metrics.ForgetAccount(accountID)
+}
+
+// SelectAccount 为指定模型调度一个可用账户，poolName不为空时只在该账户池内选择，返回账户名
+func (r *RelayService) SelectAccount(model, poolName string) (string, error) {
+	pool, err := r.pool(poolName)
+	if err != nil {
+		return "", err
+	}
+
+	accounts, err := r.storage.ListAccounts()
+	if err != nil {
+		return "", fmt.Errorf("获取账户列表失败: %w", err)
+	}
+	accounts, tripped := r.withClosedCircuits(accounts)
+	if r.Config().Concurrency.Spillover {
+		accounts = r.withFreeSlots(accounts)
+	}
+
+	account, err := r.scheduler.Select(accounts, model, pool)
+	if errors.Is(err, ErrNoAvailableAccount) && tripped > 0 {
+		return "", fmt.Errorf("%w: %d 个账户处于熔断状态", ErrCircuitOpen, tripped)
+	}
+	if err != nil {
+		return "", err
+	}
+	return account.Name, nil
+}
+
+// withClosedCircuits 去掉账户或出口处于熔断状态的账户，同时返回去掉的数量
+func (r *RelayService) withClosedCircuits(accounts []*AccountSummary) ([]*AccountSummary, int) {
+	global := globalProxy(r.Config()).label()
+	available := make([]*AccountSummary, 0, len(accounts))
+	for _, account := range accounts {
+		egress := account.Proxy
+		if global != "" {
+			egress = global
+		}
+		if !account.schedulable() || (r.accountCircuits.Available(account.ID) && r.egressCircuits.Available(egressName(egress))) {
+			available = append(available, account)
+		}
+	}
+	return available, len(accounts) - len(available)
+}
+
+// Circuits 全部账户和出口的熔断状态及最近的状态变化
+func (r *RelayService) Circuits() ([]CircuitStatus, []CircuitEvent) {
+	statuses := append(r.accountCircuits.Statuses(), r.egressCircuits.Statuses()...)
+	events := append(r.accountCircuits.Events(), r.egressCircuits.Events()...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return statuses, events
+}
+
+// AccountCircuit 账户的熔断状态
+func (r *RelayService) AccountCircuit(accountID string) CircuitStatus {
+	return r.accountCircuits.Status(accountID)
+}
+
+// ResetCircuit 手动关闭熔断，kind为 account（name为账户ID）或 egress
+func (r *RelayService) ResetCircuit(kind, name string) error {
+	switch kind {
+	case CircuitAccount:
+		return r.accountCircuits.Reset(name)
+	case CircuitEgress:
+		return r.egressCircuits.Reset(name)
+	default:
+		return fmt.Errorf("%w: 未知的熔断类型 %s", ErrCircuitNotFound, kind)
+	}
+}
+
+// egressName 出口在熔断统计中的名称，直连时为 direct
+func egressName(proxyLabel string) string {
+	if proxyLabel == "" {
+		return DirectEgress
+	}
+	return proxyLabel
+}
+
+// withFreeSlots 只保留未达到并发上限的账户，全部已满时原样返回（由选中的账户排队）
+func (r *RelayService) withFreeSlots(accounts []*AccountSummary) []*AccountSummary {
+	concurrency := r.Config().Concurrency
+	free := make([]*AccountSummary, 0, len(accounts))
+	for _, account := range accounts {
+		if !account.schedulable() || r.limiter.Available(account.ID, concurrency.Limit(account.ID, account.Name)) {
+			free = append(free, account)
+		}
+	}
+	for _, account := range free {
+		if account.schedulable() {
+			return free
+		}
+	}
+	return accounts
+}
+
+// ConcurrencyStatus 账户当前的并发请求数、排队数和并发上限
+func (r *RelayService) ConcurrencyStatus(accountID, accountName string) ConcurrencyStatus {
+	return r.limiter.Status(accountID, r.Config().Concurrency.Limit(accountID, accountName))
+}
+
+// checkAccountInPool 检查显式指定的账户是否属于账户池
+func (r *RelayService) checkAccountInPool(accountRef, poolName string) error {
+	pool, err := r.pool(poolName)
+	if err != nil || pool == nil {
+		return err
+	}
+
+	accounts, err := r.storage.ListAccounts()
+	if err != nil {
+		return fmt.Errorf("获取账户列表失败: %w", err)
+	}
+	for _, account := range accounts {
+		if (account.Name == accountRef || account.ID == accountRef) && account.InPool(pool) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s 不在 %s 中", ErrAccountNotInPool, accountRef, poolName)
+}
+
+// pool 按名称查找账户池配置，名称为空时返回nil
+func (r *RelayService) pool(name string) (*config.PoolConfig, error) {
+	if name == "" {
+		return nil, nil
+	}
+	pool, ok := r.Config().Pools[name]
+	if !ok || pool == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPool, name)
+	}
+	return pool, nil
+}
+
+// recordAccountUse 记录账户使用结果，失败只打印日志不影响请求
+func (r *RelayService) recordAccountUse(accountName string, useErr error) {
+	if err := r.storage.RecordAccountUse(accountName, useErr); err != nil {
+		slog.Warn("记录账户使用状态失败", "account", accountName, "error", err)
+	}
+}
+
+// accountLabel 账户的监控标签：账户ID，账户无法加载时为 metrics.UnknownAccount
+func (r *RelayService) accountLabel(accountName string) string {
+	if oauthData, err := r.storage.LoadOAuthData(accountName); err == nil {
+		return oauthData.ID
+	}
+	return metrics.UnknownAccount
 }
 
 // getValidToken 获取有效的OAuth token
-func (r *RelayService) getValidToken(accountName string) (*OAuthData, error) {
+func (r *RelayService) getValidToken(ctx context.Context, accountName string) (oauthData *OAuthData, err error) {
+	ctx, span := tracing.Start(ctx, "RelayService.getValidToken", trace.WithAttributes(attribute.String("account", accountName)))
+	defer func() { tracing.End(span, err) }()
+
 	// 加载OAuth数据
-	oauthData, err := r.storage.LoadOAuthData(accountName)
+	oauthData, err = r.storage.LoadOAuthData(accountName)
 	if err != nil {
 		return nil, fmt.Errorf("加载OAuth数据失败: %w", err)
 	}
 
+	// 拒绝已禁用的账户
+	if oauthData.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	// 凭据已失效的账户在重新授权或管理员解除隔离前不再使用
+	if oauthData.NeedsReauth {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNeedsReauth, accountName)
+	}
+
+	// 熔断中的账户不刷新token也不请求上游，冷却后放行一个试探请求
+	if !r.accountCircuits.Allow(oauthData.ID) {
+		return nil, fmt.Errorf("%w: 账户 %s", ErrCircuitOpen, accountName)
+	}
+
 	// 检查token是否需要刷新
 	if oauthData.NeedRefresh() {
-		fmt.Printf("🔄 Token即将过期，正在刷新...\n")
-		
-		// 刷新token
-		newOAuthData, err := r.oauthClient.RefreshAccessToken(oauthData.RefreshToken, oauthData.ProxyConfig)
+		lock := r.refreshLock(oauthData.ID)
+		lock.Lock()
+		defer lock.Unlock()
+
+		// 拿到锁后重新加载，其他请求可能已经完成刷新
+		oauthData, err = r.storage.LoadOAuthData(accountName)
 		if err != nil {
-			return nil, fmt.Errorf("刷新token失败: %w", err)
+			return nil, fmt.Errorf("加载OAuth数据失败: %w", err)
 		}
-
-		// 保存新的OAuth数据
-		if err := r.storage.SaveOAuthData(accountName, newOAuthData); err != nil {
-			return nil, fmt.Errorf("保存刷新后的OAuth数据失败: %w", err)
+		if !oauthData.NeedRefresh() {
+			return oauthData, nil
 		}
 
-		fmt.Printf("✅ Token刷新成功\n")
-		return newOAuthData, nil
+		slog.InfoContext(ctx, "Token即将过期，正在刷新", "account_id", oauthData.ID)
+		span.SetAttributes(attribute.Bool("token.refreshed", true))
+		return r.refreshToken(ctx, oauthData)
 	}
 
 	// 检查token是否有效
@@ -129,39 +489,153 @@ func (r *RelayService) getValidToken(accountName string) (*OAuthData, error) {
 	return oauthData, nil
 }
 
-// createHTTPClient 创建HTTP客户端
-func (r *RelayService) createHTTPClient(proxyConfig *ProxyConfig) (*http.Client, error) {
-	var finalProxyConfig *ProxyConfig
-	
-	// 优先使用全局代理配置
-	if r.config.Proxy.GlobalProxy != nil && r.config.Proxy.GlobalProxy.Enabled {
-		finalProxyConfig = &ProxyConfig{
-			Type:     r.config.Proxy.GlobalProxy.Type,
-			Host:     r.config.Proxy.GlobalProxy.Host,
-			Port:     r.config.Proxy.GlobalProxy.Port,
-			Username: r.config.Proxy.GlobalProxy.Username,
-			Password: r.config.Proxy.GlobalProxy.Password,
-		}
-	} else if proxyConfig != nil {
-		// 如果没有全局代理，使用账户特定的代理
+// RefreshAccount 立即刷新账户的token（管理操作，无论是否即将过期）
+func (r *RelayService) RefreshAccount(ctx context.Context, accountRef string) (*OAuthData, error) {
+	oauthData, err := r.storage.LoadOAuthData(accountRef)
+	if err != nil {
+		return nil, fmt.Errorf("加载OAuth数据失败: %w", err)
+	}
+
+	lock := r.refreshLock(oauthData.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 拿到锁后重新加载，使用最新的refresh token
+	oauthData, err = r.storage.LoadOAuthData(accountRef)
+	if err != nil {
+		return nil, fmt.Errorf("加载OAuth数据失败: %w", err)
+	}
+	return r.refreshToken(ctx, oauthData)
+}
+
+// refreshToken 刷新并保存token（调用方需持有账户的刷新锁）
+func (r *RelayService) refreshToken(ctx context.Context, oauthData *OAuthData) (*OAuthData, error) {
+	newOAuthData, err := r.oauthClient.RefreshAccessToken(ctx, oauthData.RefreshToken, oauthData.ProxyConfig)
+	metrics.TokenRefresh(oauthData.ID, err)
+	if err != nil {
+		r.accountCircuits.Record(oauthData.ID, err)
+		slog.WarnContext(ctx, "Token刷新失败", "account_id", oauthData.ID, "error", err)
+		r.notifyRefreshFailed(oauthData, err)
+		if isRefreshRejected(err) {
+			r.quarantine(ctx, oauthData, QuarantineRefreshRejected, err.Error())
+		}
+		return nil, fmt.Errorf("刷新token失败: %w", err)
+	}
+	newOAuthData.ID = oauthData.ID
+	newOAuthData.Name = oauthData.Name
+	newOAuthData.Disabled = oauthData.Disabled
+
+	// 保存新的OAuth数据
+	if err := r.storage.SaveOAuthData(oauthData.ID, newOAuthData); err != nil {
+		return nil, fmt.Errorf("保存刷新后的OAuth数据失败: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Token刷新成功", "account_id", oauthData.ID,
+		"expires_at", newOAuthData.ExpiresAt)
+	return newOAuthData, nil
+}
+
+// checkCredentials 上游拒绝账户凭据时判断是否隔离账户：组织被禁用、token被吊销时直接隔离；
+// 其他401强制刷新一次token，refresh token也被拒绝时由refreshToken隔离
+func (r *RelayService) checkCredentials(ctx context.Context, oauthData *OAuthData, upstreamErr *UpstreamError) {
+	if reason := upstreamErr.Quarantine(); reason != "" {
+		message := upstreamErr.Message
+		if message == "" {
+			message = upstreamErr.Body
+		}
+		r.quarantine(ctx, oauthData, reason, message)
+		return
+	}
+	if upstreamErr.Kind != metrics.ErrorAuth {
+		return
+	}
+
+	lock := r.refreshLock(oauthData.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 拿到锁后重新加载，其他请求可能已经刷新过token或隔离了账户
+	current, err := r.storage.LoadOAuthData(oauthData.ID)
+	if err != nil || current.NeedsReauth || current.AccessToken != oauthData.AccessToken {
+		return
+	}
+	slog.InfoContext(ctx, "上游拒绝access token，强制刷新", "account_id", oauthData.ID)
+	r.refreshToken(ctx, current)
+}
+
+// quarantine 隔离凭据已失效的账户，失败只打印日志不影响请求
+func (r *RelayService) quarantine(ctx context.Context, oauthData *OAuthData, reason, message string) {
+	message = truncateReason(message)
+	quarantined, err := r.storage.QuarantineAccount(oauthData.ID, reason, message)
+	if err != nil {
+		slog.WarnContext(ctx, "隔离账户失败", "account_id", oauthData.ID, "reason", reason, "error", err)
+		return
+	}
+	if quarantined {
+		metrics.AccountQuarantined(oauthData.ID, reason)
+		slog.WarnContext(ctx, "账户凭据已失效，已隔离等待重新授权", "account_id", oauthData.ID, "reason", reason)
+		r.notifyQuarantined(oauthData, reason, message)
+	}
+}
+
+// refreshLock 获取账户的刷新锁
+func (r *RelayService) refreshLock(accountID string) *sync.Mutex {
+	lock, _ := r.refreshLocks.LoadOrStore(accountID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// createHTTPClient 创建HTTP客户端，同时返回实际使用的代理（用于监控，不含认证信息，直连时为空）。
+// 回放模式下不访问上游，录制模式下经代理转发的同时录制上游流量
+func (r *RelayService) createHTTPClient(proxyConfig *ProxyConfig) (*http.Client, string, error) {
+	cfg := r.Config()
+	if cfg.Replay.Mode == config.ReplayModeReplay {
+		return &http.Client{
+			Transport: &replay.ReplayTransport{Dir: cfg.Replay.Dir, Realtime: cfg.Replay.Realtime},
+			Timeout:   cfg.Claude.Timeout,
+		}, "", nil
+	}
+
+	// 优先使用全局代理配置，没有全局代理时使用账户特定的代理
+	finalProxyConfig := globalProxy(cfg)
+	if finalProxyConfig == nil {
 		finalProxyConfig = proxyConfig
 	}
-	
+
 	transport, err := CreateProxyTransport(finalProxyConfig)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if cfg.Replay.Mode == config.ReplayModeRecord {
+		transport = &replay.RecordingTransport{Base: transport, Dir: cfg.Replay.Dir}
 	}
 
 	return &http.Client{
 		Transport: transport,
-		Timeout:   r.config.Claude.Timeout,
-	}, nil
+		Timeout:   cfg.Claude.Timeout,
+	}, finalProxyConfig.label(), nil
+}
+
+// globalProxy 启用的全局代理，未启用时为nil
+func globalProxy(cfg *config.Config) *ProxyConfig {
+	global := cfg.Proxy.GlobalProxy
+	if global == nil || !global.Enabled {
+		return nil
+	}
+	return &ProxyConfig{
+		Type:     global.Type,
+		Host:     global.Host,
+		Port:     global.Port,
+		Username: global.Username,
+		Password: global.Password,
+	}
 }
 
 // buildClaudeRequest 构建Claude API请求
-func (r *RelayService) buildClaudeRequest(requestBody []byte, accessToken string) (*http.Request, error) {
-	// 创建请求
-	req, err := http.NewRequest("POST", r.config.Claude.APIUrl, bytes.NewBuffer(requestBody))
+func (r *RelayService) buildClaudeRequest(ctx context.Context, requestBody []byte, accessToken string) (*http.Request, error) {
+	cfg := r.Config()
+
+	// 创建请求，客户端断开时取消上游请求
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Claude.APIUrl, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -169,71 +643,227 @@ func (r *RelayService) buildClaudeRequest(requestBody []byte, accessToken string
 	// 设置请求头
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	req.Header.Set("anthropic-version", r.config.Claude.APIVersion)
+	req.Header.Set("anthropic-version", cfg.Claude.APIVersion)
 	req.Header.Set("User-Agent", "claude-cli/1.0.53 (external, cli)")
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
 
 	// 设置beta header
-	if r.config.Claude.BetaHeader != "" {
-		req.Header.Set("anthropic-beta", r.config.Claude.BetaHeader)
+	if cfg.Claude.BetaHeader != "" {
+		req.Header.Set("anthropic-beta", cfg.Claude.BetaHeader)
 	}
 
 	return req, nil
 }
 
-// handleResponse 处理响应
-func (r *RelayService) handleResponse(resp *http.Response, accountName string) error {
-	// 检查HTTP状态码
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		// 读取错误响应
-		body, _ := io.ReadAll(resp.Body)
-		
-		// 检查是否为限流错误
-		if r.isRateLimitError(string(body)) {
-			fmt.Printf("🚫 检测到限流错误 (账户: %s)\n", accountName)
-		}
-		
-		return fmt.Errorf("Claude API错误 %d: %s", resp.StatusCode, string(body))
+// handleResponse 处理响应，上游返回错误时归类错误并记录错误类型和账户限流状态
+func (r *RelayService) handleResponse(resp *http.Response, accountName, accountID string) *UpstreamError {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		metrics.SetRateLimited(accountID, false, time.Time{})
+		return nil
 	}
 
-	return nil
+	body, _ := io.ReadAll(resp.Body)
+	upstreamErr := classifyUpstreamError(resp.StatusCode, body)
+	if upstreamErr.Kind == metrics.ErrorRateLimit {
+		metrics.SetRateLimited(accountID, true, retryAfter(resp))
+	}
+	metrics.UpstreamError(accountID, upstreamErr.Kind)
+	slog.WarnContext(resp.Request.Context(), "Claude API返回错误",
+		"account", accountName, "account_id", accountID, "status", resp.StatusCode,
+		"type", upstreamErr.Kind, "upstream_type", upstreamErr.Type)
+	return upstreamErr
 }
 
-// isRateLimitError 检查是否为限流错误
-func (r *RelayService) isRateLimitError(responseBody string) bool {
-	lowerBody := strings.ToLower(responseBody)
-	return strings.Contains(lowerBody, "rate limit") || 
-		   strings.Contains(lowerBody, "exceed your account's rate limit")
+// retryAfter 解析 retry-after 响应头（秒数），没有时返回零值
+func retryAfter(resp *http.Response) time.Time {
+	seconds, err := strconv.Atoi(resp.Header.Get("retry-after"))
+	if err != nil || seconds < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
 }
 
-// ProcessRequest 处理完整的请求流程
-func (r *RelayService) ProcessRequest(accountName string, requestData interface{}) (interface{}, error) {
+// ProcessRequest 处理完整的请求流程。未指定账户时由调度器按模型（及账户池）选择账户。
+// 上游返回SSE事件流（请求 stream:true）时逐个事件写入w，返回的响应数据为nil；
+// 开始写入后的错误无法再返回给客户端，调用方需检查w是否已写入
+func (r *RelayService) ProcessRequest(ctx context.Context, opts RequestOptions, requestData interface{}, w ResponseWriter) (_ interface{}, err error) {
+	ctx, span := tracing.Start(ctx, "RelayService.ProcessRequest")
+	defer func() { tracing.End(span, err) }()
+
+	// 审计记录随处理过程补全，请求结束时（包括失败）写入
+	entry := &audit.Entry{
+		Time:      time.Now(),
+		RequestID: logging.RequestID(ctx),
+		ClientIP:  opts.ClientIP,
+		APIKeyID:  opts.APIKeyID,
+		Account:   opts.Account,
+		Pool:      opts.Pool,
+	}
+	defer func() { r.recordAudit(entry, err) }()
+
+	// 按配置的别名替换模型名
+	var model string
+	if request, ok := requestData.(map[string]interface{}); ok {
+		if name, ok := request["model"].(string); ok {
+			model = r.Config().ResolveModel(name)
+			request["model"] = model
+		}
+	}
+	span.SetAttributes(attribute.String("model", model), attribute.String("pool", opts.Pool))
+	entry.Model = model
+
 	// 序列化请求数据
 	requestBody, err := json.Marshal(requestData)
 	if err != nil {
 		return nil, fmt.Errorf("序列化请求数据失败: %w", err)
 	}
+	entry.RequestBody = requestBody
 
-	fmt.Printf("📤 正在处理API请求 (账户: %s)\n", accountName)
+	// 未指定账户时调度，指定了账户时检查是否属于账户池
+	accountName := opts.Account
+	if accountName == "" {
+		if accountName, err = r.SelectAccount(model, opts.Pool); err != nil {
+			return nil, err
+		}
+	} else if err := r.checkAccountInPool(accountName, opts.Pool); err != nil {
+		return nil, err
+	}
 
-	// 转发请求
-	resp, err := r.RelayRequest(accountName, requestBody)
+	slog.DebugContext(ctx, "正在处理API请求", "account", accountName, "model", model, "pool", opts.Pool)
+	span.SetAttributes(attribute.String("account", accountName))
+	entry.Account = accountName
+
+	// 转发请求，监控按账户ID统计（账户加载失败时记为unknown）
+	start := time.Now()
+	account := metrics.UnknownAccount
+	defer func() { metrics.ObserveRelay(model, account, start, err) }()
+
+	resp, oauthData, err := r.relay(ctx, accountName, requestBody)
+	if oauthData != nil {
+		account = oauthData.ID
+		entry.AccountID = oauthData.ID
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	// 流式响应逐个事件转发给客户端，用量从事件中累计
+	if isEventStream(resp) {
+		if w == nil {
+			return nil, ErrStreamUnsupported
+		}
+		result, err := streamResponse(w, resp, r.auditCapture())
+		entry.ResponseBody = result.Captured
+		entry.Tokens = r.recordTokens(oauthData.ID, opts.APIKeyID, result.Model, result.Tokens)
+		if err != nil {
+			if ctx.Err() == nil {
+				metrics.UpstreamError(account, metrics.ErrorNetwork)
+			}
+			return nil, err
+		}
+		slog.InfoContext(ctx, "API请求处理完成", "account", accountName, "account_id", account, "model", model,
+			"stream", true, "duration_ms", time.Since(start).Milliseconds())
+		return nil, nil
+	}
+
 	// 读取响应
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
+		metrics.UpstreamError(account, metrics.ErrorNetwork)
 		return nil, fmt.Errorf("读取响应失败: %w", err)
 	}
+	entry.ResponseBody = responseBody
 
 	// 解析响应
 	var responseData interface{}
-	if err := json.Unmarshal(responseBody, &responseData); err != nil {
+	if err = json.Unmarshal(responseBody, &responseData); err != nil {
+		metrics.UpstreamError(account, metrics.ErrorInvalidBody)
 		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
 
-	fmt.Printf("✅ API请求处理完成\n")
+	// 记录用量
+	entry.Tokens = r.recordUsage(oauthData.ID, opts.APIKeyID, responseBody)
+
+	slog.InfoContext(ctx, "API请求处理完成", "account", accountName, "account_id", account, "model", model,
+		"duration_ms", time.Since(start).Milliseconds())
 	return responseData, nil
-}
\ No newline at end of file
+}
+
+// recordUsage 从响应中提取模型和token用量并记录，返回用量（响应中没有时为nil）
+func (r *RelayService) recordUsage(accountID, apiKeyID string, responseBody []byte) *usage.Tokens {
+	var response struct {
+		Model string        `json:"model"`
+		Usage *usage.Tokens `json:"usage"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil
+	}
+	return r.recordTokens(accountID, apiKeyID, response.Model, response.Usage)
+}
+
+// recordTokens 记录token用量，tokens为nil时跳过
+func (r *RelayService) recordTokens(accountID, apiKeyID, model string, tokens *usage.Tokens) *usage.Tokens {
+	if tokens == nil {
+		return nil
+	}
+	metrics.AddTokens(model, accountID, tokens.InputTokens, tokens.OutputTokens,
+		tokens.CacheCreationInputTokens, tokens.CacheReadInputTokens)
+	if r.usage != nil {
+		r.usage.Record(accountID, apiKeyID, model, *tokens)
+	}
+	return tokens
+}
+
+// auditCapture 流式响应为审计日志截取的字节数，未记录请求体时为0
+func (r *RelayService) auditCapture() int {
+	cfg := r.Config().Audit
+	if r.audit == nil || !cfg.IncludeBodies {
+		return 0
+	}
+	// 多截取1字节，由审计日志按上限截断并标记
+	return cfg.MaxBodyBytes + 1
+}
+
+// recordAudit 补全请求结果并写入审计日志（未启用时跳过）
+func (r *RelayService) recordAudit(entry *audit.Entry, err error) {
+	if r.audit == nil {
+		return
+	}
+	entry.LatencyMS = time.Since(entry.Time).Milliseconds()
+	entry.Status = ErrorStatus(err)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.audit.Record(entry)
+}
+
+// ErrorStatus 转发结果对应返回给客户端的HTTP状态码，err为nil时为200
+func ErrorStatus(err error) int {
+	var upstreamErr *UpstreamError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrUnknownPool):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAccountDisabled), errors.Is(err, ErrAccountNeedsReauth), errors.Is(err, ErrAccountNotInPool):
+		return http.StatusForbidden
+	case errors.Is(err, ErrAccountBusy), errors.Is(err, ErrQueueTimeout):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrNoAvailableAccount), errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &upstreamErr):
+		if status := upstreamErr.clientStatus(); status != 0 {
+			return status
+		}
+		// 账户本身的问题说明转发服务暂时无法提供服务，其他上游错误按网关错误返回
+		if upstreamErr.accountFault() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
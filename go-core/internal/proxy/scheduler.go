@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/config"
+)
+
+// ErrNoAvailableAccount 没有可调度的账户
+var ErrNoAvailableAccount = errors.New("没有可用的账户")
+
+// AccountSummary 调度所需的账户概要信息
+type AccountSummary struct {
+	ID          string
+	Name        string
+	Priority    int
+	Disabled    bool
+	NeedsReauth bool // 凭据已失效被隔离
+	TierRank    int  // 订阅等级排序值，越高额度越高（max > team > pro > free/未知）
+	LastUsedAt  *time.Time
+	LastErrorAt *time.Time
+	Tags        []string
+	Proxy       string // 账户绑定的代理（type://host:port），未绑定时为空
+}
+
+// Scheduler 账户调度器：请求未指定账户时选择一个可用账户。
+// 依次按订阅等级（仅Opus请求且开启偏好时）、优先级、最近是否出错排序，
+// 同等条件下选择最久未使用的账户
+type Scheduler struct {
+	preferHigherTierForOpus bool
+
+	mu sync.Mutex
+	// selectedAt 本进程内最近一次选中账户的时间，弥补使用时间落盘前的并发选择
+	selectedAt map[string]time.Time
+}
+
+// NewScheduler 创建账户调度器
+func NewScheduler(preferHigherTierForOpus bool) *Scheduler {
+	return &Scheduler{
+		preferHigherTierForOpus: preferHigherTierForOpus,
+		selectedAt:              make(map[string]time.Time),
+	}
+}
+
+// Select 为指定模型选择账户，pool不为nil时只在账户池内选择
+func (s *Scheduler) Select(accounts []*AccountSummary, model string, pool *config.PoolConfig) (*AccountSummary, error) {
+	candidates := make([]*AccountSummary, 0, len(accounts))
+	for _, account := range accounts {
+		if account.schedulable() && account.InPool(pool) {
+			candidates = append(candidates, account)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoAvailableAccount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preferTier := s.preferHigherTierForOpus && IsOpusModel(model)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if preferTier && a.TierRank != b.TierRank {
+			return a.TierRank > b.TierRank
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if ha, hb := a.healthy(), b.healthy(); ha != hb {
+			return ha
+		}
+		return s.lastUsed(a).Before(s.lastUsed(b))
+	})
+
+	selected := candidates[0]
+	s.selectedAt[selected.ID] = time.Now()
+	return selected, nil
+}
+
+// SetPreferHigherTierForOpus 配置热更新时调整Opus请求的订阅等级偏好
+func (s *Scheduler) SetPreferHigherTierForOpus(prefer bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preferHigherTierForOpus = prefer
+}
+
+// Forget 清理账户的调度状态
+func (s *Scheduler) Forget(accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.selectedAt, accountID)
+}
+
+// lastUsed 账户最近使用时间：取落盘的使用时间和本进程内选中时间的较晚者
+func (s *Scheduler) lastUsed(account *AccountSummary) time.Time {
+	var last time.Time
+	if account.LastUsedAt != nil {
+		last = *account.LastUsedAt
+	}
+	if selected, ok := s.selectedAt[account.ID]; ok && selected.After(last) {
+		last = selected
+	}
+	return last
+}
+
+// schedulable 账户是否参与调度：未禁用且未因凭据失效被隔离
+func (a *AccountSummary) schedulable() bool {
+	return !a.Disabled && !a.NeedsReauth
+}
+
+// healthy 最近一次使用是否成功
+func (a *AccountSummary) healthy() bool {
+	if a.LastErrorAt == nil {
+		return true
+	}
+	return a.LastUsedAt != nil && a.LastUsedAt.After(*a.LastErrorAt)
+}
+
+// InPool 账户是否属于账户池：按账户名、账户ID或标签匹配，pool为nil时视为属于
+func (a *AccountSummary) InPool(pool *config.PoolConfig) bool {
+	if pool == nil {
+		return true
+	}
+	for _, ref := range pool.Accounts {
+		if ref == a.Name || ref == a.ID {
+			return true
+		}
+	}
+	for _, tag := range pool.Tags {
+		for _, accountTag := range a.Tags {
+			if tag == accountTag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsOpusModel 是否为Opus系列模型
+func IsOpusModel(model string) bool {
+	return strings.Contains(strings.ToLower(model), "opus")
+}
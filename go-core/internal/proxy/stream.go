@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"claude-relay-core/internal/usage"
+)
+
+// ResponseWriter 流式响应的输出，需支持逐块刷新（gin.ResponseWriter 满足）
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+}
+
+// ErrStreamUnsupported 上游返回了SSE流，但调用方没有提供流式输出
+var ErrStreamUnsupported = errors.New("不支持流式响应")
+
+// isEventStream 上游响应是否为SSE事件流（请求 stream:true 时）
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// streamResult 流式转发的结果：响应中的模型、累计的用量和（按上限截取的）原始事件流
+type streamResult struct {
+	Model    string
+	Tokens   *usage.Tokens
+	Captured []byte
+}
+
+// streamResponse 把上游的SSE事件流逐个事件写给客户端并刷新，同时从 message_start 和 message_delta 事件中累计用量。
+// capture 为截取事件流原文（用于审计）的字节上限，0表示不截取
+func streamResponse(w ResponseWriter, resp *http.Response, capture int) (*streamResult, error) {
+	header := w.Header()
+	header.Set("Content-Type", resp.Header.Get("Content-Type"))
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // 避免前置的nginx缓冲事件流
+	w.WriteHeader(resp.StatusCode)
+	w.Flush()
+
+	result := &streamResult{}
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, err := w.Write(line); err != nil {
+				return result, fmt.Errorf("写入流式响应失败: %w", err)
+			}
+			// 空行是事件的结尾，每个事件写完后立即刷新
+			if len(bytes.TrimRight(line, "\r\n")) == 0 {
+				w.Flush()
+			}
+			result.observe(line)
+			if room := capture - len(result.Captured); room > 0 {
+				result.Captured = append(result.Captured, line[:min(room, len(line))]...)
+			}
+		}
+		if readErr == io.EOF {
+			w.Flush()
+			return result, nil
+		}
+		if readErr != nil {
+			w.Flush()
+			return result, fmt.Errorf("读取流式响应失败: %w", readErr)
+		}
+	}
+}
+
+// observe 从 data 行中提取模型和用量：message_start 给出输入和缓存token，message_delta 给出累计的输出token
+func (s *streamResult) observe(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimRight(line, "\r\n"), []byte("data:"))
+	if !ok {
+		return
+	}
+	var event struct {
+		Type    string `json:"type"`
+		Message struct {
+			Model string        `json:"model"`
+			Usage *usage.Tokens `json:"usage"`
+		} `json:"message"`
+		Usage *usage.Tokens `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.Model = event.Message.Model
+		if event.Message.Usage != nil {
+			tokens := *event.Message.Usage
+			s.Tokens = &tokens
+		}
+	case "message_delta":
+		if event.Usage == nil {
+			return
+		}
+		if s.Tokens == nil {
+			s.Tokens = &usage.Tokens{}
+		}
+		s.Tokens.OutputTokens = event.Usage.OutputTokens
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testStream = "event: message_start\n" +
+	`data: {"type":"message_start","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":12,"cache_read_input_tokens":30,"output_tokens":1}}}` + "\n\n" +
+	"event: content_block_delta\n" +
+	`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n" +
+	"event: message_delta\n" +
+	`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}` + "\n\n" +
+	"event: message_stop\n" +
+	`data: {"type":"message_stop"}` + "\n\n"
+
+func streamResp(body io.Reader) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream; charset=utf-8"}},
+		Body:       io.NopCloser(body),
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	resp := streamResp(strings.NewReader(testStream))
+	if !isEventStream(resp) {
+		t.Fatalf("应识别为SSE事件流")
+	}
+
+	w := httptest.NewRecorder()
+	result, err := streamResponse(w, resp, 20)
+	if err != nil {
+		t.Fatalf("转发事件流失败: %v", err)
+	}
+	if w.Body.String() != testStream || !w.Flushed {
+		t.Errorf("事件流应原样转发并刷新")
+	}
+	if w.Header().Get("Cache-Control") != "no-cache" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Errorf("响应头不正确: %v", w.Header())
+	}
+
+	if result.Model != "claude-sonnet-4-20250514" || result.Tokens == nil ||
+		result.Tokens.InputTokens != 12 || result.Tokens.CacheReadInputTokens != 30 || result.Tokens.OutputTokens != 7 {
+		t.Errorf("用量累计不正确: %+v %+v", result, result.Tokens)
+	}
+	if string(result.Captured) != testStream[:20] {
+		t.Errorf("审计截取应不超过上限: %q", result.Captured)
+	}
+}
+
+// failingReader 先返回部分数据，再返回错误（模拟上游连接中断）
+type failingReader struct {
+	data string
+	done bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("connection reset")
+	}
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestStreamResponseUpstreamError(t *testing.T) {
+	w := httptest.NewRecorder()
+	partial := testStream[:strings.Index(testStream, "event: content_block_delta")]
+	result, err := streamResponse(w, streamResp(&failingReader{data: partial}), 0)
+	if err == nil || !strings.Contains(err.Error(), "读取流式响应失败") {
+		t.Fatalf("上游中断时应返回错误: %v", err)
+	}
+	if w.Body.String() != partial || result.Tokens == nil || result.Tokens.InputTokens != 12 {
+		t.Errorf("中断前的事件应已转发并计入用量: %q %+v", w.Body.String(), result.Tokens)
+	}
+	if result.Captured != nil {
+		t.Errorf("未开启审计请求体时不应截取")
+	}
+}
+
+func TestIsEventStream(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Content-Type": []string{"application/json"}}}
+	if isEventStream(resp) {
+		t.Errorf("JSON响应不是事件流")
+	}
+}
@@ -0,0 +1,231 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoFixture 没有与请求指纹匹配的fixture
+var ErrNoFixture = errors.New("没有匹配的录制")
+
+// recordedRequestHeaders 录制的请求头，认证信息等其他头部不写入fixture
+var recordedRequestHeaders = []string{"Content-Type", "Anthropic-Version", "Anthropic-Beta"}
+
+// skippedResponseHeaders 不录制的响应头：回放时由内容重新生成，或可能包含会话信息
+var skippedResponseHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Set-Cookie":        true,
+}
+
+// Fixture 一次录制的上游请求和响应
+type Fixture struct {
+	Fingerprint string    `json:"fingerprint"`
+	RecordedAt  time.Time `json:"recorded_at"`
+	Request     Request   `json:"request"`
+	Response    Response  `json:"response"`
+}
+
+// Request 录制的请求
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response 录制的响应，响应体按上游到达的顺序分块保存
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// HeaderDelayMS 请求发出到收到响应头的耗时
+	HeaderDelayMS int64   `json:"header_delay_ms"`
+	Chunks        []Chunk `json:"chunks"`
+}
+
+// Chunk 响应体的一块，SSE响应中通常对应上游一次flush的事件
+type Chunk struct {
+	// DelayMS 距上一块的时间，第一块为距收到响应头的时间
+	DelayMS int64  `json:"delay_ms"`
+	Data    string `json:"data"`
+}
+
+// Body 完整的响应体
+func (r *Response) Body() []byte {
+	var body bytes.Buffer
+	for _, chunk := range r.Chunks {
+		body.WriteString(chunk.Data)
+	}
+	return body.Bytes()
+}
+
+// Fingerprint 请求指纹：方法、路径和规范化后的请求体（JSON字段排序）的SHA-256，
+// 与上游地址和请求头无关，录制时的上游地址不影响回放
+func Fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", method, path)
+	hash.Write(canonicalJSON(body))
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// canonicalJSON 按字段名排序重新序列化，不是JSON时原样返回
+func canonicalJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// newFixture 由请求创建fixture，响应在录制过程中补全
+func newFixture(req *http.Request, body []byte) *Fixture {
+	header := http.Header{}
+	for _, key := range recordedRequestHeaders {
+		if value := req.Header.Get(key); value != "" {
+			header.Set(key, value)
+		}
+	}
+
+	recorded := json.RawMessage(body)
+	if len(body) > 0 && !json.Valid(body) {
+		recorded, _ = json.Marshal(string(body))
+	}
+
+	return &Fixture{
+		Fingerprint: Fingerprint(req.Method, req.URL.Path, body),
+		RecordedAt:  time.Now(),
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Header: header,
+			Body:   recorded,
+		},
+	}
+}
+
+// responseHeader 需要录制的响应头
+func responseHeader(header http.Header) http.Header {
+	recorded := http.Header{}
+	for key, values := range header {
+		if !skippedResponseHeaders[http.CanonicalHeaderKey(key)] {
+			recorded[key] = append([]string(nil), values...)
+		}
+	}
+	return recorded
+}
+
+// fixturePath fixture文件路径
+func fixturePath(dir, fingerprint string) string {
+	return filepath.Join(dir, fingerprint+".json")
+}
+
+// Load 按指纹读取fixture，不存在时返回 ErrNoFixture
+func Load(dir, fingerprint string) (*Fixture, error) {
+	jsonData, err := os.ReadFile(fixturePath(dir, fingerprint))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNoFixture, fingerprint)
+		}
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(jsonData, &fixture); err != nil {
+		return nil, fmt.Errorf("解析录制文件 %s 失败: %w", fingerprint, err)
+	}
+	return &fixture, nil
+}
+
+// Save 写入fixture，同一指纹的旧录制被覆盖
+func Save(dir string, fixture *Fixture) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建录制目录失败: %w", err)
+	}
+	jsonData, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化录制数据失败: %w", err)
+	}
+
+	filename := fixturePath(dir, fixture.Fingerprint)
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, jsonData, 0600); err != nil {
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	if err := os.Rename(tmpFile, filename); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	return nil
+}
+
+// readRequestBody 读取请求体，不影响请求后续发送
+func readRequestBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+		defer body.Close()
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(body); err != nil {
+			return nil, nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+		return buf.Bytes(), req, nil
+	}
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取请求体失败: %w", err)
+	}
+	body := buf.Bytes()
+	clone := req.Clone(req.Context())
+	clone.Body = readCloser(body)
+	clone.GetBody = func() (io.ReadCloser, error) { return readCloser(body), nil }
+	return body, clone, nil
+}
+
+func readCloser(body []byte) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(body))
+}
+
+// List 读取目录中的全部fixture，按录制时间排序
+func List(dir string) ([]*Fixture, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("读取录制目录失败: %w", err)
+	}
+
+	fixtures := make([]*Fixture, 0, len(files))
+	for _, file := range files {
+		fixture, err := Load(dir, strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	sort.Slice(fixtures, func(i, j int) bool { return fixtures[i].RecordedAt.Before(fixtures[j].RecordedAt) })
+	return fixtures, nil
+}
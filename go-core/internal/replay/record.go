@@ -0,0 +1,86 @@
+package replay
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RecordingTransport 转发请求的同时录制上游请求和响应，响应体读取完毕时写入fixture文件。
+// 上游返回错误（连接失败等）或响应体未读完就关闭时不写入
+type RecordingTransport struct {
+	Base http.RoundTripper // 为nil时使用 http.DefaultTransport
+	Dir  string
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, req, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	fixture := newFixture(req, body)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture.Response = Response{
+		Status:        resp.StatusCode,
+		Header:        responseHeader(resp.Header),
+		HeaderDelayMS: time.Since(start).Milliseconds(),
+		Chunks:        []Chunk{},
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, dir: t.Dir, fixture: fixture, last: time.Now()}
+	return resp, nil
+}
+
+// recordingBody 按读取顺序记录响应体分块及间隔，读到EOF时保存fixture
+type recordingBody struct {
+	io.ReadCloser
+	dir     string
+	fixture *Fixture
+	last    time.Time
+	once    sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		now := time.Now()
+		b.fixture.Response.Chunks = append(b.fixture.Response.Chunks, Chunk{
+			DelayMS: now.Sub(b.last).Milliseconds(),
+			Data:    string(p[:n]),
+		})
+		b.last = now
+	}
+	if errors.Is(err, io.EOF) {
+		b.once.Do(b.save)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		slog.Debug("响应体未读完，丢弃录制", "fingerprint", b.fixture.Fingerprint)
+	})
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) save() {
+	if err := Save(b.dir, b.fixture); err != nil {
+		slog.Warn("保存上游录制失败", "fingerprint", b.fixture.Fingerprint, "error", err)
+		return
+	}
+	slog.Debug("已录制上游请求", "fingerprint", b.fixture.Fingerprint,
+		"path", b.fixture.Request.Path, "status", b.fixture.Response.Status)
+}
@@ -0,0 +1,176 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ReplayTransport 按请求指纹从fixture返回响应，不访问网络。没有匹配的fixture时返回404
+type ReplayTransport struct {
+	Dir string
+	// Realtime 按录制的时间间隔返回响应头和各个分块
+	Realtime bool
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, req, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	fingerprint := Fingerprint(req.Method, req.URL.Path, body)
+	fixture, err := Load(t.Dir, fingerprint)
+	if errors.Is(err, ErrNoFixture) {
+		slog.WarnContext(req.Context(), "没有匹配的上游录制", "fingerprint", fingerprint, "path", req.URL.Path)
+		return newResponse(req, http.StatusNotFound, jsonHeader(), io.NopCloser(bytes.NewReader(notFoundBody(fingerprint)))), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Realtime {
+		if err := sleep(req.Context(), fixture.Response.HeaderDelayMS); err != nil {
+			return nil, err
+		}
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(writeChunks(req.Context(), writer, fixture.Response.Chunks, true, nil))
+		}()
+		return newResponse(req, fixture.Response.Status, fixture.Response.Header.Clone(), reader), nil
+	}
+
+	return newResponse(req, fixture.Response.Status, fixture.Response.Header.Clone(),
+		io.NopCloser(bytes.NewReader(fixture.Response.Body()))), nil
+}
+
+// Handler 本地假上游（HTTP服务）：按请求指纹返回fixture中的响应，没有匹配的fixture时返回404
+type Handler struct {
+	Dir      string
+	Realtime bool
+}
+
+// ServeHTTP 实现 http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "读取请求体失败", http.StatusBadRequest)
+		return
+	}
+
+	fingerprint := Fingerprint(r.Method, r.URL.Path, body)
+	fixture, err := Load(h.Dir, fingerprint)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNoFixture) {
+			status = http.StatusNotFound
+		}
+		slog.WarnContext(r.Context(), "回放失败", "fingerprint", fingerprint, "path", r.URL.Path, "error", err)
+		for key, values := range jsonHeader() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(status)
+		w.Write(errorBody(status, err.Error()))
+		return
+	}
+
+	if h.Realtime {
+		if err := sleep(r.Context(), fixture.Response.HeaderDelayMS); err != nil {
+			return
+		}
+	}
+	for key, values := range fixture.Response.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(fixture.Response.Status)
+
+	flusher, _ := w.(http.Flusher)
+	if err := writeChunks(r.Context(), w, fixture.Response.Chunks, h.Realtime, flusher); err != nil {
+		slog.DebugContext(r.Context(), "回放中断", "fingerprint", fingerprint, "error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "已回放上游录制", "fingerprint", fingerprint, "path", r.URL.Path, "status", fixture.Response.Status)
+}
+
+// writeChunks 依次写出响应体分块，realtime时按录制的间隔等待，每块写出后flush
+func writeChunks(ctx context.Context, w io.Writer, chunks []Chunk, realtime bool, flusher http.Flusher) error {
+	for _, chunk := range chunks {
+		if realtime {
+			if err := sleep(ctx, chunk.DelayMS); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, chunk.Data); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+// sleep 等待指定毫秒数，ctx取消时提前返回
+func sleep(ctx context.Context, ms int64) error {
+	if ms <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(ms) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newResponse 构造回放的响应
+func newResponse(req *http.Request, status int, header http.Header, body io.ReadCloser) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
+
+// notFoundBody 没有匹配的fixture时的响应体
+func notFoundBody(fingerprint string) []byte {
+	return errorBody(http.StatusNotFound, fmt.Sprintf("%s: %s", ErrNoFixture, fingerprint))
+}
+
+// errorBody Claude API格式的错误响应体
+func errorBody(status int, message string) []byte {
+	errorType := "api_error"
+	if status == http.StatusNotFound {
+		errorType = "not_found_error"
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": errorType, "message": message},
+	})
+	return body
+}
@@ -0,0 +1,144 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	recordedPath   = "/v1/messages"
+	recordedStream = "event: message_start\ndata: {}\n\nevent: message_stop\ndata: {}\n\n"
+)
+
+// newUpstream 分两块返回SSE响应的上游，记录收到的请求数
+func newUpstream(t *testing.T, hits *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Request-Id", "req_1")
+		w.WriteHeader(http.StatusOK)
+		half := len(recordedStream) / 2
+		io.WriteString(w, recordedStream[:half])
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, recordedStream[half:])
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, transport http.RoundTripper, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-ant-oat01-secret")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("读取响应体失败: %v", err)
+	}
+	return string(body)
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint(http.MethodPost, recordedPath, []byte(`{"model":"claude","max_tokens":64}`))
+	b := Fingerprint(http.MethodPost, recordedPath, []byte("{\n  \"max_tokens\": 64,\n  \"model\": \"claude\"\n}"))
+	if a != b {
+		t.Errorf("字段顺序和空白不应影响指纹")
+	}
+	if a == Fingerprint(http.MethodPost, recordedPath, []byte(`{"model":"claude","max_tokens":65}`)) ||
+		a == Fingerprint(http.MethodPost, "/v1/complete", []byte(`{"model":"claude","max_tokens":64}`)) {
+		t.Errorf("请求体或路径不同时指纹应不同")
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	hits := 0
+	upstream := newUpstream(t, &hits)
+
+	resp := post(t, &RecordingTransport{Dir: dir}, upstream.URL+recordedPath, `{"model":"claude","max_tokens":64}`)
+	if body := readBody(t, resp); body != recordedStream {
+		t.Fatalf("录制时应原样返回上游响应: %q", body)
+	}
+
+	fixtures, err := List(dir)
+	if err != nil || len(fixtures) != 1 {
+		t.Fatalf("应写入1个录制文件: %v %d", err, len(fixtures))
+	}
+	fixture := fixtures[0]
+	if fixture.Request.Header.Get("Authorization") != "" || fixture.Response.Header.Get("Set-Cookie") != "" {
+		t.Errorf("认证信息和Cookie不应写入录制: %+v %+v", fixture.Request.Header, fixture.Response.Header)
+	}
+	if len(fixture.Response.Chunks) < 2 || fixture.Response.Chunks[len(fixture.Response.Chunks)-1].DelayMS < 10 {
+		t.Errorf("应按到达顺序记录分块及间隔: %+v", fixture.Response.Chunks)
+	}
+
+	// 字段顺序不同的同一请求命中录制，不访问上游
+	for _, realtime := range []bool{false, true} {
+		resp := post(t, &ReplayTransport{Dir: dir, Realtime: realtime}, "http://replay.invalid"+recordedPath, `{"max_tokens":64,"model":"claude"}`)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Request-Id") != "req_1" {
+			t.Errorf("回放的状态码或响应头不正确: %d %v", resp.StatusCode, resp.Header)
+		}
+		if body := readBody(t, resp); body != recordedStream {
+			t.Errorf("回放的响应体不正确（realtime=%v）: %q", realtime, body)
+		}
+	}
+
+	// 作为本地假上游回放
+	handler := httptest.NewServer(&Handler{Dir: dir})
+	t.Cleanup(handler.Close)
+	if body := readBody(t, post(t, http.DefaultTransport, handler.URL+recordedPath, `{"model":"claude","max_tokens":64}`)); body != recordedStream {
+		t.Errorf("Handler回放的响应体不正确: %q", body)
+	}
+	if hits != 1 {
+		t.Errorf("回放不应访问上游，上游收到 %d 次请求", hits)
+	}
+}
+
+func TestReplayMiss(t *testing.T) {
+	dir := t.TempDir()
+
+	resp := post(t, &ReplayTransport{Dir: dir}, "http://replay.invalid"+recordedPath, `{"model":"claude"}`)
+	if body := readBody(t, resp); resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "not_found_error") {
+		t.Errorf("没有匹配的录制时应返回404: %d %s", resp.StatusCode, body)
+	}
+
+	handler := httptest.NewServer(&Handler{Dir: dir})
+	t.Cleanup(handler.Close)
+	resp = post(t, http.DefaultTransport, handler.URL+recordedPath, `{"model":"claude"}`)
+	if body := readBody(t, resp); resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "没有匹配的录制") {
+		t.Errorf("Handler没有匹配的录制时应返回404: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestRecordingDiscardedOnEarlyClose(t *testing.T) {
+	dir := t.TempDir()
+	hits := 0
+	upstream := newUpstream(t, &hits)
+
+	resp := post(t, &RecordingTransport{Dir: dir}, upstream.URL+recordedPath, `{"model":"claude"}`)
+	resp.Body.Close()
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) != 0 {
+		t.Errorf("响应体未读完时不应写入录制: %v", entries)
+	}
+}
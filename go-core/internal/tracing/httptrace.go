@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 上游请求span上记录的属性
+const (
+	// AttrTTFT 请求发送完成到收到响应首字节的耗时（毫秒），即上游的首token时间
+	AttrTTFT = attribute.Key("claude.ttft_ms")
+	// AttrStreamDuration 收到响应首字节到响应体读取完成的耗时（毫秒）
+	AttrStreamDuration = attribute.Key("claude.stream_duration_ms")
+)
+
+// clientTrace 把一次HTTP请求的连接阶段记录为当前span的子span
+type clientTrace struct {
+	ctx context.Context
+
+	mu       sync.Mutex
+	dns      trace.Span
+	connects map[string]trace.Span
+	tls      trace.Span
+	wroteAt  time.Time
+}
+
+// WithClientTrace 返回附加了httptrace的context：DNS解析、建立连接（经代理时为到代理的连接）
+// 和TLS握手记录为ctx中span的子span，首字节时间记录为该span的 claude.ttft_ms 属性
+func WithClientTrace(ctx context.Context) context.Context {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx
+	}
+
+	t := &clientTrace{ctx: ctx, connects: make(map[string]trace.Span)}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             t.dnsStart,
+		DNSDone:              t.dnsDone,
+		ConnectStart:         t.connectStart,
+		ConnectDone:          t.connectDone,
+		TLSHandshakeStart:    t.tlsHandshakeStart,
+		TLSHandshakeDone:     t.tlsHandshakeDone,
+		GotConn:              t.gotConn,
+		WroteRequest:         t.wroteRequest,
+		GotFirstResponseByte: t.gotFirstResponseByte,
+	})
+}
+
+func (t *clientTrace) dnsStart(info httptrace.DNSStartInfo) {
+	_, span := Start(t.ctx, "dns", trace.WithAttributes(attribute.String("net.host.name", info.Host)))
+	t.mu.Lock()
+	t.dns = span
+	t.mu.Unlock()
+}
+
+func (t *clientTrace) dnsDone(info httptrace.DNSDoneInfo) {
+	t.mu.Lock()
+	span := t.dns
+	t.dns = nil
+	t.mu.Unlock()
+	if span != nil {
+		End(span, info.Err)
+	}
+}
+
+func (t *clientTrace) connectStart(network, addr string) {
+	_, span := Start(t.ctx, "dial", trace.WithAttributes(
+		attribute.String("net.transport", network),
+		attribute.String("net.peer.address", addr),
+	))
+	t.mu.Lock()
+	t.connects[network+" "+addr] = span
+	t.mu.Unlock()
+}
+
+func (t *clientTrace) connectDone(network, addr string, err error) {
+	t.mu.Lock()
+	span := t.connects[network+" "+addr]
+	delete(t.connects, network+" "+addr)
+	t.mu.Unlock()
+	if span != nil {
+		End(span, err)
+	}
+}
+
+func (t *clientTrace) tlsHandshakeStart() {
+	_, span := Start(t.ctx, "tls_handshake")
+	t.mu.Lock()
+	t.tls = span
+	t.mu.Unlock()
+}
+
+func (t *clientTrace) tlsHandshakeDone(state tls.ConnectionState, err error) {
+	t.mu.Lock()
+	span := t.tls
+	t.tls = nil
+	t.mu.Unlock()
+	if span != nil {
+		span.SetAttributes(
+			attribute.String("tls.server_name", state.ServerName),
+			attribute.String("tls.protocol", state.NegotiatedProtocol),
+		)
+		End(span, err)
+	}
+}
+
+func (t *clientTrace) gotConn(info httptrace.GotConnInfo) {
+	trace.SpanFromContext(t.ctx).SetAttributes(
+		attribute.Bool("http.conn_reused", info.Reused),
+		attribute.Bool("http.conn_was_idle", info.WasIdle),
+	)
+}
+
+func (t *clientTrace) wroteRequest(httptrace.WroteRequestInfo) {
+	t.mu.Lock()
+	t.wroteAt = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *clientTrace) gotFirstResponseByte() {
+	t.mu.Lock()
+	wroteAt := t.wroteAt
+	t.mu.Unlock()
+	if !wroteAt.IsZero() {
+		trace.SpanFromContext(t.ctx).SetAttributes(AttrTTFT.Int64(time.Since(wroteAt).Milliseconds()))
+	}
+}
@@ -0,0 +1,266 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"claude-relay-core/internal/config"
+)
+
+// dateLayout 用量按天汇总的日期格式
+const dateLayout = "2006-01-02"
+
+// Tokens 单次请求的token用量（对应Claude API响应中的usage字段）
+type Tokens struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// Add 累加用量
+func (t *Tokens) Add(other Tokens) {
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.CacheCreationInputTokens += other.CacheCreationInputTokens
+	t.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Record 按天、账户、API Key和模型汇总的用量记录
+type Record struct {
+	Date      string `json:"date"`
+	AccountID string `json:"account_id"`
+	APIKeyID  string `json:"api_key_id,omitempty"`
+	Model     string `json:"model"`
+	Requests  int64  `json:"requests"`
+	Tokens
+
+	// CostUSD 按配置的模型价格估算的费用，只在查询时计算，不落盘
+	CostUSD float64 `json:"cost_usd,omitempty"`
+}
+
+// Filter 用量查询条件，空字段表示不过滤
+type Filter struct {
+	From      string // 起始日期（含），格式 2006-01-02
+	To        string // 结束日期（含）
+	AccountID string
+	APIKeyID  string
+	Model     string
+}
+
+// recordKey 汇总维度
+type recordKey struct {
+	date, accountID, apiKeyID, model string
+}
+
+// Recorder 用量记录器：在内存中汇总，定期写入 data/usage.json
+type Recorder struct {
+	filename string
+
+	mu      sync.Mutex
+	records map[recordKey]*Record
+	dirty   bool
+}
+
+// NewRecorder 创建用量记录器并加载已有数据
+func NewRecorder(dataDir string) (*Recorder, error) {
+	r := &Recorder{
+		filename: filepath.Join(dataDir, "usage.json"),
+		records:  make(map[recordKey]*Record),
+	}
+
+	jsonData, err := os.ReadFile(r.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("读取用量文件失败: %w", err)
+	}
+
+	var records []*Record
+	if err := json.Unmarshal(jsonData, &records); err != nil {
+		return nil, fmt.Errorf("解析用量文件失败: %w", err)
+	}
+	for _, record := range records {
+		r.records[recordKey{record.Date, record.AccountID, record.APIKeyID, record.Model}] = record
+	}
+	return r, nil
+}
+
+// Record 记录一次请求的用量
+func (r *Recorder) Record(accountID, apiKeyID, model string, tokens Tokens) {
+	key := recordKey{time.Now().Format(dateLayout), accountID, apiKeyID, model}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[key]
+	if !ok {
+		record = &Record{Date: key.date, AccountID: accountID, APIKeyID: apiKeyID, Model: model}
+		r.records[key] = record
+	}
+	record.Requests++
+	record.Tokens.Add(tokens)
+	r.dirty = true
+}
+
+// Query 按条件查询用量记录，按日期、账户、模型排序
+func (r *Recorder) Query(filter Filter) []*Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var records []*Record
+	for _, record := range r.records {
+		if filter.From != "" && record.Date < filter.From {
+			continue
+		}
+		if filter.To != "" && record.Date > filter.To {
+			continue
+		}
+		if filter.AccountID != "" && record.AccountID != filter.AccountID {
+			continue
+		}
+		if filter.APIKeyID != "" && record.APIKeyID != filter.APIKeyID {
+			continue
+		}
+		if filter.Model != "" && record.Model != filter.Model {
+			continue
+		}
+		copied := *record
+		records = append(records, &copied)
+	}
+
+	sortRecords(records)
+	return records
+}
+
+// Flush 将内存中的用量写入文件
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return nil
+	}
+
+	records := make([]*Record, 0, len(r.records))
+	for _, record := range r.records {
+		records = append(records, record)
+	}
+	sortRecords(records)
+
+	if err := os.MkdirAll(filepath.Dir(r.filename), 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+	jsonData, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化用量数据失败: %w", err)
+	}
+
+	tmpFile := r.filename + ".tmp"
+	if err := os.WriteFile(tmpFile, jsonData, 0600); err != nil {
+		return fmt.Errorf("写入用量文件失败: %w", err)
+	}
+	if err := os.Rename(tmpFile, r.filename); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("写入用量文件失败: %w", err)
+	}
+
+	r.dirty = false
+	return nil
+}
+
+// Run 定期写入用量数据，ctx取消时最后写入一次后返回
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Flush(); err != nil {
+				slog.Warn("写入用量数据失败", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := r.Flush(); err != nil {
+				slog.Warn("写入用量数据失败", "error", err)
+			}
+		}
+	}
+}
+
+// ApplyPricing 按配置的模型价格估算每条记录的费用，没有配置价格的模型费用为0
+func ApplyPricing(records []*Record, cfg *config.Config) {
+	for _, record := range records {
+		price := cfg.PriceFor(record.Model)
+		if price == nil {
+			continue
+		}
+		record.CostUSD = (float64(record.InputTokens)*price.Input +
+			float64(record.OutputTokens)*price.Output +
+			float64(record.CacheCreationInputTokens)*price.CacheWrite +
+			float64(record.CacheReadInputTokens)*price.CacheRead) / 1e6
+	}
+}
+
+// Summarize 将用量记录按维度汇总，groupBy可选 date, account, key, model，为空时汇总为一条
+func Summarize(records []*Record, groupBy string) []*Record {
+	summary := make(map[string]*Record)
+	var order []string
+	for _, record := range records {
+		var group string
+		result := &Record{}
+		switch groupBy {
+		case "date":
+			group, result.Date = record.Date, record.Date
+		case "account":
+			group, result.AccountID = record.AccountID, record.AccountID
+		case "key":
+			group, result.APIKeyID = record.APIKeyID, record.APIKeyID
+		case "model":
+			group, result.Model = record.Model, record.Model
+		}
+
+		if existing, ok := summary[group]; ok {
+			result = existing
+		} else {
+			summary[group] = result
+			order = append(order, group)
+		}
+		result.Requests += record.Requests
+		result.Tokens.Add(record.Tokens)
+		result.CostUSD += record.CostUSD
+	}
+
+	sort.Strings(order)
+	results := make([]*Record, 0, len(order))
+	for _, group := range order {
+		results = append(results, summary[group])
+	}
+	return results
+}
+
+// sortRecords 按日期、账户、API Key、模型排序
+func sortRecords(records []*Record) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.APIKeyID != b.APIKeyID {
+			return a.APIKeyID < b.APIKeyID
+		}
+		return a.Model < b.Model
+	})
+}
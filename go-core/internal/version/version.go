@@ -0,0 +1,80 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// 构建时通过 -ldflags 注入，例如：
+//
+//	go build -ldflags "-X claude-relay-core/internal/version.Version=v1.2.0" ./cmd/server
+//
+// 未注入时从 debug.ReadBuildInfo 读取模块版本和VCS信息
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info 构建信息
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // 构建时工作区有未提交的修改
+	GoVersion string `json:"go_version"`
+}
+
+// Get 返回构建信息，ldflags注入的值优先
+var Get = sync.OnceValue(func() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+})
+
+// String 版本号，带上提交的前12位（如有）
+func String() string {
+	info := Get()
+	s := info.Version
+	if info.Commit != "" {
+		commit := info.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		s += " (" + commit
+		if info.Modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/proxy"
+)
+
+// circuitsResponse GET /admin/circuits 的响应
+type circuitsResponse struct {
+	Circuits []proxy.CircuitStatus `json:"circuits"`
+	Events   []proxy.CircuitEvent  `json:"events"`
+}
+
+// circuits 查询熔断状态
+func (e *env) circuits() circuitsResponse {
+	e.t.Helper()
+
+	status, body := e.do(http.MethodGet, "/admin/circuits", nil)
+	if status != http.StatusOK {
+		e.t.Fatalf("查询熔断状态失败: %d %s", status, body)
+	}
+	var resp circuitsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		e.t.Fatalf("解析熔断状态失败: %v", err)
+	}
+	return resp
+}
+
+// circuitState 指定账户或出口的熔断状态，没有记录时为 closed
+func (r circuitsResponse) circuitState(kind, name string) string {
+	for _, circuit := range r.Circuits {
+		if circuit.Kind == kind && circuit.Name == name {
+			return circuit.State
+		}
+	}
+	return proxy.CircuitClosed
+}
+
+// withBreaker 熔断阈值：窗口内至少2个请求且全部失败时熔断
+func withBreaker(cooldown time.Duration) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Breaker = config.BreakerConfig{
+			Enabled:      true,
+			Window:       time.Minute,
+			MinRequests:  2,
+			FailureRatio: 1,
+			Cooldown:     cooldown,
+		}
+	}
+}
+
+func TestAccountCircuitBreaker(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, withBreaker(200*time.Millisecond))
+	e.importAccount("alice", nil)
+	e.importAccount("bob", nil)
+	alice := e.storedAccount("alice").ID
+
+	// 连续的401使alice熔断
+	e.mock.Script(mockupstream.Unauthorized(), mockupstream.Unauthorized())
+	for i := 0; i < 2; i++ {
+		if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+			t.Fatalf("上游返回401时转发不应成功: %s", body)
+		}
+	}
+	if state := e.circuits().circuitState(proxy.CircuitAccount, alice); state != proxy.CircuitOpen {
+		t.Fatalf("连续401后账户应熔断，实际 %s", state)
+	}
+
+	// 熔断期间指定alice直接拒绝，不访问上游；调度跳过alice
+	upstreamRequests := len(e.mock.Requests())
+	status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false))
+	if status != http.StatusServiceUnavailable || len(e.mock.Requests()) != upstreamRequests {
+		t.Fatalf("熔断中的账户应返回503且不访问上游，实际 %d %s", status, body)
+	}
+	for i := 0; i < 3; i++ {
+		status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+		if status != http.StatusOK || !strings.Contains(messageText(t, body), "bob") {
+			t.Fatalf("调度应跳过熔断中的账户: %d %s", status, body)
+		}
+	}
+
+	// 冷却后放行一个试探请求，成功后恢复
+	time.Sleep(250 * time.Millisecond)
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+		t.Fatalf("冷却后的试探请求应成功: %d %s", status, body)
+	}
+	circuits := e.circuits()
+	if state := circuits.circuitState(proxy.CircuitAccount, alice); state != proxy.CircuitClosed {
+		t.Fatalf("试探成功后应关闭熔断，实际 %s", state)
+	}
+	var transitions []string
+	for _, event := range circuits.Events {
+		if event.Name == alice {
+			transitions = append(transitions, event.To)
+		}
+	}
+	if strings.Join(transitions, ",") != "open,half_open,closed" {
+		t.Fatalf("管理接口中的状态变化不正确: %v", transitions)
+	}
+}
+
+func TestEgressCircuitBreaker(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, withBreaker(time.Hour))
+	p := newSOCKS5Proxy(t, "", "")
+	proxyConfig := p.config()
+	e.importAccount("alice", proxyConfig)
+	e.importAccount("bob", nil)
+
+	// 代理停止后连接失败，出口熔断
+	p.close()
+	for i := 0; i < 2; i++ {
+		if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+			t.Fatalf("代理不可用时转发不应成功: %s", body)
+		}
+	}
+	egress := proxyConfig.String()
+	if state := e.circuits().circuitState(proxy.CircuitEgress, egress); state != proxy.CircuitOpen {
+		t.Fatalf("代理连续失败后出口应熔断，实际 %s", state)
+	}
+
+	// 使用该代理的账户被调度跳过
+	status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status != http.StatusOK || !strings.Contains(messageText(t, body), "bob") {
+		t.Fatalf("调度应跳过出口熔断的账户: %d %s", status, body)
+	}
+
+	// 手动恢复
+	status, body = e.do(http.MethodPost, "/admin/circuits/reset", map[string]string{"kind": proxy.CircuitEgress, "name": egress})
+	if status != http.StatusOK {
+		t.Fatalf("手动恢复失败: %d %s", status, body)
+	}
+	if state := e.circuits().circuitState(proxy.CircuitEgress, egress); state != proxy.CircuitClosed {
+		t.Fatalf("手动恢复后应关闭熔断，实际 %s", state)
+	}
+	if status, _ := e.do(http.MethodPost, "/admin/circuits/reset", map[string]string{"kind": proxy.CircuitEgress, "name": "socks5://nowhere:1"}); status != http.StatusNotFound {
+		t.Fatalf("没有记录的熔断应返回404，实际 %d", status)
+	}
+}
@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/proxy"
+)
+
+// holdSlot 直接通过转发服务发起请求且不关闭响应体，占用账户的一个并发名额，返回释放函数
+func (e *env) holdSlot(account string) func() {
+	e.t.Helper()
+
+	body, _ := json.Marshal(messageRequest(false))
+	resp, err := e.relay.RelayRequest(context.Background(), account, body)
+	if err != nil {
+		e.t.Fatalf("占用账户 %s 的名额失败: %v", account, err)
+	}
+	e.t.Cleanup(func() { resp.Body.Close() })
+	return func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// concurrency 读取账户状态中的并发信息
+func (e *env) concurrency(account string) proxy.ConcurrencyStatus {
+	e.t.Helper()
+
+	status, body := e.do(http.MethodGet, "/oauth/accounts/"+account+"/status", nil)
+	if status != http.StatusOK {
+		e.t.Fatalf("读取账户状态失败: %d %s", status, body)
+	}
+	var resp struct {
+		Concurrency proxy.ConcurrencyStatus `json:"concurrency"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		e.t.Fatalf("解析账户状态失败: %v", err)
+	}
+	return resp.Concurrency
+}
+
+// waitQueued 等待账户的排队数达到n
+func (e *env) waitQueued(account string, n int) {
+	e.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for e.concurrency(account).Queued != n {
+		if time.Now().After(deadline) {
+			e.t.Fatalf("账户 %s 的排队数应为 %d: %+v", account, n, e.concurrency(account))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, func(cfg *config.Config) {
+		cfg.Concurrency.MaxPerAccount = 1
+		cfg.Concurrency.MaxQueue = 1
+		cfg.Concurrency.QueueTimeout = 5 * time.Second
+	})
+	e.importAccount("alice", nil)
+
+	release := e.holdSlot("alice")
+	if got := e.concurrency("alice"); got.Active != 1 || got.Limit != 1 {
+		t.Fatalf("占用名额后的状态不正确: %+v", got)
+	}
+
+	// 第二个请求排队，第三个请求因队列已满被拒绝
+	type result struct {
+		status int
+		body   []byte
+	}
+	queued := make(chan result, 1)
+	go func() {
+		status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false))
+		queued <- result{status, body}
+	}()
+	e.waitQueued("alice", 1)
+
+	status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false))
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("队列已满应返回429，实际 %d %s", status, body)
+	}
+
+	release()
+	select {
+	case r := <-queued:
+		if r.status != http.StatusOK {
+			t.Fatalf("排队的请求应在名额释放后完成: %d %s", r.status, r.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("名额释放后排队的请求没有完成")
+	}
+	if got := e.concurrency("alice"); got.Active != 0 || got.Queued != 0 {
+		t.Fatalf("请求结束后状态应为空: %+v", got)
+	}
+	if requests := e.mock.Requests(); len(requests) != 2 {
+		t.Fatalf("被拒绝的请求不应访问上游，上游收到 %d 个请求", len(requests))
+	}
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, func(cfg *config.Config) {
+		cfg.Concurrency.MaxPerAccount = 1
+		cfg.Concurrency.MaxQueue = 1
+		cfg.Concurrency.QueueTimeout = 50 * time.Millisecond
+	})
+	e.importAccount("alice", nil)
+	e.holdSlot("alice")
+
+	status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status != http.StatusTooManyRequests || !strings.Contains(string(body), "超时") {
+		t.Fatalf("排队超时应返回429，实际 %d %s", status, body)
+	}
+	if got := e.concurrency("alice"); got.Queued != 0 {
+		t.Fatalf("超时的请求应离开队列: %+v", got)
+	}
+}
+
+func TestConcurrencySpillover(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, func(cfg *config.Config) {
+		cfg.Concurrency.MaxPerAccount = 1
+		cfg.Concurrency.Spillover = true
+	})
+	e.importAccount("alice", nil)
+	e.importAccount("bob", nil)
+	e.holdSlot("alice")
+
+	// 未指定账户的请求调度到还有名额的账户
+	for i := 0; i < 3; i++ {
+		status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+		if status != http.StatusOK {
+			t.Fatalf("应溢出到空闲账户: %d %s", status, body)
+		}
+		if text := messageText(t, body); !strings.Contains(text, "bob") {
+			t.Fatalf("请求应由bob处理: %q", text)
+		}
+	}
+
+	// 所有账户都已满且不排队时拒绝
+	e.holdSlot("bob")
+	if status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false)); status != http.StatusTooManyRequests {
+		t.Fatalf("所有账户都已满时应返回429，实际 %d %s", status, body)
+	}
+
+	// 关闭溢出后按调度结果排队，不再避开已满的账户
+	updated := *e.cfg
+	updated.Concurrency.Spillover = false
+	updated.Concurrency.Accounts = map[string]int{"alice": 2}
+	e.relay.UpdateConfig(&updated)
+	if got := e.concurrency("alice"); got.Limit != 2 {
+		t.Fatalf("按账户名覆盖的上限未生效: %+v", got)
+	}
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+		t.Fatalf("调高上限后应立即可用: %d %s", status, body)
+	}
+}
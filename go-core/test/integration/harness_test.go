@@ -0,0 +1,342 @@
+// Package integration 端到端集成测试：用 routes.SetupRoutes 搭建完整的gin路由，
+// 上游（OAuth和 /v1/messages）由 mockupstream 模拟，代理由本地的SOCKS5/HTTP代理替身提供
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/api/middleware"
+	"claude-relay-core/internal/api/routes"
+	"claude-relay-core/internal/apikey"
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/logging"
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/notify"
+	"claude-relay-core/internal/oauth"
+	"claude-relay-core/internal/proxy"
+	"claude-relay-core/internal/usage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminToken = "integration-admin-token"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// 转发服务的日志只在 -v 时输出
+	flag.Parse()
+	logOutput := io.Discard
+	if testing.Verbose() {
+		logOutput = os.Stderr
+	}
+	logging.Setup(logOutput, config.LogConfig{Level: "debug", Format: config.LogFormatText})
+	os.Exit(m.Run())
+}
+
+// env 一套独立的测试环境：模拟上游、数据目录和转发服务
+type env struct {
+	t        *testing.T
+	cfg      *config.Config
+	mock     *mockupstream.Server
+	upstream *httptest.Server
+	hits     *hitCounter
+	storage  *oauth.Storage
+	relay    *proxy.RelayService
+	notifier *notify.Notifier
+	server   *httptest.Server
+}
+
+// newEnv 创建测试环境，configure 在创建路由前修改配置
+func newEnv(t *testing.T, opts mockupstream.Options, configure func(cfg *config.Config)) *env {
+	t.Helper()
+
+	mock := mockupstream.New(opts)
+	hits := &hitCounter{counts: make(map[string]int)}
+	upstream := httptest.NewServer(hits.wrap(mock))
+	t.Cleanup(upstream.Close)
+
+	cfg := config.Default()
+	cfg.Server.DataDir = t.TempDir()
+	cfg.Auth.AdminToken = adminToken
+	cfg.Metrics.Enabled = false
+	cfg.OAuth.LoopbackRedirectURI = "http://localhost/callback"
+	mock.Configure(cfg, upstream.URL)
+	if configure != nil {
+		configure(cfg)
+	}
+
+	oauthClient := oauth.NewClient(cfg)
+	storage := oauth.NewStorage(cfg.Server.DataDir)
+	keys := apikey.NewStore(cfg.Server.DataDir)
+	recorder, err := usage.NewRecorder(cfg.Server.DataDir)
+	if err != nil {
+		t.Fatalf("创建用量记录失败: %v", err)
+	}
+	if cfg.Notify.DeadLetterFile == "" {
+		cfg.Notify.DeadLetterFile = filepath.Join(cfg.Server.DataDir, "notify", "dead_letters.jsonl")
+	}
+	notifier := notify.New(cfg.Notify)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		notifier.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	relayService := proxy.NewRelayService(cfg, &oauthClientAdapter{oauthClient}, &storageAdapter{storage}, recorder, nil, notifier)
+
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.Recovery())
+	routes.SetupRoutes(router, cfg, oauthClient, storage, relayService, keys, recorder, nil, notifier)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &env{
+		t:        t,
+		cfg:      cfg,
+		mock:     mock,
+		upstream: upstream,
+		hits:     hits,
+		storage:  storage,
+		relay:    relayService,
+		notifier: notifier,
+		server:   server,
+	}
+}
+
+// do 向转发服务发送请求，管理接口自动带上管理令牌，返回状态码和响应体
+func (e *env) do(method, path string, body interface{}) (int, []byte) {
+	e.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			e.t.Fatalf("序列化请求失败: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, e.server.URL+path, reader)
+	if err != nil {
+		e.t.Fatalf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if strings.HasPrefix(path, "/oauth") || strings.HasPrefix(path, "/admin") {
+		req.Header.Set("X-Admin-Token", adminToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatalf("%s %s 失败: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatalf("读取响应失败: %v", err)
+	}
+	return resp.StatusCode, data
+}
+
+// importAccount 在模拟上游创建账户并通过导入接口加入转发服务
+func (e *env) importAccount(name string, proxyConfig *oauth.ProxyConfig) {
+	e.t.Helper()
+
+	account := e.mock.AddAccount(name, mockupstream.OrganizationMax)
+	status, body := e.do(http.MethodPost, "/oauth/accounts/import", map[string]interface{}{
+		"account_name": name,
+		"credentials":  account.Credentials(),
+		"proxy_config": proxyConfig,
+	})
+	if status != http.StatusOK {
+		e.t.Fatalf("导入账户 %s 失败: %d %s", name, status, body)
+	}
+}
+
+// expireAccount 使账户的token在转发服务和模拟上游中都已过期
+func (e *env) expireAccount(name string) {
+	e.t.Helper()
+
+	e.mock.ExpireAccessToken(name)
+	_, err := e.storage.UpdateAccount(name, func(data *oauth.OAuthData) error {
+		data.ExpiresAt = time.Now().Add(-time.Minute)
+		return nil
+	})
+	if err != nil {
+		e.t.Fatalf("修改账户过期时间失败: %v", err)
+	}
+}
+
+// storedAccount 读取转发服务保存的账户
+func (e *env) storedAccount(name string) *oauth.OAuthData {
+	e.t.Helper()
+
+	data, err := e.storage.LoadOAuthData(name)
+	if err != nil {
+		e.t.Fatalf("读取账户 %s 失败: %v", name, err)
+	}
+	return data
+}
+
+// messageRequest /api/v1/messages 请求体
+func messageRequest(stream bool) map[string]interface{} {
+	return map[string]interface{}{
+		"model":      "claude-sonnet-4-20250514",
+		"max_tokens": 64,
+		"stream":     stream,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	}
+}
+
+// messageText 取出Claude响应中的文本
+func messageText(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var response struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, body)
+	}
+	var text strings.Builder
+	for _, block := range response.Content {
+		text.WriteString(block.Text)
+	}
+	return text.String()
+}
+
+// hitCounter 按路径统计模拟上游收到的请求数
+type hitCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (h *hitCounter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		h.counts[r.URL.Path]++
+		h.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *hitCounter) get(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.counts[path]
+}
+
+// 与 cmd/server 中的适配器一致，连接 oauth 与 proxy 两个包
+
+type oauthClientAdapter struct {
+	client *oauth.Client
+}
+
+func (a *oauthClientAdapter) RefreshAccessToken(ctx context.Context, refreshToken string, proxyConfig *proxy.ProxyConfig) (*proxy.OAuthData, error) {
+	oauthData, err := a.client.RefreshAccessToken(ctx, refreshToken, toOAuthProxy(proxyConfig))
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.OAuthData{
+		AccessToken:  oauthData.AccessToken,
+		RefreshToken: oauthData.RefreshToken,
+		ExpiresAt:    oauthData.ExpiresAt,
+		Scopes:       oauthData.Scopes,
+		ProxyConfig:  toRelayProxy(oauthData.ProxyConfig),
+	}, nil
+}
+
+type storageAdapter struct {
+	storage *oauth.Storage
+}
+
+func (a *storageAdapter) LoadOAuthData(accountName string) (*proxy.OAuthData, error) {
+	oauthData, err := a.storage.LoadOAuthData(accountName)
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.OAuthData{
+		ID:           oauthData.ID,
+		Name:         oauthData.Name,
+		AccessToken:  oauthData.AccessToken,
+		RefreshToken: oauthData.RefreshToken,
+		ExpiresAt:    oauthData.ExpiresAt,
+		Scopes:       oauthData.Scopes,
+		ProxyConfig:  toRelayProxy(oauthData.ProxyConfig),
+		Disabled:     oauthData.Disabled,
+		NeedsReauth:  oauthData.Quarantine != nil,
+	}, nil
+}
+
+func (a *storageAdapter) SaveOAuthData(accountName string, data *proxy.OAuthData) error {
+	_, err := a.storage.SaveTokens(accountName, &oauth.OAuthData{
+		AccessToken:  data.AccessToken,
+		RefreshToken: data.RefreshToken,
+		ExpiresAt:    data.ExpiresAt,
+		Scopes:       data.Scopes,
+		ProxyConfig:  toOAuthProxy(data.ProxyConfig),
+	})
+	return err
+}
+
+func (a *storageAdapter) ListAccounts() ([]*proxy.AccountSummary, error) {
+	accounts, err := a.storage.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]*proxy.AccountSummary, 0, len(accounts))
+	for _, account := range accounts {
+		summaries = append(summaries, &proxy.AccountSummary{
+			ID:          account.ID,
+			Name:        account.Name,
+			Priority:    account.Priority,
+			Disabled:    !account.Enabled,
+			NeedsReauth: account.NeedsReauth,
+			TierRank:    oauth.SubscriptionRank(account.SubscriptionType),
+			LastUsedAt:  account.LastUsedAt,
+			LastErrorAt: account.LastErrorAt,
+			Tags:        account.Tags,
+			Proxy:       account.Proxy,
+		})
+	}
+	return summaries, nil
+}
+
+func (a *storageAdapter) RecordAccountUse(accountName string, useErr error) error {
+	return a.storage.RecordAccountUse(accountName, useErr)
+}
+
+func (a *storageAdapter) QuarantineAccount(accountName, reason, message string) (bool, error) {
+	_, quarantined, err := a.storage.QuarantineAccount(accountName, reason, message)
+	return quarantined, err
+}
+
+func toOAuthProxy(p *proxy.ProxyConfig) *oauth.ProxyConfig {
+	if p == nil {
+		return nil
+	}
+	return &oauth.ProxyConfig{Type: p.Type, Host: p.Host, Port: p.Port, Username: p.Username, Password: p.Password}
+}
+
+func toRelayProxy(p *oauth.ProxyConfig) *proxy.ProxyConfig {
+	if p == nil {
+		return nil
+	}
+	return &proxy.ProxyConfig{Type: p.Type, Host: p.Host, Port: p.Port, Username: p.Username, Password: p.Password}
+}
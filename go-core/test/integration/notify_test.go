@@ -0,0 +1,251 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/notify"
+)
+
+const webhookSecret = "webhook-secret"
+
+// webhookReceiver 接收JSON格式的事件通知并校验签名
+type webhookReceiver struct {
+	t      *testing.T
+	mu     sync.Mutex
+	status int
+	events []notify.Event
+	server *httptest.Server
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	w := &webhookReceiver{t: t, status: http.StatusOK}
+	w.server = httptest.NewServer(http.HandlerFunc(w.handle))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func (w *webhookReceiver) handle(rw http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	signature := notify.Sign(webhookSecret, req.Header.Get(notify.HeaderTimestamp), body)
+	if req.Header.Get(notify.HeaderSignature) != signature {
+		w.t.Errorf("webhook签名不正确: %s", req.Header.Get(notify.HeaderSignature))
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event notify.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		w.t.Errorf("解析事件失败: %v", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status != http.StatusOK {
+		rw.WriteHeader(w.status)
+		return
+	}
+	w.events = append(w.events, event)
+}
+
+// failWith 之后的请求都返回指定状态码
+func (w *webhookReceiver) failWith(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status = status
+}
+
+// waitEvent 等待收到指定类型的事件
+func (w *webhookReceiver) waitEvent(eventType string) notify.Event {
+	w.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		w.mu.Lock()
+		for _, event := range w.events {
+			if event.Type == eventType {
+				w.mu.Unlock()
+				return event
+			}
+		}
+		w.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.t.Fatalf("没有收到 %s 通知，已收到: %v", eventType, w.types())
+	return notify.Event{}
+}
+
+// types 已收到的事件类型
+func (w *webhookReceiver) types() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	types := make([]string, 0, len(w.events))
+	for _, event := range w.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// withWebhook 通知发送到接收方，不去重、快速重试
+func withWebhook(w *webhookReceiver, configure ...func(cfg *config.Config)) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Notify.Webhooks = map[string]*config.WebhookConfig{
+			"ops": {URL: w.server.URL, Secret: webhookSecret, Format: config.WebhookFormatJSON},
+		}
+		cfg.Notify.DedupeWindow = 0
+		cfg.Notify.MaxRetries = 1
+		cfg.Notify.RetryBackoff = 10 * time.Millisecond
+		for _, c := range configure {
+			c(cfg)
+		}
+	}
+}
+
+func TestNotifyRefreshRejected(t *testing.T) {
+	w := newWebhookReceiver(t)
+	e := newEnv(t, mockupstream.Options{}, withWebhook(w))
+	e.importAccount("alice", nil)
+	alice := e.storedAccount("alice").ID
+
+	e.expireAccount("alice")
+	e.mock.RevokeRefreshToken("alice")
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("refresh token失效时转发不应成功")
+	}
+
+	failed := w.waitEvent(notify.EventTokenRefreshFailed)
+	if failed.Account != "alice" || failed.AccountID != alice || !strings.Contains(failed.Message, "invalid_grant") {
+		t.Errorf("刷新失败通知不正确: %+v", failed)
+	}
+	quarantined := w.waitEvent(notify.EventAccountQuarantined)
+	if quarantined.Account != "alice" || quarantined.Severity != notify.SeverityCritical ||
+		quarantined.Details["reason"] != "refresh_rejected" || quarantined.ID == "" || quarantined.Time.IsZero() {
+		t.Errorf("隔离通知不正确: %+v", quarantined)
+	}
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	w := newWebhookReceiver(t)
+	e := newEnv(t, mockupstream.Options{}, withWebhook(w))
+	e.importAccount("alice", nil)
+
+	e.mock.Script(mockupstream.RateLimited(30*time.Second), mockupstream.RateLimited(30*time.Second))
+	for i := 0; i < 2; i++ {
+		if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusTooManyRequests {
+			t.Fatalf("上游限流时应返回429，实际 %d", status)
+		}
+	}
+	entered := w.waitEvent(notify.EventRateLimitEntered)
+	if entered.Account != "alice" || entered.Details["retry_at"] == "" {
+		t.Errorf("限流通知不正确: %+v", entered)
+	}
+
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+		t.Fatalf("限流结束后转发应成功: %d %s", status, body)
+	}
+	w.waitEvent(notify.EventRateLimitCleared)
+	if types := strings.Join(w.types(), ","); types != "rate_limit_entered,rate_limit_cleared" {
+		t.Errorf("连续限流只应通知一次: %s", types)
+	}
+}
+
+func TestNotifyQuotaExhausted(t *testing.T) {
+	w := newWebhookReceiver(t)
+	e := newEnv(t, mockupstream.Options{}, withWebhook(w))
+	e.importAccount("alice", nil)
+
+	e.mock.Script(mockupstream.Reply{Status: http.StatusTooManyRequests, Message: "Claude AI usage limit reached|1760000000"})
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusTooManyRequests {
+		t.Fatalf("额度用尽时应返回429，实际 %d", status)
+	}
+	exhausted := w.waitEvent(notify.EventQuotaExhausted)
+	if exhausted.Account != "alice" || !strings.Contains(exhausted.Message, "usage limit") {
+		t.Errorf("额度用尽通知不正确: %+v", exhausted)
+	}
+}
+
+func TestNotifyProxyDown(t *testing.T) {
+	w := newWebhookReceiver(t)
+	e := newEnv(t, mockupstream.Options{}, withWebhook(w, withBreaker(time.Hour)))
+	p := newSOCKS5Proxy(t, "proxyuser", "proxypass")
+	proxyConfig := p.config()
+	e.importAccount("alice", proxyConfig)
+
+	p.close()
+	for i := 0; i < 2; i++ {
+		if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+			t.Fatalf("代理不可用时转发不应成功")
+		}
+	}
+	down := w.waitEvent(notify.EventProxyDown)
+	if down.Proxy != proxyConfig.String() || strings.Contains(down.Proxy, "proxypass") {
+		t.Errorf("代理不可用通知不正确（不应包含认证信息）: %+v", down)
+	}
+
+	status, body := e.do(http.MethodPost, "/admin/circuits/reset", map[string]string{"kind": "egress", "name": proxyConfig.String()})
+	if status != http.StatusOK {
+		t.Fatalf("手动恢复失败: %d %s", status, body)
+	}
+	if recovered := w.waitEvent(notify.EventProxyRecovered); recovered.Proxy != proxyConfig.String() {
+		t.Errorf("代理恢复通知不正确: %+v", recovered)
+	}
+}
+
+func TestNotifyDeadLetters(t *testing.T) {
+	w := newWebhookReceiver(t)
+	e := newEnv(t, mockupstream.Options{}, withWebhook(w))
+	e.importAccount("alice", nil)
+
+	// 测试通知
+	status, body := e.do(http.MethodPost, "/admin/notifications/test", nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"delivered":1`) {
+		t.Fatalf("测试通知应投递成功: %d %s", status, body)
+	}
+	w.waitEvent(notify.EventTest)
+	if status, _ := e.do(http.MethodPost, "/admin/notifications/test", map[string]string{"webhook": "nobody"}); status != http.StatusNotFound {
+		t.Errorf("不存在的webhook应返回404，实际 %d", status)
+	}
+
+	// 接收方持续出错时重试用尽后写入死信日志
+	w.failWith(http.StatusServiceUnavailable)
+	e.mock.Script(mockupstream.RateLimited(time.Minute))
+	e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false))
+
+	var resp struct {
+		DeadLetters []notify.DeadLetter `json:"dead_letters"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(resp.DeadLetters) == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		status, body = e.do(http.MethodGet, "/admin/notifications/dead-letters?limit=10", nil)
+		if status != http.StatusOK {
+			t.Fatalf("查询死信日志失败: %d %s", status, body)
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("解析死信日志失败: %v", err)
+		}
+	}
+	if len(resp.DeadLetters) != 1 {
+		t.Fatalf("应有1条死信记录: %s", body)
+	}
+	letter := resp.DeadLetters[0]
+	if letter.Webhook != "ops" || letter.Attempts != 2 || letter.Event.Type != notify.EventRateLimitEntered ||
+		!strings.Contains(letter.Error, "503") {
+		t.Errorf("死信记录不正确: %+v", letter)
+	}
+
+	status, body = e.do(http.MethodPost, "/admin/notifications/test", nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"failed":1`) {
+		t.Errorf("接收方出错时测试通知应返回失败: %d %s", status, body)
+	}
+	if status, _ := e.do(http.MethodGet, "/admin/notifications/dead-letters?limit=0", nil); status != http.StatusBadRequest {
+		t.Errorf("无效的limit应返回400，实际 %d", status)
+	}
+}
@@ -0,0 +1,187 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/mockupstream"
+)
+
+// authURLResponse POST /oauth/auth-url 的响应
+type authURLResponse struct {
+	AuthURL     string `json:"auth_url"`
+	State       string `json:"state"`
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// codePattern 模拟授权页面展示的 code#state
+var codePattern = regexp.MustCompile(`<pre>([^<]+)</pre>`)
+
+// generateAuthURL 调用 /oauth/auth-url
+func (e *env) generateAuthURL(body map[string]interface{}) authURLResponse {
+	e.t.Helper()
+
+	status, data := e.do(http.MethodPost, "/oauth/auth-url", body)
+	if status != http.StatusOK {
+		e.t.Fatalf("生成授权URL失败: %d %s", status, data)
+	}
+	var resp authURLResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		e.t.Fatalf("解析授权URL响应失败: %v", err)
+	}
+	return resp
+}
+
+// authorize 在模拟授权页面以指定账户登录，返回页面展示的 code#state
+func (e *env) authorize(authURL, account string) string {
+	e.t.Helper()
+
+	resp, err := http.Get(authURL + "&account=" + url.QueryEscape(account))
+	if err != nil {
+		e.t.Fatalf("打开授权页面失败: %v", err)
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	match := codePattern.FindSubmatch(page)
+	if resp.StatusCode != http.StatusOK || match == nil {
+		e.t.Fatalf("授权页面没有返回授权码: %d %s", resp.StatusCode, page)
+	}
+	return string(match[1])
+}
+
+func TestAuthURLExchangeAndRelay(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+
+	auth := e.generateAuthURL(map[string]interface{}{})
+	parsed, err := url.Parse(auth.AuthURL)
+	if err != nil {
+		t.Fatalf("无效的授权URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("state") != auth.State {
+		t.Fatalf("授权URL缺少PKCE参数: %s", auth.AuthURL)
+	}
+	if !strings.HasPrefix(auth.AuthURL, e.upstream.URL+mockupstream.AuthorizePath) {
+		t.Fatalf("授权URL未指向配置的授权地址: %s", auth.AuthURL)
+	}
+
+	code := e.authorize(auth.AuthURL, "alice")
+	if !strings.HasSuffix(code, "#"+auth.State) {
+		t.Fatalf("授权码应为 code#state 形式: %s", code)
+	}
+
+	status, body := e.do(http.MethodPost, "/oauth/token", map[string]interface{}{
+		"authorization_code": code,
+		"state":              auth.State,
+		"account_name":       "alice",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token交换失败: %d %s", status, body)
+	}
+
+	// 保存的token与模拟上游签发的一致，账户资料已读取
+	stored := e.storedAccount("alice")
+	upstream, _ := e.mock.Account("alice")
+	if stored.AccessToken != upstream.AccessToken || stored.RefreshToken != upstream.RefreshToken {
+		t.Fatalf("保存的token与上游签发的不一致")
+	}
+	if stored.Profile == nil || stored.Profile.Email != upstream.Email {
+		t.Fatalf("账户资料未读取: %+v", stored.Profile)
+	}
+
+	status, body = e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status != http.StatusOK {
+		t.Fatalf("转发失败: %d %s", status, body)
+	}
+	if text := messageText(t, body); !strings.Contains(text, "alice") {
+		t.Fatalf("响应不是来自alice的token: %q", text)
+	}
+
+	// PKCE会话在交换后删除，同一state不能再次使用
+	status, _ = e.do(http.MethodPost, "/oauth/token", map[string]interface{}{
+		"authorization_code": code,
+		"state":              auth.State,
+		"account_name":       "alice",
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("重复使用state应返回400，实际 %d", status)
+	}
+}
+
+func TestExchangeRejectsInvalidCode(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+
+	// 授权码由另一次授权签发，code_verifier不匹配
+	first := e.generateAuthURL(map[string]interface{}{})
+	code := e.authorize(first.AuthURL, "alice")
+	second := e.generateAuthURL(map[string]interface{}{})
+
+	status, body := e.do(http.MethodPost, "/oauth/token", map[string]interface{}{
+		"authorization_code": code,
+		"state":              second.State,
+		"account_name":       "alice",
+	})
+	if status != http.StatusInternalServerError || !strings.Contains(string(body), "invalid_grant") {
+		t.Fatalf("PKCE校验失败应返回invalid_grant，实际 %d %s", status, body)
+	}
+	if _, err := e.storage.LoadOAuthData("alice"); err == nil {
+		t.Fatalf("交换失败时不应保存账户")
+	}
+}
+
+func TestLoopbackCallback(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	// 回调路由已按路径注册，换成测试服务器的实际地址
+	e.cfg.OAuth.LoopbackRedirectURI = e.server.URL + "/callback"
+
+	auth := e.generateAuthURL(map[string]interface{}{"callback_mode": "loopback", "account_name": "bob"})
+	if auth.RedirectURI != e.cfg.OAuth.LoopbackRedirectURI {
+		t.Fatalf("loopback模式应使用本地回调地址: %s", auth.RedirectURI)
+	}
+
+	// 模拟授权页面重定向到回调地址，由转发服务完成token交换
+	resp, err := http.Get(auth.AuthURL + "&account=bob")
+	if err != nil {
+		t.Fatalf("授权失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/callback" {
+		t.Fatalf("回调失败: %d %s", resp.StatusCode, resp.Request.URL)
+	}
+
+	upstream, _ := e.mock.Account("bob")
+	if stored := e.storedAccount("bob"); stored.AccessToken != upstream.AccessToken {
+		t.Fatalf("回调后保存的token与上游签发的不一致")
+	}
+}
+
+func TestExportRequiresAdminToken(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, func(cfg *config.Config) { cfg.Auth.AdminToken = "" })
+	e.importAccount("alice", nil)
+
+	requests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodGet, "/oauth/accounts/alice/export", nil},
+		{http.MethodPost, "/oauth/backup", map[string]string{"passphrase": "a-long-passphrase"}},
+		{http.MethodPost, "/oauth/restore", map[string]interface{}{"passphrase": "a-long-passphrase", "backup": map[string]interface{}{}}},
+	}
+	for _, r := range requests {
+		if status, body := e.do(r.method, r.path, r.body); status != http.StatusForbidden || !strings.Contains(string(body), "ADMIN_TOKEN") {
+			t.Errorf("未配置管理令牌时 %s %s 应返回403并提示设置ADMIN_TOKEN: %d %s", r.method, r.path, status, body)
+		}
+	}
+
+	// 其他管理接口不受影响
+	if status, body := e.do(http.MethodGet, "/oauth/accounts/alice/status", nil); status != http.StatusOK {
+		t.Errorf("未配置管理令牌时账户状态接口应可用: %d %s", status, body)
+	}
+}
@@ -0,0 +1,333 @@
+package integration
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/oauth"
+)
+
+// socks5Proxy 本地SOCKS5代理替身（RFC 1928），支持无认证和用户名密码认证，只实现CONNECT
+type socks5Proxy struct {
+	listener net.Listener
+	username string
+	password string
+	conns    atomic.Int64 // 成功建立的CONNECT数
+
+	mu     sync.Mutex
+	active map[net.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+func newSOCKS5Proxy(t *testing.T, username, password string) *socks5Proxy {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动SOCKS5代理失败: %v", err)
+	}
+	p := &socks5Proxy{listener: listener, username: username, password: password, active: make(map[net.Conn]struct{})}
+	go p.serve()
+	t.Cleanup(p.close)
+	return p
+}
+
+func (p *socks5Proxy) config() *oauth.ProxyConfig {
+	addr := p.listener.Addr().(*net.TCPAddr)
+	return &oauth.ProxyConfig{Type: "socks5", Host: addr.IP.String(), Port: addr.Port, Username: p.username, Password: p.password}
+}
+
+func (p *socks5Proxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		p.active[conn] = struct{}{}
+		p.mu.Unlock()
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.handle(conn)
+
+			p.mu.Lock()
+			delete(p.active, conn)
+			p.mu.Unlock()
+		}()
+	}
+}
+
+// close 停止监听并断开客户端保持的连接
+func (p *socks5Proxy) close() {
+	p.listener.Close()
+	p.mu.Lock()
+	for conn := range p.active {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *socks5Proxy) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// 协商认证方法
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil || header[0] != 5 {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return
+	}
+	method := byte(0x00)
+	if p.username != "" {
+		method = 0x02
+	}
+	if !containsByte(methods, method) {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, method})
+
+	if method == 0x02 && !p.authenticate(reader, conn) {
+		return
+	}
+
+	// CONNECT请求
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(reader, request); err != nil || request[1] != 1 {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		length, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(reader, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(reader, port); err != nil {
+		return
+	}
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	p.conns.Add(1)
+
+	go func() {
+		io.Copy(target, reader)
+		target.(*net.TCPConn).CloseWrite()
+	}()
+	io.Copy(conn, target)
+}
+
+// authenticate 用户名密码认证（RFC 1929）
+func (p *socks5Proxy) authenticate(reader *bufio.Reader, conn net.Conn) bool {
+	version, err := reader.ReadByte()
+	if err != nil || version != 1 {
+		return false
+	}
+	readField := func() string {
+		length, err := reader.ReadByte()
+		if err != nil {
+			return ""
+		}
+		field := make([]byte, length)
+		if _, err := io.ReadFull(reader, field); err != nil {
+			return ""
+		}
+		return string(field)
+	}
+	username, password := readField(), readField()
+	if username != p.username || password != p.password {
+		conn.Write([]byte{1, 1})
+		return false
+	}
+	conn.Write([]byte{1, 0})
+	return true
+}
+
+func containsByte(values []byte, value byte) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// httpProxy 本地HTTP代理替身：上游是http地址时客户端以绝对URI发送请求，由代理转发
+type httpProxy struct {
+	server   *httptest.Server
+	username string
+	password string
+	requests atomic.Int64 // 转发成功的请求数
+}
+
+func newHTTPProxy(t *testing.T, username, password string) *httpProxy {
+	t.Helper()
+
+	p := &httpProxy{username: username, password: password}
+	p.server = httptest.NewServer(http.HandlerFunc(p.handle))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *httpProxy) config() *oauth.ProxyConfig {
+	addr := p.server.Listener.Addr().(*net.TCPAddr)
+	return &oauth.ProxyConfig{Type: "http", Host: addr.IP.String(), Port: addr.Port, Username: p.username, Password: p.password}
+}
+
+func (p *httpProxy) handle(w http.ResponseWriter, r *http.Request) {
+	if p.username != "" {
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(p.username+":"+p.password))
+		if r.Header.Get("Proxy-Authorization") != expected {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+			http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	outbound := r.Clone(r.Context())
+	outbound.RequestURI = ""
+	outbound.Header.Del("Proxy-Authorization")
+	resp, err := http.DefaultTransport.RoundTrip(outbound)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	p.requests.Add(1)
+
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func TestAccountProxyTransports(t *testing.T) {
+	cases := []struct {
+		name     string
+		username string
+		password string
+		socks    bool
+	}{
+		{"socks5", "", "", true},
+		{"socks5-auth", "relay", "s3cret", true},
+		{"http", "", "", false},
+		{"http-auth", "relay", "p@ss:word", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEnv(t, mockupstream.Options{}, nil)
+
+			var proxyConfig *oauth.ProxyConfig
+			var used func() int64
+			if tc.socks {
+				p := newSOCKS5Proxy(t, tc.username, tc.password)
+				proxyConfig, used = p.config(), p.conns.Load
+			} else {
+				p := newHTTPProxy(t, tc.username, tc.password)
+				proxyConfig, used = p.config(), p.requests.Load
+			}
+
+			// 导入时的token刷新和资料读取经过代理
+			e.importAccount("alice", proxyConfig)
+			afterImport := used()
+			if afterImport == 0 {
+				t.Fatalf("导入时的token刷新未经过代理")
+			}
+
+			status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+			if status != http.StatusOK {
+				t.Fatalf("经代理转发失败: %d %s", status, body)
+			}
+			if used() == afterImport {
+				t.Fatalf("转发请求未经过代理")
+			}
+
+			// token过期后的刷新同样经过账户代理
+			e.expireAccount("alice")
+			beforeRefresh := used()
+			if status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false)); status != http.StatusOK {
+				t.Fatalf("经代理刷新后转发失败: %d %s", status, body)
+			}
+			if used()-beforeRefresh < 2 {
+				t.Fatalf("刷新和转发应都经过代理")
+			}
+		})
+	}
+}
+
+func TestProxyAuthenticationFailure(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+
+	// 全局代理认证失败时转发失败，不会绕过代理直连上游
+	p := newSOCKS5Proxy(t, "relay", "s3cret")
+	wrong := p.config()
+	e.relay.UpdateConfig(withGlobalProxy(e.cfg, &config.GlobalProxyConfig{
+		Enabled:  true,
+		Type:     wrong.Type,
+		Host:     wrong.Host,
+		Port:     wrong.Port,
+		Username: "relay",
+		Password: "wrong",
+	}))
+
+	status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status == http.StatusOK {
+		t.Fatalf("代理认证失败时不应转发成功: %s", body)
+	}
+	if requests := e.mock.Requests(); len(requests) != 0 {
+		t.Fatalf("代理认证失败时不应直连上游，实际 %d 次", len(requests))
+	}
+}
+
+// withGlobalProxy 复制配置并设置全局代理
+func withGlobalProxy(cfg *config.Config, global *config.GlobalProxyConfig) *config.Config {
+	updated := *cfg
+	updated.Proxy.GlobalProxy = global
+	return &updated
+}
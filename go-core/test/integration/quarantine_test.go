@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/oauth"
+)
+
+// accountInfo 读取账户状态中的账户概要
+func (e *env) accountInfo(account string) *oauth.AccountInfo {
+	e.t.Helper()
+
+	status, body := e.do(http.MethodGet, "/oauth/accounts/"+account+"/status", nil)
+	if status != http.StatusOK {
+		e.t.Fatalf("读取账户状态失败: %d %s", status, body)
+	}
+	var resp struct {
+		Info *oauth.AccountInfo `json:"info"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		e.t.Fatalf("解析账户状态失败: %v", err)
+	}
+	return resp.Info
+}
+
+// expectQuarantined 检查账户已因指定原因被隔离，且不再参与调度
+func (e *env) expectQuarantined(account, reason, other string) {
+	e.t.Helper()
+
+	info := e.accountInfo(account)
+	if info.Status != oauth.AccountStatusNeedsReauth || !info.NeedsReauth || info.Quarantine == nil ||
+		info.Quarantine.Reason != reason || info.Quarantine.At.IsZero() {
+		e.t.Fatalf("账户 %s 应因 %s 被隔离: %+v", account, reason, info)
+	}
+
+	for i := 0; i < 3; i++ {
+		status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+		if status != http.StatusOK || !strings.Contains(messageText(e.t, body), other) {
+			e.t.Fatalf("调度应跳过被隔离的账户: %d %s", status, body)
+		}
+	}
+
+	upstreamRequests := len(e.mock.Requests())
+	refreshes := e.hits.get(mockupstream.TokenPath)
+	status, body := e.do(http.MethodPost, "/api/v1/messages?account="+account, messageRequest(false))
+	if status != http.StatusForbidden || !strings.Contains(string(body), "重新授权") {
+		e.t.Fatalf("指定被隔离的账户应返回403，实际 %d %s", status, body)
+	}
+	if len(e.mock.Requests()) != upstreamRequests || e.hits.get(mockupstream.TokenPath) != refreshes {
+		e.t.Fatalf("被隔离的账户不应再请求上游或刷新token")
+	}
+}
+
+func TestRefreshRejectedQuarantinesAccount(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	e.importAccount("bob", nil)
+
+	e.expireAccount("alice")
+	e.mock.RevokeRefreshToken("alice")
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("refresh token失效时转发不应成功: %s", body)
+	}
+	e.expectQuarantined("alice", "refresh_rejected", "bob")
+
+	// 重新导入凭据后自动解除隔离
+	e.importAccount("alice", nil)
+	if info := e.accountInfo("alice"); info.NeedsReauth || info.Quarantine != nil {
+		t.Fatalf("重新导入后应解除隔离: %+v", info)
+	}
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+		t.Fatalf("重新导入后转发应成功: %d %s", status, body)
+	}
+}
+
+func TestOrganizationDisabledQuarantinesAccount(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	e.importAccount("bob", nil)
+
+	e.mock.Script(mockupstream.Reply{Status: http.StatusForbidden, Type: "permission_error", Message: "This organization has been disabled."})
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("组织被禁用时转发不应成功")
+	}
+	e.expectQuarantined("alice", "organization_disabled", "bob")
+	if info := e.accountInfo("alice"); !strings.Contains(info.Quarantine.Message, "organization has been disabled") {
+		t.Fatalf("隔离信息应包含上游的错误说明: %+v", info.Quarantine)
+	}
+
+	// 管理员确认后手动解除隔离
+	status, body := e.do(http.MethodDelete, "/oauth/accounts/alice/quarantine", nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"released":true`) {
+		t.Fatalf("解除隔离失败: %d %s", status, body)
+	}
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+		t.Fatalf("解除隔离后转发应成功: %d %s", status, body)
+	}
+	if status, body := e.do(http.MethodDelete, "/oauth/accounts/alice/quarantine", nil); status != http.StatusOK || !strings.Contains(string(body), `"released":false`) {
+		t.Fatalf("未被隔离的账户解除隔离应返回released=false: %d %s", status, body)
+	}
+	if status, _ := e.do(http.MethodDelete, "/oauth/accounts/nobody/quarantine", nil); status != http.StatusNotFound {
+		t.Fatalf("不存在的账户应返回404，实际 %d", status)
+	}
+}
+
+func TestRevokedTokenQuarantinesAccount(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	e.importAccount("bob", nil)
+
+	e.mock.Script(mockupstream.Reply{Status: http.StatusUnauthorized, Message: "OAuth token has been revoked"})
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("token被吊销时转发不应成功")
+	}
+	e.expectQuarantined("alice", "token_revoked", "bob")
+}
+
+func TestUnauthorizedForcesRefresh(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	before := e.storedAccount("alice")
+	refreshes := e.hits.get(mockupstream.TokenPath)
+
+	// 普通401强制刷新token，刷新成功则账户继续可用
+	e.mock.Script(mockupstream.Unauthorized())
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("上游返回401时转发不应成功")
+	}
+	if got := e.hits.get(mockupstream.TokenPath) - refreshes; got != 1 {
+		t.Fatalf("401后应强制刷新1次token，实际 %d 次", got)
+	}
+	if after := e.storedAccount("alice"); after.AccessToken == before.AccessToken || after.Quarantine != nil {
+		t.Fatalf("强制刷新后应保存新token且不隔离账户")
+	}
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+		t.Fatalf("强制刷新后转发应成功: %d %s", status, body)
+	}
+
+	// refresh token也被拒绝时隔离账户
+	e.mock.RevokeRefreshToken("alice")
+	e.mock.Script(mockupstream.Unauthorized())
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("上游返回401时转发不应成功")
+	}
+	if info := e.accountInfo("alice"); info.Quarantine == nil || info.Quarantine.Reason != "refresh_rejected" {
+		t.Fatalf("refresh token被拒绝后应隔离账户: %+v", info)
+	}
+}
+
+func TestPermissionErrorDoesNotQuarantine(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	refreshes := e.hits.get(mockupstream.TokenPath)
+
+	e.mock.Script(mockupstream.Reply{Status: http.StatusForbidden})
+	if status, _ := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status == http.StatusOK {
+		t.Fatalf("上游返回403时转发不应成功")
+	}
+	if info := e.accountInfo("alice"); info.NeedsReauth || e.hits.get(mockupstream.TokenPath) != refreshes {
+		t.Fatalf("权限错误不应隔离账户或刷新token: %+v", info)
+	}
+
+	// 请求本身的错误原样返回给客户端
+	e.mock.Script(mockupstream.Reply{Status: http.StatusBadRequest, Message: "max_tokens: Field required"})
+	status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false))
+	if status != http.StatusBadRequest || !strings.Contains(string(body), "invalid_request_error") {
+		t.Fatalf("请求错误应透传400，实际 %d %s", status, body)
+	}
+}
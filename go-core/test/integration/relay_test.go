@@ -0,0 +1,309 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"claude-relay-core/internal/config"
+	"claude-relay-core/internal/mockupstream"
+	"claude-relay-core/internal/oauth"
+	"claude-relay-core/internal/usage"
+)
+
+func TestRelayRefreshesExpiredToken(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	before := e.storedAccount("alice")
+	refreshes := e.hits.get(mockupstream.TokenPath)
+
+	e.expireAccount("alice")
+	status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status != http.StatusOK {
+		t.Fatalf("token过期后转发失败: %d %s", status, body)
+	}
+
+	if got := e.hits.get(mockupstream.TokenPath) - refreshes; got != 1 {
+		t.Fatalf("应刷新1次token，实际 %d 次", got)
+	}
+	after := e.storedAccount("alice")
+	upstream, _ := e.mock.Account("alice")
+	if after.AccessToken == before.AccessToken || after.AccessToken != upstream.AccessToken {
+		t.Fatalf("刷新后的access token未保存")
+	}
+	if after.RefreshToken != upstream.RefreshToken {
+		t.Fatalf("轮换后的refresh token未保存")
+	}
+	if !after.ExpiresAt.After(time.Now().Add(30 * time.Minute)) {
+		t.Fatalf("刷新后的过期时间不正确: %s", after.ExpiresAt)
+	}
+}
+
+func TestRelayRefreshRejected(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+
+	e.expireAccount("alice")
+	e.mock.RevokeRefreshToken("alice")
+	status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status == http.StatusOK || !strings.Contains(string(body), "invalid_grant") {
+		t.Fatalf("refresh token失效时应返回invalid_grant错误，实际 %d %s", status, body)
+	}
+	if requests := e.mock.Requests(); len(requests) != 0 {
+		t.Fatalf("刷新失败时不应请求上游，实际 %d 次", len(requests))
+	}
+}
+
+func TestConcurrentRefreshHappensOnce(t *testing.T) {
+	// 模拟上游每次刷新都轮换refresh token，重复刷新会因为旧token失效而失败
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	refreshes := e.hits.get(mockupstream.TokenPath)
+	e.expireAccount("alice")
+
+	const workers = 16
+	var wg sync.WaitGroup
+	statuses := make([]int, workers)
+	bodies := make([][]byte, workers)
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			statuses[i], bodies[i] = e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("并发请求 %d 失败: %d %s", i, status, bodies[i])
+		}
+	}
+	if got := e.hits.get(mockupstream.TokenPath) - refreshes; got != 1 {
+		t.Fatalf("并发请求应只刷新1次token，实际 %d 次", got)
+	}
+	upstream, _ := e.mock.Account("alice")
+	if stored := e.storedAccount("alice"); stored.RefreshToken != upstream.RefreshToken {
+		t.Fatalf("保存的refresh token不是最新的")
+	}
+}
+
+func TestUpstreamErrorPassthrough(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+
+	// 限流和过载原样返回上游的状态码和响应体；账户认证失败与客户端无关，返回503
+	cases := []struct {
+		reply       mockupstream.Reply
+		status      int
+		passthrough bool
+	}{
+		{mockupstream.RateLimited(30 * time.Second), http.StatusTooManyRequests, true},
+		{mockupstream.Overloaded(), 529, true},
+		{mockupstream.Unauthorized(), http.StatusServiceUnavailable, false},
+	}
+	for _, tc := range cases {
+		e.mock.Script(tc.reply)
+		status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+		if status != tc.status {
+			t.Errorf("上游返回 %d 时应返回 %d，实际 %d: %s", tc.reply.Status, tc.status, status, body)
+		}
+		if !tc.passthrough {
+			if !strings.Contains(string(body), "authentication_error") {
+				t.Errorf("错误信息应包含上游的错误类型: %s", body)
+			}
+			continue
+		}
+		var got interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("响应体不是JSON: %v %s", err, body)
+		}
+		want := toJSONValue(t, tc.reply.Body())
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("上游错误 %d 未原样透传: %s", tc.reply.Status, body)
+		}
+	}
+
+	// 编排的错误用完后恢复正常
+	status, body := e.do(http.MethodPost, "/api/v1/messages", messageRequest(false))
+	if status != http.StatusOK {
+		t.Fatalf("上游恢复后转发失败: %d %s", status, body)
+	}
+
+	requests := e.mock.Requests()
+	if len(requests) != len(cases)+1 {
+		t.Fatalf("上游应收到 %d 个请求，实际 %d", len(cases)+1, len(requests))
+	}
+	for i, tc := range cases {
+		if requests[i].Status != tc.reply.Status || requests[i].Account != "alice" {
+			t.Errorf("上游请求 %d: %+v", i, requests[i])
+		}
+	}
+}
+
+func TestUnknownAccountAndPool(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, func(cfg *config.Config) { cfg.Metrics.Enabled = true })
+	e.importAccount("alice", nil)
+
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?pool=missing", messageRequest(false)); status != http.StatusBadRequest {
+		t.Errorf("未定义的账户池应返回400，实际 %d %s", status, body)
+	}
+	if status, body := e.do(http.MethodPost, "/api/v1/messages?account=nobody-metrics-label", messageRequest(false)); status == http.StatusOK {
+		t.Errorf("不存在的账户不应转发成功: %s", body)
+	}
+	if requests := e.mock.Requests(); len(requests) != 0 {
+		t.Fatalf("请求失败时不应访问上游，实际 %d 次", len(requests))
+	}
+
+	// 客户端传入的账户名不应成为监控标签
+	status, body := e.do(http.MethodGet, "/metrics", nil)
+	if status != http.StatusOK {
+		t.Fatalf("抓取监控指标失败: %d", status)
+	}
+	if strings.Contains(string(body), "nobody-metrics-label") || !strings.Contains(string(body), `account="unknown"`) {
+		t.Errorf("不存在的账户应记为unknown")
+	}
+}
+
+func TestStreamingRelay(t *testing.T) {
+	const delay = 40 * time.Millisecond
+	e := newEnv(t, mockupstream.Options{StreamDelay: delay}, nil)
+	e.importAccount("alice", nil)
+
+	data, _ := json.Marshal(messageRequest(true))
+	start := time.Now()
+	resp, err := http.Post(e.server.URL+"/api/v1/messages", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("发送流式请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("应返回SSE事件流: %d %s %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	// 第一个事件应在上游发完之前到达，而不是等整个响应读完
+	reader := bufio.NewReader(resp.Body)
+	first, err := reader.ReadString('\n')
+	if err != nil || !strings.Contains(first, "message_start") {
+		t.Fatalf("第一个事件应为 message_start: %q %v", first, err)
+	}
+	firstEvent := time.Since(start)
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("读取流式响应失败: %v", err)
+	}
+	total := time.Since(start)
+	if !strings.Contains(string(rest), "event: message_stop") {
+		t.Fatalf("流式响应不完整: %s", rest)
+	}
+	if firstEvent > total/2 {
+		t.Errorf("事件应逐个转发：首个事件 %s，全部 %s", firstEvent, total)
+	}
+
+	requests := e.mock.Requests()
+	if len(requests) != 1 || !requests[0].Stream {
+		t.Fatalf("stream参数应透传到上游: %+v", requests)
+	}
+
+	// 用量从 message_start 和 message_delta 中累计
+	status, body := e.do(http.MethodGet, "/admin/usage?group_by=total", nil)
+	var usageResp struct {
+		Records []usage.Record `json:"records"`
+	}
+	if err := json.Unmarshal(body, &usageResp); status != http.StatusOK || err != nil || len(usageResp.Records) != 1 {
+		t.Fatalf("查询用量失败: %d %s", status, body)
+	}
+	if record := usageResp.Records[0]; record.Requests != 1 || record.InputTokens == 0 || record.OutputTokens <= 1 {
+		t.Errorf("流式请求的用量不正确: %+v", record)
+	}
+}
+
+func TestShutdownDrainsStream(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{StreamDelay: 40 * time.Millisecond}, nil)
+	e.importAccount("alice", nil)
+
+	data, _ := json.Marshal(messageRequest(true))
+	resp, err := http.Post(e.server.URL+"/api/v1/messages", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("发送流式请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.Contains(line, "message_start") {
+		t.Fatalf("第一个事件应为 message_start: %q %v", line, err)
+	}
+
+	// 停止服务时等待进行中的流式响应发送完毕
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- e.server.Config.Shutdown(ctx)
+	}()
+	rest, err := io.ReadAll(reader)
+	if err != nil || !strings.Contains(string(rest), "event: message_stop") {
+		t.Fatalf("停止服务时流式响应应完整发送: %v %s", err, rest)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("等待请求完成失败: %v", err)
+	}
+}
+
+func TestAccountUsePersistence(t *testing.T) {
+	e := newEnv(t, mockupstream.Options{}, nil)
+	e.importAccount("alice", nil)
+	// 另一个存储实例只能看到已写入文件的状态
+	onDisk := func() *oauth.OAuthData {
+		data, err := oauth.NewStorage(e.cfg.Server.DataDir).LoadOAuthData("alice")
+		if err != nil {
+			t.Fatalf("读取账户文件失败: %v", err)
+		}
+		return data
+	}
+
+	for i := 0; i < 2; i++ {
+		if status, body := e.do(http.MethodPost, "/api/v1/messages?account=alice", messageRequest(false)); status != http.StatusOK {
+			t.Fatalf("转发失败: %d %s", status, body)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 第一次使用立即写入，间隔内的后续使用只记在内存中
+	latest, persisted := e.storedAccount("alice").LastUsedAt, onDisk().LastUsedAt
+	if latest == nil || persisted == nil || !latest.After(*persisted) {
+		t.Fatalf("间隔内的使用不应写入文件: 内存 %v 文件 %v", latest, persisted)
+	}
+
+	if err := e.storage.FlushAccountUse(); err != nil {
+		t.Fatalf("写入账户使用状态失败: %v", err)
+	}
+	if persisted := onDisk().LastUsedAt; persisted == nil || !persisted.Equal(*latest) {
+		t.Errorf("写入后文件应为最近使用时间: %v，应为 %v", persisted, latest)
+	}
+}
+
+// toJSONValue 经JSON编解码得到可与响应体比较的值
+func toJSONValue(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	return out
+}